@@ -109,10 +109,17 @@ buildgo() {
 
     GOFLAGS="-tags ${BUILD_TAGS} -trimpath  "
 
+    # Optional runtime memory bounds, e.g. RAM_SIZE=0x40000000 (maximum
+    # heap size) and RAM_CEILING=0x100000000 (heap placed below 4GB).
+    ASMFLAGS=""
+    [ -n "${RAM_SIZE}" ] && ASMFLAGS="${ASMFLAGS} -D RAM_SIZE=${RAM_SIZE}"
+    [ -n "${RAM_CEILING}" ] && ASMFLAGS="${ASMFLAGS} -D RAM_CEILING=${RAM_CEILING}"
+
     # Build the Go UEFI application
     echo "Building ${APP}.efi..."
     cd "${PROJECT_ROOT}"
     go build ${GOFLAGS} -ldflags '-s -w -E cpuinit -T 0x10010000 -R 0x1000 ' \
+        -asmflags "github.com/costinm/uki-stub/pkg/ueficore/x64=${ASMFLAGS}" \
         -o ${BUILD_DIR}/${APP}.elf ./cmd/${APP}/
 
     objcopy \
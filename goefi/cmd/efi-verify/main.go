@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"log"
 	"os"
 	"strconv"
-	"unicode/utf16"
 	"unsafe"
 
+	"github.com/costinm/uki-stub/pkg/efivar"
 	uefi "github.com/costinm/uki-stub/pkg/ueficore"
 	"github.com/costinm/uki-stub/pkg/ueficore/x64"
 )
@@ -73,12 +74,6 @@ func main() {
 	}
 }
 
-func stringToUTF16Ptr(s string) *uint16 {
-	utf16Slice := utf16.Encode([]rune(s))
-	utf16Slice = append(utf16Slice, 0) // null terminate
-	return &utf16Slice[0]
-}
-
 func load(path string) ([]byte, error) {
 	// TODO: load sig, config, initrd - and verify each sha using the pub key
 	root, err := x64.UEFI.Root()
@@ -131,18 +126,15 @@ func executeKernel(path string, data []byte, cmdline string) (string, error) {
 	// Note that a sha256 of the image base is NOT the same with the SHA of
 	// the bytes loaded from disk - so we can't go the other way
 
-	// Use LoadedImage protocol to get set the command line
-	_, rawMemoryAddress, err := x64.UEFI.Boot.LoadImageHandle(h)
-
-	ptr := stringToUTF16Ptr(cmdline)
-	//fmt.Println("Loaded image", limg)
+	// Use LoadedImage protocol to set the command line
+	if err = x64.UEFI.Boot.SetLoadOptions(h, cmdline); err != nil {
+		return "", errors.New("could not set cmdline " + err.Error())
+	}
 
-	addr := uintptr(rawMemoryAddress)
-	// Convert the uintptr to a *uint32 pointer
-	cmdlineLenPtr := (*uint32)(unsafe.Pointer(addr + 48))
-	*cmdlineLenPtr = uint32(len(cmdline) * 2)
-	cmdlinePtr := (*uint64)(unsafe.Pointer(addr + 56))
-	*cmdlinePtr = uefi.Ptrval(ptr)
+	// not fatal, the kernel boots without the loader variables
+	if err = x64.PublishLoaderInfo("uki-stub efi-verify", efivar.StubFeatureReportBootPartition); err != nil {
+		log.Printf("could not publish loader variables, %v", err)
+	}
 
 	//log.Printf("starting EFI image %#x", h)
 	return "", x64.UEFI.Boot.StartImage(h)
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/minisign"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// Add-ons are per-host cmdline fragments and initrd cpio archives, loaded
+// from addonsDir in file name order. Each add-on has a detached minisign
+// signature (<name>.minisig), by a key listed in the configuration, and
+// cmdline add-ons may only set the keys allowed by the configuration.
+const (
+	addonsDir      = "\\EFI\\LINUX\\addons"
+	addonCmdline   = ".cmdline"
+	addonInitrd    = ".cpio"
+	addonSignature = ".minisig"
+)
+
+// addonSet holds the verified add-ons.
+type addonSet struct {
+	cmdline []string
+	initrd  [][]byte
+}
+
+// addons holds the add-ons applied to the started kernel.
+var addons = &addonSet{}
+
+// checkCmdline verifies that a cmdline fragment only sets allowed keys.
+func checkCmdline(cmdline string, allowed []string) error {
+	if strings.ContainsAny(cmdline, "\"'") {
+		return errors.New("quoted arguments are not allowed")
+	}
+
+	for _, arg := range strings.Fields(cmdline) {
+		key, _, _ := strings.Cut(arg, "=")
+
+		if key == "initrd" || !slices.Contains(allowed, key) {
+			return fmt.Errorf("cmdline key %s is not allowed", key)
+		}
+	}
+
+	return nil
+}
+
+// loadAddons loads and verifies the add-ons, invalid or untrusted add-ons
+// are skipped.
+func loadAddons(cfg *stubcfg.Config) (set *addonSet, err error) {
+	var keys []*minisign.PublicKey
+	set = &addonSet{}
+
+	for _, s := range cfg.All(stubcfg.AddonKey) {
+		pk, err := minisign.ParsePublicKey(s)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid add-on key, %v", err)
+		}
+
+		keys = append(keys, pk)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	allowed := cfg.List(stubcfg.AddonCmdline)
+
+	root, err := x64.UEFI.Root()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open root volume, %v", err)
+	}
+
+	files, err := root.ReadDir(addonsDir)
+
+	if err != nil {
+		// no add-ons
+		return set, nil
+	}
+
+	var names []string
+
+	for _, f := range files {
+		if !f.IsDir() && !strings.HasSuffix(strings.ToLower(f.Name()), addonSignature) {
+			names = append(names, f.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := addonsDir + "\\" + name
+		ext := strings.ToLower(path.Ext(name))
+
+		if ext != addonCmdline && ext != addonInitrd {
+			log.Printf("ignoring add-on %s, unknown type", name)
+			continue
+		}
+
+		data, err := fs.ReadFile(root, file)
+
+		if err != nil {
+			log.Printf("ignoring add-on %s, %v", name, err)
+			continue
+		}
+
+		sig, err := fs.ReadFile(root, file+addonSignature)
+
+		if err != nil {
+			log.Printf("ignoring add-on %s, missing signature", name)
+			continue
+		}
+
+		if err = minisign.VerifyAny(keys, data, sig); err != nil {
+			log.Printf("ignoring add-on %s, %v", name, err)
+			continue
+		}
+
+		switch ext {
+		case addonCmdline:
+			cmdline := strings.Join(strings.Fields(string(data)), " ")
+
+			if err = checkCmdline(cmdline, allowed); err != nil {
+				log.Printf("ignoring add-on %s, %v", name, err)
+				continue
+			}
+
+			set.cmdline = append(set.cmdline, cmdline)
+		case addonInitrd:
+			set.initrd = append(set.initrd, data)
+		}
+
+		recordFile(bootreport.RoleAddon, file, data, true)
+		log.Printf("loaded add-on %s", name)
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/bls"
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// efiPath converts a Boot Loader Specification path, relative to the ESP
+// root and using slashes, to an EFI path.
+func efiPath(p string) string {
+	return "\\" + strings.TrimLeft(strings.ReplaceAll(p, "/", "\\"), "\\")
+}
+
+// readEntries parses all entries found in the argument ESP directory,
+// invalid entries are skipped.
+func readEntries(dir string) (entries []*bls.Entry, err error) {
+	root, err := x64.UEFI.Root()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open root volume, %v", err)
+	}
+
+	dir = efiPath(dir)
+	files, err := root.ReadDir(dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s, %v", dir, err)
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(strings.ToLower(f.Name()), bls.Suffix) {
+			continue
+		}
+
+		buf, err := fs.ReadFile(root, dir+"\\"+f.Name())
+
+		if err != nil {
+			log.Printf("could not read entry %s, %v", f.Name(), err)
+			continue
+		}
+
+		e, err := bls.Parse(f.Name(), buf)
+
+		if err != nil {
+			log.Printf("invalid entry %s, %v", f.Name(), err)
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	bls.Sort(entries)
+
+	return
+}
+
+// defaultEntry returns the pattern of the entry to boot: LoaderEntryOneShot,
+// which is consumed, LoaderEntryDefault or the configuration default.
+func defaultEntry(store efivar.Store, cfg *stubcfg.Config) string {
+	if buf, _, err := store.Get(efivar.LoaderEntryOneShot, efivar.LoaderVendor); err == nil {
+		if err = store.Set(efivar.LoaderEntryOneShot, efivar.LoaderVendor, 0, nil); err != nil {
+			log.Printf("could not clear %s, %v", efivar.LoaderEntryOneShot, err)
+		}
+
+		return efivar.DecodeString(buf)
+	}
+
+	if buf, _, err := store.Get(efivar.LoaderEntryDefault, efivar.LoaderVendor); err == nil {
+		return efivar.DecodeString(buf)
+	}
+
+	return cfg.Get(stubcfg.Default)
+}
+
+// bootEntry boots the selected Boot Loader Specification entry found in the
+// argument ESP directory. With a signed configuration the kernel and initrd
+// files must be trusted and the entry options are replaced by the
+// configuration cmdline.
+func bootEntry(cfg *stubcfg.Config, dir string) error {
+	entries, err := readEntries(dir)
+
+	if err != nil {
+		return err
+	}
+
+	store := x64.UEFI.Runtime.Variables()
+	e := bls.Select(entries, defaultEntry(store, cfg))
+
+	if e == nil {
+		return errors.New("no boot entries")
+	}
+
+	log.Printf("booting entry %s (%s)", e.ID, e.Name())
+
+	beginAttempt(bootreport.ModeEntry, e.ID)
+
+	if err = store.Set(efivar.LoaderEntrySelected, efivar.LoaderVendor, efivar.LoaderAttributes, efivar.EncodeString(e.ID)); err != nil {
+		log.Printf("could not set %s, %v", efivar.LoaderEntrySelected, err)
+	}
+
+	kernel, err := loadFile(efiPath(e.Linux))
+
+	if err != nil {
+		return err
+	}
+
+	defer kernel.Free()
+
+	if cfg.Signed {
+		if err = cfg.VerifySum(kernel.Name, kernel.SHA256); err != nil {
+			return err
+		}
+	}
+
+	recordLoaded(bootreport.RoleKernel, kernel, cfg.Signed)
+
+	// the verified pages are booted, rather than initrd= arguments which
+	// the kernel would read again from the ESP
+	var initrds []*ueficore.LoadedFile
+
+	for _, initrd := range e.Initrd {
+		f, err := loadFile(efiPath(initrd))
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Free()
+
+		if cfg.Signed {
+			if err = cfg.VerifySum(f.Name, f.SHA256); err != nil {
+				return err
+			}
+		}
+
+		recordLoaded(bootreport.RoleInitrd, f, cfg.Signed)
+		initrds = append(initrds, f)
+	}
+
+	cmdline := e.Options
+
+	if cfg.Signed {
+		if len(e.Options) > 0 {
+			log.Printf("ignoring entry options, using signed cmdline")
+		}
+
+		cmdline = cfg.Cmdline
+	}
+
+	_, err = executeKernel(cfg, kernel.Name, kernel.Data, cmdline, initrds...)
+
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// Console devices, see stubcfg.Console.
+const (
+	consoleConOut = "conout"
+	consoleGOP    = "gop"
+	consoleUART   = "uart"
+	consoleSerial = "serial"
+)
+
+// serialTimeout is the receive timeout of EFI serial ports, short as the
+// shell polls for input.
+const serialTimeout = 100 * time.Microsecond
+
+// setupConsole selects the consoles mirroring output and merging input, as
+// set in the configuration. The UEFI text console is kept when no device is
+// usable.
+func setupConsole(cfg *stubcfg.Config) {
+	var baudRate int
+	var err error
+
+	devices := cfg.List(stubcfg.Console)
+
+	if len(devices) == 0 {
+		return
+	}
+
+	if val := cfg.Get(stubcfg.BaudRate); len(val) > 0 {
+		if baudRate, err = strconv.Atoi(val); err != nil || baudRate <= 0 {
+			log.Printf("invalid baud rate %s", val)
+			baudRate = 0
+		}
+	}
+
+	console := x64.Mux.Console
+	display := x64.Mux.Display
+	x64.Mux.Console = nil
+	x64.Mux.Display = nil
+
+	for _, dev := range devices {
+		switch dev {
+		case consoleConOut:
+			x64.Mux.Console = console
+		case consoleGOP:
+			// ConIn is kept for input
+			x64.Mux.Console = console
+
+			if display != nil {
+				x64.Mux.Display = display
+				continue
+			}
+
+			gop, err := x64.UEFI.Boot.GetGraphicsOutput()
+
+			if err != nil {
+				log.Printf("could not locate graphics output, %v", err)
+				continue
+			}
+
+			fb, err := gop.NewConsole()
+
+			if err != nil {
+				log.Printf("could not start framebuffer console, %v", err)
+				continue
+			}
+
+			x64.Mux.Display = fb
+		case consoleUART:
+			if baudRate > 0 {
+				if err = x64.SetBaudRate(baudRate); err != nil {
+					log.Printf("could not set UART baud rate, %v", err)
+				}
+			}
+
+			x64.Mux.Terminals = append(x64.Mux.Terminals, x64.UART0)
+		case consoleSerial:
+			ports, err := x64.UEFI.Boot.SerialPorts()
+
+			if err != nil {
+				log.Printf("could not locate serial ports, %v", err)
+				continue
+			}
+
+			for _, p := range ports {
+				if err = p.SetAttributes(uint64(baudRate), serialTimeout); err != nil {
+					log.Printf("could not configure serial port %#x, %v", p.Handle, err)
+					continue
+				}
+
+				x64.Mux.Terminals = append(x64.Mux.Terminals, p)
+			}
+		default:
+			log.Printf("unknown console %s", dev)
+		}
+	}
+
+	if x64.Mux.Console == nil && len(x64.Mux.Terminals) == 0 {
+		x64.Mux.Console = console
+		x64.Mux.Display = display
+		log.Printf("no console available, keeping defaults")
+	}
+}
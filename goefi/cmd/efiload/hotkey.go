@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/recovery"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// defaultHotkey is used when the configuration sets no hotkey.
+const defaultHotkey = "esc"
+
+// terminalPoll is the interval at which serial terminals, which have no
+// keystroke event, are read while waiting for the hotkey.
+const terminalPoll = 10 * time.Millisecond
+
+// hotkeyMatch returns whether a keystroke matches the hotkey.
+func hotkeyMatch(key string, k *ueficore.InputKey) bool {
+	if key == defaultHotkey {
+		return k.ScanCode == ueficore.SCAN_ESC
+	}
+
+	c := rune(binary.LittleEndian.Uint16(k.UnicodeChar[:]))
+
+	return k.ScanCode == 0 && strings.EqualFold(string(c), key)
+}
+
+// termHotkeyMatch returns whether terminal input holds the hotkey, escape
+// sequences (e.g. arrow keys) are skipped.
+func termHotkeyMatch(key string, p []byte) bool {
+	for i := 0; i < len(p); {
+		if p[i] == 0x1b && i+1 < len(p) && (p[i+1] == '[' || p[i+1] == 'O') {
+			// skip up to the sequence final byte
+			for i += 2; i < len(p) && (p[i] < 0x40 || p[i] > 0x7e); i++ {
+			}
+
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(p[i:])
+		i += size
+
+		if key == defaultHotkey && r == 0x1b || key != defaultHotkey && strings.EqualFold(string(r), key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitHotkey waits for the hotkey until the timeout expires, halting the CPU
+// on the firmware timer and keystroke events. Serial terminals (see
+// setupConsole) are read on a periodic timer. Other keys are discarded.
+func waitHotkey(key string, timeout time.Duration) (pressed bool, err error) {
+	keyEvent, err := x64.UEFI.Console.WaitForKey()
+
+	if err != nil && len(x64.Mux.Terminals) == 0 {
+		return
+	}
+
+	timer, err := x64.UEFI.Boot.CreateEvent(ueficore.EVT_TIMER, 0)
+
+	if err != nil {
+		return
+	}
+
+	defer x64.UEFI.Boot.CloseEvent(timer)
+
+	if err = x64.UEFI.Boot.SetTimer(timer, ueficore.TimerRelative, timeout); err != nil {
+		return
+	}
+
+	events := []uint64{timer}
+
+	if keyEvent != 0 {
+		events = append(events, keyEvent)
+	}
+
+	if len(x64.Mux.Terminals) > 0 {
+		poll, err := x64.UEFI.Boot.CreateEvent(ueficore.EVT_TIMER, 0)
+
+		if err != nil {
+			return false, err
+		}
+
+		defer x64.UEFI.Boot.CloseEvent(poll)
+
+		if err = x64.UEFI.Boot.SetTimer(poll, ueficore.TimerPeriodic, terminalPoll); err != nil {
+			return false, err
+		}
+
+		events = append(events, poll)
+	}
+
+	buf := make([]byte, 64)
+
+	for {
+		i, err := x64.UEFI.Boot.WaitForEvent(events...)
+
+		if err != nil || i == 0 {
+			return false, err
+		}
+
+		if events[i] == keyEvent {
+			k := &ueficore.InputKey{}
+
+			if x64.UEFI.Console.Input(k) == ueficore.EFI_SUCCESS && hotkeyMatch(key, k) {
+				return true, nil
+			}
+
+			continue
+		}
+
+		for _, t := range x64.Mux.Terminals {
+			if n, _ := t.Read(buf); n > 0 && termHotkeyMatch(key, buf[:n]) {
+				return true, nil
+			}
+		}
+	}
+}
+
+// recoveryPrompt prints a one-line status and waits for the hotkey, which
+// starts the recovery shell. The boot continues when the shell is left.
+//
+// With Secure Boot enforced the hotkey is ignored, unless the configuration
+// allows it, in which case the system is reset when the shell is left: its
+// commands can alter memory and start images, the embedded kernel and
+// configuration can no longer be trusted.
+func recoveryPrompt(cfg *stubcfg.Config) {
+	val := cfg.Get(stubcfg.Timeout)
+
+	if len(val) == 0 {
+		return
+	}
+
+	ms, err := strconv.Atoi(val)
+
+	if err != nil || ms < 0 {
+		log.Printf("invalid timeout %s", val)
+		return
+	}
+
+	if ms == 0 {
+		return
+	}
+
+	key := cfg.Get(stubcfg.Hotkey)
+
+	if len(key) == 0 {
+		key = defaultHotkey
+	}
+
+	if key != defaultHotkey && utf8.RuneCountInString(key) != 1 {
+		log.Printf("invalid hotkey %s", key)
+		return
+	}
+
+	secureBoot := efivar.SecureBootEnabled(x64.UEFI.Runtime.Variables())
+
+	if secureBoot && cfg.Get(stubcfg.HotkeySecureBoot) != "1" {
+		log.Printf("ignoring hotkey, Secure Boot is enforced")
+		return
+	}
+
+	fmt.Printf("%s: booting in %d ms, press %s for the recovery shell\n", stubInfo, ms, key)
+
+	pressed, err := waitHotkey(key, time.Duration(ms)*time.Millisecond)
+
+	if err != nil {
+		log.Printf("could not wait for hotkey, %v", err)
+		return
+	}
+
+	if !pressed {
+		return
+	}
+
+	if !secureBoot {
+		recovery.Start(stubInfo + " recovery shell, type `exit` to boot")
+		fmt.Println("resuming boot")
+		return
+	}
+
+	recovery.Start(stubInfo + " recovery shell, type `exit` to reset")
+	fmt.Println("resetting, boot cannot resume under Secure Boot")
+
+	if err := x64.UEFI.Runtime.ResetSystem(ueficore.EfiResetWarm); err != nil {
+		fmt.Printf("could not reset, %v\n", err)
+	}
+
+	os.Exit(1)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/cpio"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// overlayDir holds the files generated by the stub, in the initrd.
+const overlayDir = "/run/uki-stub"
+
+var (
+	// microcode holds the early microcode archives.
+	microcode [][]byte
+	// overlay holds the files generated by the stub.
+	overlay []cpio.File
+)
+
+// addOverlay adds a generated file to the initrd, under overlayDir,
+// replacing any previous file with the same name.
+func addOverlay(name string, data []byte) {
+	f := cpio.File{
+		Name: path.Join(overlayDir, name),
+		Mode: 0o444,
+		Data: data,
+	}
+
+	for i := range overlay {
+		if overlay[i].Name == f.Name {
+			overlay[i] = f
+			return
+		}
+	}
+
+	overlay = append(overlay, f)
+}
+
+// loadMicrocode loads the early microcode archives of the configuration,
+// which must be trusted when the configuration is signed.
+func loadMicrocode(cfg *stubcfg.Config) error {
+	for _, p := range cfg.All(stubcfg.Microcode) {
+		// the pages are kept until boot
+		f, err := loadFile(efiPath(p))
+
+		if err != nil {
+			return err
+		}
+
+		if cfg.Signed {
+			if err = cfg.VerifySum(f.Name, f.SHA256); err != nil {
+				f.Free()
+				return err
+			}
+		}
+
+		// the kernel only looks for microcode in an uncompressed
+		// archive at the start of the initrd
+		if !cpio.IsNewc(f.Data) {
+			f.Free()
+			return fmt.Errorf("%s is not an uncompressed cpio archive", f.Name)
+		}
+
+		recordLoaded(bootreport.RoleMicrocode, f, cfg.Signed)
+		microcode = append(microcode, f.Data)
+	}
+
+	return nil
+}
+
+// initrdArgs loads the files of the initrd= cmdline arguments, which are
+// removed from the returned cmdline, so that they can be served with other
+// initrds from memory, rather than loaded by the kernel. The files must be
+// trusted when the configuration is signed.
+func initrdArgs(cfg *stubcfg.Config, cmdline string) (rest string, files []*ueficore.LoadedFile, err error) {
+	var args []string
+
+	for _, arg := range strings.Fields(cmdline) {
+		path, found := strings.CutPrefix(arg, "initrd=")
+
+		if !found {
+			args = append(args, arg)
+			continue
+		}
+
+		f, err := loadFile(efiPath(path))
+
+		if err == nil && cfg.Signed {
+			if err = cfg.VerifySum(f.Name, f.SHA256); err != nil {
+				f.Free()
+			}
+		}
+
+		if err != nil {
+			for _, f := range files {
+				f.Free()
+			}
+
+			return "", nil, err
+		}
+
+		files = append(files, f)
+
+		recordLoaded(bootreport.RoleInitrd, f, cfg.Signed)
+	}
+
+	return strings.Join(args, " "), files, nil
+}
+
+// piece is a part of the initrd, file is set when its pages can be freed
+// once copied.
+type piece struct {
+	data []byte
+	file *ueficore.LoadedFile
+}
+
+// concat joins initrd archives into EFI pages, each padded to 4 bytes as
+// required by the kernel cpio unpacker, which skips the padding between
+// archives. Files are freed as soon as they are copied, so that their pages
+// are available to the kernel.
+func concat(pieces []piece) (pages *ueficore.Pages, buf []byte, err error) {
+	var size int
+
+	for _, p := range pieces {
+		size += (len(p.data) + 3) &^ 3
+	}
+
+	if size == 0 {
+		return nil, nil, errors.New("empty initrd")
+	}
+
+	if pages, err = x64.UEFI.Boot.NewPages(ueficore.EfiLoaderData, size); err != nil {
+		return nil, nil, fmt.Errorf("could not allocate initrd, %v", err)
+	}
+
+	buf = pages.Bytes()[:size]
+	off := 0
+
+	for _, p := range pieces {
+		n := copy(buf[off:], p.data)
+		end := off + ((n + 3) &^ 3)
+		// pages are not zeroed
+		clear(buf[off+n : end])
+		off = end
+
+		if p.file != nil {
+			p.file.Free()
+		}
+	}
+
+	return
+}
+
+// assembleInitrd returns the initrd served from memory, in order: early
+// microcode, the argument files (initrd= files of the cmdline and entry or
+// UKI initrds), the add-on archives and the stub generated overlay.
+//
+// A single archive is served without copying, otherwise the argument files
+// are freed once copied and the returned pages must be freed once the kernel
+// returns. No initrd is returned when there is none.
+func assembleInitrd(files []*ueficore.LoadedFile) (*ueficore.Pages, []byte, error) {
+	var pieces []piece
+
+	for _, buf := range microcode {
+		pieces = append(pieces, piece{data: buf})
+	}
+
+	for _, f := range files {
+		pieces = append(pieces, piece{data: f.Data, file: f})
+	}
+
+	for _, buf := range addons.initrd {
+		pieces = append(pieces, piece{data: buf})
+	}
+
+	if len(overlay) > 0 {
+		buf, err := cpio.Archive(overlay)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create overlay, %v", err)
+		}
+
+		pieces = append(pieces, piece{data: buf})
+	}
+
+	switch {
+	case len(pieces) == 0:
+		return nil, nil, nil
+	case len(pieces) == 1 && len(pieces[0].data)%4 == 0:
+		// no padding required, the caller keeps the pages until boot
+		return nil, pieces[0].data, nil
+	}
+
+	return concat(pieces)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/stubopt"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// debugCmdline holds the cmdline arguments enabled by debug=1.
+var debugCmdline []string
+
+// loadOptions applies the stub LoadOptions honored by the configuration
+// policy, all others are logged and ignored. It returns whether recovery has
+// been requested.
+func loadOptions(cfg *stubcfg.Config) (recovery bool) {
+	buf, err := x64.UEFI.LoadOptions()
+
+	if err != nil {
+		log.Printf("could not read LoadOptions, %v", err)
+		return
+	}
+
+	if len(buf) == 0 {
+		return
+	}
+
+	s, err := stubopt.Decode(buf)
+
+	if err != nil {
+		log.Printf("ignoring LoadOptions, %v", err)
+		return
+	}
+
+	opts, err := stubopt.Parse(s)
+
+	if err != nil {
+		log.Printf("ignoring LoadOptions %q, %v", s, err)
+		return
+	}
+
+	policy := &stubopt.Policy{
+		SecureBoot: efivar.SecureBootEnabled(x64.UEFI.Runtime.Variables()),
+		Allowed:    cfg.List(stubcfg.LoadOptions),
+	}
+
+	honored, ignored := policy.Apply(opts)
+
+	for _, o := range ignored {
+		log.Printf("ignoring LoadOptions %s, %s", o.Option, o.Reason)
+	}
+
+	for _, o := range honored {
+		log.Printf("LoadOptions %s", o)
+
+		switch o.Key {
+		case stubopt.Slot:
+			slot = o.Value
+		case stubopt.Debug:
+			if o.Value == "1" {
+				debugCmdline = []string{"debug"}
+			}
+		case stubopt.Recovery:
+			recovery = true
+		}
+	}
+
+	return
+}
+
+// bootRecovery starts the recovery image, which must be trusted with a
+// signed configuration.
+func bootRecovery(cfg *stubcfg.Config) error {
+	path := cfg.Get(stubcfg.Recovery)
+
+	if len(path) == 0 {
+		return errors.New("no recovery image")
+	}
+
+	f, err := loadFile(efiPath(path))
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Free()
+
+	if cfg.Signed {
+		if err = cfg.VerifySum(f.Name, f.SHA256); err != nil {
+			return err
+		}
+	}
+
+	root, err := x64.UEFI.Root()
+
+	if err != nil {
+		return fmt.Errorf("could not open root volume, %v", err)
+	}
+
+	h, err := x64.UEFI.Boot.LoadImageMem(0, root, f.Name, f.Data)
+
+	if err != nil {
+		return fmt.Errorf("could not load image, %v", err)
+	}
+
+	log.Printf("starting recovery image %s", f.Name)
+
+	return x64.UEFI.Boot.StartImage(h)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/bmp"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// pngMagic is the signature of PNG files.
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// decodeImage decodes a BMP or PNG image.
+func decodeImage(buf []byte) (image.Image, error) {
+	switch {
+	case bytes.HasPrefix(buf, []byte(pngMagic)):
+		return png.Decode(bytes.NewReader(buf))
+	case bytes.HasPrefix(buf, []byte(bmp.Magic)):
+		return bmp.Decode(bytes.NewReader(buf))
+	}
+
+	return nil, errors.New("unsupported image format")
+}
+
+// setGraphicsMode sets the configured resolution, given as <width>x<height>.
+// The framebuffer console is restarted on the new mode.
+func setGraphicsMode(gop *ueficore.GraphicsOutput, val string) error {
+	w, h, found := strings.Cut(val, "x")
+
+	if !found {
+		return fmt.Errorf("invalid graphics mode %s", val)
+	}
+
+	width, err := strconv.Atoi(w)
+
+	if err != nil {
+		return fmt.Errorf("invalid graphics mode %s", val)
+	}
+
+	height, err := strconv.Atoi(h)
+
+	if err != nil {
+		return fmt.Errorf("invalid graphics mode %s", val)
+	}
+
+	mode, err := gop.FindMode(width, height)
+
+	if err != nil {
+		return err
+	}
+
+	if err = gop.SetMode(mode); err != nil {
+		return err
+	}
+
+	if x64.Mux.Display == nil {
+		return nil
+	}
+
+	fb, err := gop.NewConsole()
+
+	if err != nil {
+		return fmt.Errorf("could not restart framebuffer console, %v", err)
+	}
+
+	x64.Mux.Display = fb
+
+	return nil
+}
+
+// showLogo sets the configured graphics mode and draws the logo, which must
+// be trusted when the configuration is signed so that it cannot be replaced
+// on the ESP.
+func showLogo(cfg *stubcfg.Config) {
+	mode := cfg.Get(stubcfg.GraphicsMode)
+	path := cfg.Get(stubcfg.Logo)
+
+	if len(mode) == 0 && len(path) == 0 {
+		return
+	}
+
+	gop, err := x64.UEFI.Boot.GetGraphicsOutput()
+
+	if err != nil {
+		log.Printf("could not locate graphics output, %v", err)
+		return
+	}
+
+	if len(mode) > 0 {
+		if err = setGraphicsMode(gop, mode); err != nil {
+			log.Printf("could not set graphics mode, %v", err)
+		}
+	}
+
+	if len(path) == 0 {
+		return
+	}
+
+	f, err := loadFile(efiPath(path))
+
+	if err != nil {
+		log.Printf("could not load logo, %v", err)
+		return
+	}
+
+	defer f.Free()
+
+	if cfg.Signed {
+		if err = cfg.VerifySum(f.Name, f.SHA256); err != nil {
+			log.Printf("ignoring logo, %v", err)
+			return
+		}
+	}
+
+	img, err := decodeImage(f.Data)
+
+	if err != nil {
+		log.Printf("could not decode logo, %v", err)
+		return
+	}
+
+	if err = gop.DrawImage(img); err != nil {
+		log.Printf("could not draw logo, %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/costinm/uki-stub/pkg/smbios"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+var (
+	// machineCmdline holds the cmdline arguments of the per-machine
+	// sections matching the running machine.
+	machineCmdline []string
+	// machine caches the SMBIOS identification.
+	machine *smbios.System
+)
+
+// machineID returns the SMBIOS identification of the running machine.
+func machineID() (*smbios.System, error) {
+	if machine != nil {
+		return machine, nil
+	}
+
+	ep, table, err := x64.UEFI.SMBIOS()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read SMBIOS, %v", err)
+	}
+
+	machine = smbios.ParseSystem(ep, table)
+
+	return machine, nil
+}
+
+// loadMachine applies the per-machine configuration sections matching the
+// SMBIOS identification of the running machine.
+func loadMachine(cfg *stubcfg.Config) {
+	if len(cfg.Sections) == 0 {
+		return
+	}
+
+	sys, err := machineID()
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	log.Printf("machine %s %s, serial %s, uuid %s, board %s", sys.Manufacturer, sys.Product, sys.Serial, sys.UUID, sys.BoardProduct)
+
+	id := map[string]string{
+		stubcfg.MatchUUID:    sys.UUID,
+		stubcfg.MatchSerial:  sys.Serial,
+		stubcfg.MatchProduct: sys.BoardProduct,
+	}
+
+	for _, s := range cfg.Match(id) {
+		log.Printf("using machine section %s", s.Name())
+
+		machineCmdline = append(machineCmdline, s.All(stubcfg.Cmdline)...)
+		report.Machine = append(report.Machine, s.Name())
+	}
+}
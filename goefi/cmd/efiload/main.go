@@ -1,25 +1,25 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"strconv"
-	"unicode/utf16"
+	"slices"
+	"strings"
 	"unsafe"
 
 	//ueficore "github.com/usbarmory/go-boot/uefi"
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
 	"github.com/costinm/uki-stub/pkg/uefi"
 	ueficore "github.com/costinm/uki-stub/pkg/ueficore"
-	"github.com/usbarmory/go-boot/uefi/x64"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
 )
 
 var EnvVendor = uefi.EFI_GUID{
-	0xaabc54d8, 0x7b8e, 0x5680,
-	[...]byte{0x9f, 0x6c, 0x68, 0xda, 0x0d, 0xbb, 0xcd, 0xbf}}
+	Data1: 0xaabc54d8, Data2: 0x7b8e, Data3: 0x5680,
+	Data4: [...]byte{0x9f, 0x6c, 0x68, 0xda, 0x0d, 0xbb, 0xcd, 0xbf}}
 
 func getkey(key []uefi.CHAR16, vendor *uefi.EFI_GUID) (value []byte, found bool) {
 	var (
@@ -105,8 +105,13 @@ func vars() {
 }
 
 func main() {
-	ah, sh := x64.UEFI.Handles()
-	uefi.Init(uintptr(ah), uintptr(sh))
+	uefi.Init(uintptr(x64.UEFI.ImageHandle()), uintptr(x64.UEFI.Address()))
+
+	if idle := x64.Idle; idle != nil {
+		uefi.Park = func(event uefi.EFI_EVENT) {
+			idle.Park(uint64(event))
+		}
+	}
 	vars()
 
 	kernelPath := "\\EFI\\linux\\kernel.efi"
@@ -115,21 +120,66 @@ func main() {
 	kerOff := 0x30000000
 	cfgOff := 0x20000000
 
-	cfg := []byte(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(cfgOff))), 10240))
-	parts := bytes.SplitN(cfg, []byte{'\n'}, 3)
-	fmt.Println("Config: len: ", string(parts[0]), "CMD", string(parts[1]))
+	cfgBuf := unsafe.Slice((*byte)(unsafe.Pointer(uintptr(cfgOff))), 10240)
+	cfg, err := stubcfg.Parse(cfgBuf)
+	if err != nil {
+		fmt.Printf("Invalid config: %v\n", err)
+		os.Exit(1)
+	}
+	setupConsole(cfg)
+	showLogo(cfg)
+	initReport(cfg, cfgBuf)
+	fmt.Println("Config: len: ", cfg.KernelSize, "CMD", cfg.Cmdline)
+
+	slot = cfg.Get(stubcfg.Slot)
+
+	if loadOptions(cfg) {
+		if err = bootRecovery(cfg); err != nil {
+			fmt.Printf("Error booting recovery: %v\n", err)
+		}
+	}
+
+	recoveryPrompt(cfg)
+
+	loadMachine(cfg)
+
+	if err = loadMicrocode(cfg); err != nil {
+		fmt.Printf("Error loading microcode: %v\n", err)
+	}
+
+	if set, err := loadAddons(cfg); err != nil {
+		fmt.Printf("Error loading add-ons: %v\n", err)
+	} else {
+		addons = set
+	}
+
+	// Boot Loader Specification entries and UKIs take precedence over the
+	// embedded kernel, which remains the fallback.
+	if dir := cfg.Get(stubcfg.Entries); len(dir) > 0 {
+		if err := bootEntry(cfg, dir); err != nil {
+			fmt.Printf("Error booting entry: %v\n", err)
+		}
+	}
+
+	if path := cfg.Get(stubcfg.UKI); len(path) > 0 {
+		if err := bootUKI(cfg, path); err != nil {
+			fmt.Printf("Error booting UKI: %v\n", err)
+		}
+	}
 
-	kerLen, _ := strconv.Atoi(string(parts[0]))
 	// Kernel length is included in the image - but for now get it from config.
-	kerData := []byte(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(kerOff))), kerLen))
-	fmt.Println("Kernel length: ", kerLen, kerData[0:16])
+	kerData := []byte(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(kerOff))), cfg.KernelSize))
+	fmt.Println("Kernel length: ", cfg.KernelSize, kerData[0:16])
+	// the embedded kernel is covered by the stub signature
+	beginAttempt(bootreport.ModeEmbedded, "")
+	recordFile(bootreport.RoleKernel, kernelPath, kerData, report.SecureBoot)
 
-	if _, err := executeKernel(kernelPath,
+	if _, err := executeKernel(cfg, kernelPath,
 		//"test=example initos_sidecar=/dev/sdb"); err != nil {
 		// initrd=\\initrd.img
 		//
 		kerData,
-		string(parts[1])); err != nil {
+		cfg.Cmdline); err != nil {
 		fmt.Printf("Error executing kernel: %v\n", err)
 		os.Exit(1)
 	}
@@ -142,53 +192,75 @@ func main() {
 
 }
 
-func stringToUTF16Ptr(s string) *uint16 {
-	utf16Slice := utf16.Encode([]rune(s))
-	utf16Slice = append(utf16Slice, 0) // null terminate
-	return &utf16Slice[0]
-}
-
-func loadAndVerify(path string) ([]byte, error) {
-	// TODO: load sig, config, initrd - and verify each sha using the pub key
+// loadFile reads a file of the root volume into EFI pages, its SHA256 digest
+// is computed while reading and must be used for verification. The pages
+// must be released with Free unless the data is kept until boot.
+func loadFile(path string) (*ueficore.LoadedFile, error) {
 	root, err := x64.UEFI.Root()
 	if err != nil {
 		return nil, fmt.Errorf("could not open root volume, %v", err)
 	}
 
-	// TODO: load sig, config, initrd - and verify each sha using the pub key
-
-	bf, err := root.Open(path)
+	f, err := x64.UEFI.Boot.ReadFile(root, path)
 	if err != nil {
-		fmt.Printf("Error opening %s: %v\n", path, err)
-		return nil, fmt.Errorf("could not open kernel, %v", err)
-	}
-	fmt.Printf("Opened file %v\n", bf)
-	data, err := io.ReadAll(bf)
-	if err != nil {
-		fmt.Printf("Error reading %s: %v\n", path, err)
-		//os.Exit(1)
-	} else {
-		fmt.Println("Loaded file", len(data))
-		hash := sha256.Sum256(data)
-		fmt.Printf("SHA256 of %s (%d bytes): %x\n", path, len(data), hash)
+		return nil, fmt.Errorf("could not load %s, %v", path, err)
 	}
 
-	return data, nil
+	fmt.Printf("SHA256 of %s (%d bytes, %v): %x\n", path, len(f.Data), f.Elapsed, f.SHA256)
+
+	return f, nil
 }
 
-func executeKernel(path string, data []byte, cmdline string) (string, error) {
+// executeKernel starts the kernel, with the per-machine configuration,
+// add-ons and LoadOptions applied and cmdline placeholders resolved. The initrd is
+// assembled in memory, see assembleInitrd, the argument initrds can be freed
+// before the kernel starts.
+func executeKernel(cfg *stubcfg.Config, path string, data []byte, cmdline string, initrds ...*ueficore.LoadedFile) (string, error) {
 	root, err := x64.UEFI.Root()
 	if err != nil {
 		return "", fmt.Errorf("could not open root volume, %v", err)
 	}
+
+	if extra := slices.Concat(machineCmdline, addons.cmdline, debugCmdline); len(extra) > 0 {
+		cmdline = strings.Join(append([]string{cmdline}, extra...), " ")
+	}
+
+	if cmdline, err = expandCmdline(cmdline); err != nil {
+		return "", err
+	}
+
+	cmdline, files, err := initrdArgs(cfg, cmdline)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		defer f.Free()
+	}
+
+	// the report lists the initrd= files and is part of the overlay
+	publishReport(cmdline)
+
+	pages, buf, err := assembleInitrd(append(files, initrds...))
+	if err != nil {
+		return "", err
+	}
+	defer pages.Free()
+
+	if len(buf) > 0 {
+		initrd, err := x64.UEFI.Boot.InstallInitrd(buf)
+		if err != nil {
+			return "", fmt.Errorf("could not install initrd, %v", err)
+		}
+		defer initrd.Uninstall()
+	}
+
 	if data == nil {
-		data, err = loadAndVerify(path)
+		f, err := loadFile(path)
 		if err != nil {
 			return "", err
 		}
-		if data == nil {
-			return "", fmt.Errorf("could not load kernel")
-		}
+		defer f.Free()
+		data = f.Data
 	}
 
 	// Use LoadedImage with the already loaded kernel - to not double
@@ -205,17 +277,14 @@ func executeKernel(path string, data []byte, cmdline string) (string, error) {
 	// Note that a sha256 of the image base is NOT the same with the SHA of
 	// the bytes loaded from disk - so we can't go the other way
 
-	// Use LoadedImage protocol to get set the command line
-	_, rawMemoryAddress, err := x64.UEFI.Boot.LoadImageHandle(h)
-	ptr := stringToUTF16Ptr(cmdline)
-
+	// Use LoadedImage protocol to set the command line
+	if err = x64.UEFI.Boot.SetLoadOptions(h, cmdline); err != nil {
+		return "", fmt.Errorf("could not set cmdline, %v", err)
+	}
 
-	addr := uintptr(rawMemoryAddress)
-	// Convert the uintptr to a *uint32 pointer
-	cmdlineLenPtr := (*uint32)(unsafe.Pointer(addr + 48))
-	*cmdlineLenPtr = uint32(len(cmdline) * 2)
-	cmdlinePtr := (*uint64)(unsafe.Pointer(addr + 56))
-	*cmdlinePtr = ueficore.Ptrval(ptr)
+	if err = x64.PublishLoaderInfo(stubInfo, efivar.StubFeatureReportBootPartition); err != nil {
+		log.Printf("could not publish loader variables, %v", err)
+	}
 
 	log.Printf("starting EFI image %#x", h)
 	return "", x64.UEFI.Boot.StartImage(h)
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/placeholder"
+	"github.com/costinm/uki-stub/pkg/smbios"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// slot is the selected boot slot.
+var slot string
+
+// partUUID resolves a GPT partition, by label, to its unique partition GUID.
+func partUUID(arg string) (string, error) {
+	var match []string
+
+	label, found := strings.CutPrefix(arg, "label=")
+
+	if !found || len(label) == 0 {
+		return "", fmt.Errorf("unsupported match %q", arg)
+	}
+
+	partitions, err := x64.UEFI.Partitions()
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range partitions {
+		if p.Name == label {
+			match = append(match, p.PartUUID)
+		}
+	}
+
+	switch len(match) {
+	case 0:
+		return "", fmt.Errorf("partition %s not found", label)
+	case 1:
+		return match[0], nil
+	}
+
+	return "", fmt.Errorf("partition %s is ambiguous", label)
+}
+
+// espPartUUID resolves the unique partition GUID of the ESP.
+func espPartUUID(arg string) (string, error) {
+	if len(arg) > 0 {
+		return "", fmt.Errorf("unexpected argument %s", arg)
+	}
+
+	info, err := x64.UEFI.LoaderInfo()
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(info.DevicePartUUID) == 0 {
+		return "", errors.New("ESP is not a GPT partition")
+	}
+
+	return strings.ToLower(info.DevicePartUUID), nil
+}
+
+// smbiosValue returns a resolver for a field of the SMBIOS identification.
+func smbiosValue(field func(id *smbios.System) string) placeholder.Resolver {
+	return func(arg string) (string, error) {
+		if len(arg) > 0 {
+			return "", fmt.Errorf("unexpected argument %s", arg)
+		}
+
+		sys, err := machineID()
+
+		if err != nil {
+			return "", err
+		}
+
+		return field(sys), nil
+	}
+}
+
+// expandCmdline resolves the cmdline placeholders, values are only
+// discovered when used.
+func expandCmdline(cmdline string) (string, error) {
+	if !placeholder.Has(cmdline) {
+		return cmdline, nil
+	}
+
+	return placeholder.Expand(cmdline, placeholder.Resolvers{
+		placeholder.ESPPartUUID:  espPartUUID,
+		placeholder.Slot:         placeholder.Value(slot),
+		placeholder.PartUUID:     partUUID,
+		placeholder.SMBIOSUUID:   smbiosValue(func(id *smbios.System) string { return id.UUID }),
+		placeholder.SMBIOSSerial: smbiosValue(func(id *smbios.System) string { return id.Serial }),
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// stubInfo identifies the stub in the Boot Loader Interface and the boot
+// report.
+const stubInfo = "uki-stub efiload"
+
+// report is the boot report passed to Linux.
+var report = &bootreport.Report{
+	Version: bootreport.Version,
+	Stub:    stubInfo,
+	Mode:    bootreport.ModeEmbedded,
+}
+
+var (
+	// sharedFiles is the number of report files recorded before the first
+	// boot attempt (e.g. microcode and add-ons), or -1.
+	sharedFiles = -1
+	// reportTable is the configuration table of the last attempt.
+	reportTable uint64
+)
+
+// beginAttempt starts recording a boot attempt, the files of a previous
+// failed attempt are dropped.
+func beginAttempt(mode string, entry string) {
+	if sharedFiles < 0 {
+		sharedFiles = len(report.Files)
+	}
+
+	report.Files = report.Files[:sharedFiles]
+	report.Mode, report.Entry = mode, entry
+}
+
+// initReport records the firmware and configuration state, buf is the
+// embedded configuration.
+func initReport(cfg *stubcfg.Config, buf []byte) {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+
+	store := x64.UEFI.Runtime.Variables()
+	sum := sha256.Sum256(buf)
+
+	report.SecureBoot = efivar.GetBool(store, efivar.SecureBoot)
+	report.SetupMode = efivar.GetBool(store, efivar.SetupMode)
+	report.ConfigSigned = cfg.Signed
+	report.ConfigSHA256 = hex.EncodeToString(sum[:])
+
+	if info, err := x64.UEFI.LoaderInfo(); err == nil {
+		report.Image = info.ImageIdentifier
+		report.DevicePartUUID = info.DevicePartUUID
+	}
+}
+
+// recordFile adds a loaded file to the boot report.
+func recordFile(role string, path string, data []byte, verified bool) {
+	sum := sha256.Sum256(data)
+
+	report.Files = append(report.Files, bootreport.File{
+		Role:     role,
+		Path:     path,
+		Size:     len(data),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Verified: verified,
+	})
+}
+
+// recordLoaded adds a file read with loadFile to the boot report.
+func recordLoaded(role string, f *ueficore.LoadedFile, verified bool) {
+	report.Files = append(report.Files, bootreport.File{
+		Role:     role,
+		Path:     f.Name,
+		Size:     len(f.Data),
+		SHA256:   hex.EncodeToString(f.SHA256),
+		Verified: verified,
+	})
+}
+
+// publishReport completes the boot report with the final cmdline and passes
+// it to Linux, as an initrd overlay file, a variable and a configuration
+// table, replacing those of a previous attempt. Errors are logged as the
+// report is informational.
+func publishReport(cmdline string) {
+	report.Cmdline = cmdline
+	report.TimeInitUSec = x64.InitTime().Microseconds()
+	report.TimeExecUSec = x64.Uptime().Microseconds()
+
+	buf, err := report.Marshal()
+
+	if err != nil {
+		log.Printf("could not encode boot report, %v", err)
+		return
+	}
+
+	addOverlay(bootreport.FileName, buf)
+
+	if err = bootreport.Publish(x64.UEFI.Runtime.Variables(), buf); err != nil {
+		log.Printf("could not set boot report variable, %v", err)
+	}
+
+	// runtime data is preserved by the kernel
+	addr, err := x64.UEFI.Boot.AllocatePoolData(ueficore.EfiRuntimeServicesData, bootreport.Table(buf))
+
+	if err != nil {
+		log.Printf("could not allocate boot report table, %v", err)
+		return
+	}
+
+	if err = x64.UEFI.Boot.InstallConfigurationTable(ueficore.GUID(bootreport.VendorGUID), addr); err != nil {
+		log.Printf("could not install boot report table, %v", err)
+		x64.UEFI.Boot.FreePool(addr)
+		return
+	}
+
+	// the previous table is no longer referenced
+	if reportTable != 0 {
+		x64.UEFI.Boot.FreePool(reportTable)
+	}
+
+	reportTable = addr
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+	"github.com/costinm/uki-stub/pkg/uki"
+)
+
+// authenticode returns whether firmware verifies the UKI signature against
+// db, by loading the image without starting it. This is only meaningful when
+// Secure Boot is enforced, as otherwise firmware loads unsigned images.
+func authenticode(path string, data []byte) bool {
+	if !efivar.SecureBootEnabled(x64.UEFI.Runtime.Variables()) {
+		return false
+	}
+
+	root, err := x64.UEFI.Root()
+
+	if err != nil {
+		return false
+	}
+
+	h, err := x64.UEFI.Boot.LoadImageMem(0, root, path, data)
+
+	if err != nil {
+		log.Printf("UKI %s signature is not trusted, %v", path, err)
+		return false
+	}
+
+	if err = x64.UEFI.Boot.UnloadImage(h); err != nil {
+		log.Printf("could not unload %s, %v", path, err)
+	}
+
+	return true
+}
+
+// verifyUKI checks a UKI against a signed configuration and returns the
+// cmdline to use.
+//
+// The image is trusted as a whole when its digest is trusted or, with Secure
+// Boot enforced, when it carries a valid signature. Otherwise the .linux and
+// .initrd payloads must be individually trusted and the .cmdline is only used
+// when trusted, the signed cmdline replaces it otherwise.
+func verifyUKI(cfg *stubcfg.Config, f *ueficore.LoadedFile, img *uki.Image) (cmdline string, err error) {
+	path := f.Name
+
+	if !cfg.Signed {
+		recordLoaded(bootreport.RoleUKI, f, false)
+		return img.Cmdline(), nil
+	}
+
+	if cfg.Trusted(f.SHA256) || authenticode(path, f.Data) {
+		recordLoaded(bootreport.RoleUKI, f, true)
+		return img.Cmdline(), nil
+	}
+
+	recordLoaded(bootreport.RoleUKI, f, false)
+
+	if err = cfg.Verify(path+" "+uki.Linux, img.Kernel()); err != nil {
+		return
+	}
+
+	recordFile(bootreport.RoleKernel, path+" "+uki.Linux, img.Kernel(), true)
+
+	if initrd := img.Initrd(); len(initrd) > 0 {
+		if err = cfg.Verify(path+" "+uki.Initrd, initrd); err != nil {
+			return
+		}
+
+		recordFile(bootreport.RoleInitrd, path+" "+uki.Initrd, initrd, true)
+	}
+
+	if err = cfg.Verify(path+" "+uki.Cmdline, img.Sections[uki.Cmdline]); err != nil {
+		log.Printf("ignoring UKI cmdline, %v", err)
+		return cfg.Cmdline, nil
+	}
+
+	return img.Cmdline(), nil
+}
+
+// bootUKI boots the kernel, initrd and cmdline of a UKI found on the ESP, the
+// stub bundled in the image is not executed.
+func bootUKI(cfg *stubcfg.Config, path string) error {
+	path = efiPath(path)
+	f, err := loadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Free()
+
+	img, err := uki.Parse(f.Data)
+
+	if err != nil {
+		return fmt.Errorf("invalid UKI %s, %v", path, err)
+	}
+
+	log.Printf("booting UKI %s (%s)", path, img.Name())
+
+	beginAttempt(bootreport.ModeUKI, path)
+
+	cmdline, err := verifyUKI(cfg, f, img)
+
+	if err != nil {
+		return err
+	}
+
+	var initrds []*ueficore.LoadedFile
+
+	// the initrd shares the UKI pages, which are freed on return
+	if buf := img.Initrd(); len(buf) > 0 {
+		initrds = append(initrds, &ueficore.LoadedFile{
+			Name: path + " " + uki.Initrd,
+			Data: buf,
+		})
+	}
+
+	_, err = executeKernel(cfg, path, img.Kernel(), cmdline, initrds...)
+
+	return err
+}
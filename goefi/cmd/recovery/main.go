@@ -1,21 +1,18 @@
 package main
 
 import (
-	"crypto/sha256"
 	"fmt"
-	"io"
 	"log"
 	"strings"
-	"unicode/utf16"
-	"unsafe"
 
 	"runtime"
 
-	_ "github.com/usbarmory/go-boot/cmd"
 	"github.com/usbarmory/go-boot/shell"
 
-	"github.com/usbarmory/go-boot/uefi"
-	"github.com/usbarmory/go-boot/uefi/x64"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/recovery"
+	uefi "github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
 )
 
 var CmdLine = " initrd=\\initrd.img console=tty1 rdinit=/sbin/initos-initrd net.ifnames=0 panic=0 init=/bin/sh console=ttyS0 initos_sidecar=/dev/sdb initos_debug=1 "
@@ -34,38 +31,26 @@ func main() {
 	initGoBoot()
 }
 
-func stringToUTF16Ptr(s string) *uint16 {
-	utf16Slice := utf16.Encode([]rune(s))
-	utf16Slice = append(utf16Slice, 0) // null terminate
-	return &utf16Slice[0]
-}
-
-func loadAndVerify(path string) ([]byte, error) {
+// loadAndVerify reads a file of the root volume into EFI pages, which must be
+// released with Free.
+func loadAndVerify(path string) (*uefi.LoadedFile, error) {
 	// TODO: load sig, config, initrd - and verify each sha using the pub key
 	root, err := x64.UEFI.Root()
 	if err != nil {
 		return nil, fmt.Errorf("could not open root volume, %v", err)
 	}
+	defer root.Close()
 
 	// TODO: load sig, config, initrd - and verify each sha using the pub key
 
-	bf, err := root.Open(path)
-	if err != nil {
-		fmt.Printf("Error opening %s: %v\n", path, err)
-		return nil, fmt.Errorf("could not open kernel, %v", err)
-	}
-	fmt.Printf("Opened file %v\n", bf)
-	data, err := io.ReadAll(bf)
+	f, err := x64.UEFI.Boot.ReadFile(root, path)
 	if err != nil {
 		fmt.Printf("Error reading %s: %v\n", path, err)
-		//os.Exit(1)
-	} else {
-		fmt.Println("Loaded file", len(data))
-		hash := sha256.Sum256(data)
-		fmt.Printf("SHA256 of %s (%d bytes): %x\n", path, len(data), hash)
+		return nil, fmt.Errorf("could not load %s, %v", path, err)
 	}
+	fmt.Printf("SHA256 of %s (%d bytes, %v): %x\n", path, len(f.Data), f.Elapsed, f.SHA256)
 
-	return data, nil
+	return f, nil
 }
 
 func executeKernel(path string, cmdline string) (string, error) {
@@ -73,29 +58,34 @@ func executeKernel(path string, cmdline string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("could not open root volume, %v", err)
 	}
+	defer root.Close()
 
 	// TODO: load sig, config, initrd - and verify each sha using the pub key
 
-	data, err := loadAndVerify(path)
+	// the pages are kept until StartImage returns or fails, the kernel is
+	// booted from them
+	kernel, err := loadAndVerify(path)
 	if err != nil {
 		fmt.Printf("Error opening %s: %v\n", path, err)
 		return "", fmt.Errorf("could not open kernel, %v", err)
 	}
+	defer kernel.Free()
 
 	// Use LoadedImage with the already loaded kernel - to not double
 	log.Printf("loading EFI image %s", path)
 
 	if cmdline == "" {
-		cmddata, err := loadAndVerify("\\EFI\\linux\\cmdline")
+		f, err := loadAndVerify("\\EFI\\linux\\cmdline")
 		if err != nil {
 			fmt.Printf("Error opening default cmdline: %v\n", err)
 			cmdline = CmdLine
 		} else {
-			cmdline = string(cmddata)
+			cmdline = string(f.Data)
+			f.Free()
 		}
 	}
 
-	h, err := x64.UEFI.Boot.LoadImageMem(0, root, path, data)
+	h, err := x64.UEFI.Boot.LoadImageMem(0, root, path, kernel.Data)
 	if err != nil {
 		return "", fmt.Errorf("could not load image, %v", err)
 	}
@@ -108,16 +98,18 @@ func executeKernel(path string, cmdline string) (string, error) {
 	// Note that a sha256 of the image base is NOT the same with the SHA of
 	// the bytes loaded from disk - so we can't go the other way
 
-	// Use LoadedImage protocol to get set the command line
-	limg, rawMemoryAddress, err := x64.UEFI.Boot.LoadImageHandle(h)
-	ptr := stringToUTF16Ptr(cmdline)
-	fmt.Println("Loaded image", limg)
-	addr := uintptr(rawMemoryAddress)
-	// Convert the uintptr to a *uint32 pointer
-	cmdlineLenPtr := (*uint32)(unsafe.Pointer(addr + 48))
-	*cmdlineLenPtr = uint32(len(cmdline) * 2)
-	cmdlinePtr := (*uint64)(unsafe.Pointer(addr + 56))
-	*cmdlinePtr = uefi.Ptrval(ptr)
+	if p, err := x64.UEFI.Boot.ImageFilePath(h); err == nil {
+		fmt.Println("Loaded image", p)
+	}
+
+	// Use LoadedImage protocol to set the command line
+	if err = x64.UEFI.Boot.SetLoadOptions(h, cmdline); err != nil {
+		return "", fmt.Errorf("could not set cmdline, %v", err)
+	}
+
+	if err = x64.PublishLoaderInfo("uki-stub recovery", efivar.StubFeatureReportBootPartition); err != nil {
+		log.Printf("could not publish loader variables, %v", err)
+	}
 
 	log.Printf("starting EFI image %#x", h)
 	return "", x64.UEFI.Boot.StartImage(h)
@@ -129,10 +121,6 @@ func initGoBoot() {
 	banner := fmt.Sprintf("go-boot • %s/%s (%s) • UEFI x64",
 		runtime.GOOS, runtime.GOARCH, runtime.Version())
 
-	iface := &shell.Interface{
-		Banner:  banner,
-		Console: x64.UEFI.Console,
-	}
 	shell.Add(shell.Cmd{
 		Name:   "recovery",
 		Args:   2,
@@ -153,11 +141,7 @@ func initGoBoot() {
 		},
 	})
 
-	// disable UEFI watchdog
-	x64.UEFI.Boot.SetWatchdogTimer(0)
-
-	iface.ReadWriter = x64.UEFI.Console
-	iface.Start(false)
+	recovery.Start(banner)
 
 	log.Print("exit")
 
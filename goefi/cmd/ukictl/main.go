@@ -0,0 +1,379 @@
+// ukictl reads and writes, from Linux, the EFI variables used by the stubs.
+//
+// It runs over efivarfs, with the same efivar types and decoders used by the
+// recovery shell.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/bootreport"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/efivarfs"
+	"github.com/costinm/uki-stub/pkg/loadopt"
+)
+
+const usage = `usage: ukictl [-d efivarfs] <command> [args]
+
+  status                                   Secure Boot and boot manager state
+  list [guid]                              list variables
+  get <name> <guid>                        show variable, decoded when known
+  set <name> <guid> <attr> <value>         write variable, value is
+                                           hex:<bytes>, utf16:<string> or file:<path>
+  rm <name> <guid>                         delete variable
+  boot                                     list Boot#### entries
+  boot add <part> <path> <desc> [-- args]  add Boot#### entry for a file on a
+                                           GPT partition device, first in BootOrder
+  boot order <num,...>                     set BootOrder
+  boot next <num|none>                     set or clear BootNext
+  boot rm <num>                            delete Boot#### entry
+  report [file]                            show the stub boot report, from its
+                                           variable or the initrd file
+
+guid can be global, security, shim, loader or stub, attr is a number or NV|BS|RT...
+`
+
+func main() {
+	dir := flag.String("d", efivarfs.DefaultPath, "efivarfs mount point")
+
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(efivarfs.New(*dir), flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "ukictl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// args checks the number of command arguments.
+func args(arg []string, n int) error {
+	if len(arg) < n {
+		return errors.New("missing arguments, see ukictl -h")
+	}
+
+	return nil
+}
+
+// nameGUID parses the name and guid command arguments.
+func nameGUID(arg []string) (name string, guid efivar.GUID, err error) {
+	if err = args(arg, 2); err != nil {
+		return
+	}
+
+	guid, err = efivar.ParseGUID(arg[1])
+
+	return arg[0], guid, err
+}
+
+func run(store efivar.Store, arg []string) (err error) {
+	cmd, arg := arg[0], arg[1:]
+
+	switch cmd {
+	case "status":
+		return status(store)
+	case "list":
+		var guid efivar.GUID
+
+		if len(arg) > 0 {
+			if guid, err = efivar.ParseGUID(arg[0]); err != nil {
+				return
+			}
+		}
+
+		return list(store, guid)
+	case "get":
+		name, guid, err := nameGUID(arg)
+
+		if err != nil {
+			return err
+		}
+
+		return get(store, name, guid)
+	case "set":
+		name, guid, err := nameGUID(arg)
+
+		if err != nil {
+			return err
+		}
+
+		if err = args(arg, 4); err != nil {
+			return err
+		}
+
+		attr, err := efivar.ParseAttributes(arg[2])
+
+		if err != nil {
+			return err
+		}
+
+		data, err := value(arg[3])
+
+		if err != nil {
+			return err
+		}
+
+		return store.Set(name, guid, attr, data)
+	case "rm":
+		name, guid, err := nameGUID(arg)
+
+		if err != nil {
+			return err
+		}
+
+		return store.Set(name, guid, 0, nil)
+	case "boot":
+		return boot(store, arg)
+	case "report":
+		return showReport(store, arg)
+	}
+
+	return fmt.Errorf("unknown command %s, see ukictl -h", cmd)
+}
+
+// value parses a variable value, given as hex:<bytes>, utf16:<string> or
+// file:<path>.
+func value(arg string) (data []byte, err error) {
+	kind, val, _ := strings.Cut(arg, ":")
+
+	switch kind {
+	case "hex":
+		return hex.DecodeString(val)
+	case "utf16":
+		return efivar.EncodeString(val), nil
+	case "file":
+		return os.ReadFile(val)
+	}
+
+	return nil, fmt.Errorf("invalid value %s", arg)
+}
+
+func status(store efivar.Store) error {
+	for _, name := range []string{"SecureBoot", "SetupMode", "AuditMode", "DeployedMode", "BootCurrent", "BootNext", "BootOrder"} {
+		data, _, err := store.Get(name, efivar.GlobalVariable)
+
+		switch {
+		case errors.Is(err, efivar.ErrNotFound):
+			fmt.Printf("%-12s -\n", name)
+			continue
+		case err != nil:
+			return err
+		}
+
+		s, err := efivar.LookupDecoder(name, efivar.GlobalVariable)(data)
+
+		if err != nil {
+			s = fmt.Sprintf("<%v>", err)
+		}
+
+		fmt.Printf("%-12s %s\n", name, s)
+	}
+
+	return nil
+}
+
+func list(store efivar.Store, guid efivar.GUID) error {
+	vars, err := store.List()
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].GUID != vars[j].GUID {
+			return vars[i].GUID < vars[j].GUID
+		}
+
+		return vars[i].Name < vars[j].Name
+	})
+
+	for _, v := range vars {
+		if len(guid) > 0 && v.GUID != guid {
+			continue
+		}
+
+		fmt.Printf("%-36s %s\n", v.GUID, v.Name)
+	}
+
+	return nil
+}
+
+func get(store efivar.Store, name string, guid efivar.GUID) error {
+	data, attr, err := store.Get(name, guid)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s-%s %s %d bytes\n", name, guid, efivar.FormatAttributes(attr), len(data))
+
+	if decode := efivar.LookupDecoder(name, guid); decode != nil {
+		s, err := decode(data)
+
+		if err == nil {
+			fmt.Println(strings.TrimSuffix(s, "\n"))
+			return nil
+		}
+
+		fmt.Printf("<%v>\n", err)
+	}
+
+	fmt.Print(hex.Dump(data))
+
+	return nil
+}
+
+func boot(store efivar.Store, arg []string) (err error) {
+	if len(arg) == 0 {
+		opts, err := efivar.BootOptions(store)
+
+		if err != nil {
+			return err
+		}
+
+		for _, o := range opts {
+			active := " "
+
+			if o.Active() {
+				active = "*"
+			}
+
+			fmt.Printf("%s%s %s\n", efivar.BootOptionName(o.Num), active, o.LoadOption)
+		}
+
+		return nil
+	}
+
+	if arg[0] == "add" {
+		return bootAdd(store, arg[1:])
+	}
+
+	if err = args(arg, 2); err != nil {
+		return
+	}
+
+	if arg[0] == "next" && arg[1] == "none" {
+		return efivar.DeleteBootNext(store)
+	}
+
+	var nums []uint16
+
+	for _, s := range strings.Split(arg[1], ",") {
+		num, err := efivar.ParseBootNum(s)
+
+		if err != nil {
+			return err
+		}
+
+		nums = append(nums, num)
+	}
+
+	switch arg[0] {
+	case "order":
+		return efivar.SetBootOrder(store, nums)
+	case "next":
+		if _, err = efivar.GetBootOption(store, nums[0]); err != nil {
+			return fmt.Errorf("invalid boot option %s, %v", arg[1], err)
+		}
+
+		return efivar.SetBootNext(store, nums[0])
+	case "rm":
+		return efivar.DeleteBootOption(store, nums[0])
+	}
+
+	return fmt.Errorf("unknown boot command %s", arg[0])
+}
+
+// bootAdd adds a Boot#### entry, as the recovery shell bootmgr add command
+// does, arguments following -- are passed as UTF-16 optional data.
+func bootAdd(store efivar.Store, arg []string) error {
+	var data []byte
+
+	if i := slices.Index(arg, "--"); i >= 0 {
+		data = efivar.EncodeString(strings.Join(arg[i+1:], " "))
+		arg = arg[:i]
+	}
+
+	if err := args(arg, 3); err != nil {
+		return err
+	}
+
+	p, err := partitionPath(arg[0], arg[1])
+
+	if err != nil {
+		return err
+	}
+
+	num, err := efivar.AddBootOption(store, loadopt.New(strings.Join(arg[2:], " "), p, data))
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s added: %s\n", efivar.BootOptionName(num), p)
+
+	return nil
+}
+
+// reportFile is the boot report path, within the initrd.
+const reportFile = "/run/uki-stub/" + bootreport.FileName
+
+func showReport(store efivar.Store, arg []string) error {
+	var buf []byte
+
+	r, err := bootreport.Read(store)
+
+	if len(arg) > 0 || errors.Is(err, efivar.ErrNotFound) {
+		path := reportFile
+
+		if len(arg) > 0 {
+			path = arg[0]
+		}
+
+		if buf, err = os.ReadFile(path); err != nil {
+			return err
+		}
+
+		r, err = bootreport.Parse(buf)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid boot report, %v", err)
+	}
+
+	fmt.Printf("%-16s %s\n", "Stub", r.Stub)
+	fmt.Printf("%-16s %s\n", "Image", r.Image)
+	fmt.Printf("%-16s %s\n", "Partition", r.DevicePartUUID)
+	fmt.Printf("%-16s %v (setup mode %v)\n", "Secure Boot", r.SecureBoot, r.SetupMode)
+	fmt.Printf("%-16s signed %v, sha256 %s\n", "Config", r.ConfigSigned, r.ConfigSHA256)
+	fmt.Printf("%-16s %s %s\n", "Mode", r.Mode, r.Entry)
+	fmt.Printf("%-16s %s\n", "Machine", strings.Join(r.Machine, " "))
+	fmt.Printf("%-16s %s\n", "Cmdline", r.Cmdline)
+	fmt.Printf("%-16s init %dus, exec %dus\n", "Time", r.TimeInitUSec, r.TimeExecUSec)
+
+	for _, f := range r.Files {
+		verified := " "
+
+		if f.Verified {
+			verified = "*"
+		}
+
+		fmt.Printf("%s %-9s %s %10d %s\n", verified, f.Role, f.SHA256, f.Size, f.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+const (
+	// sysBlock holds the block devices, in sysfs.
+	sysBlock = "/sys/class/block"
+	// partUUIDDir holds the partitions by GPT unique GUID, as named by udev.
+	partUUIDDir = "/dev/disk/by-partuuid"
+	// sysfs partition offsets and sizes are in 512 byte sectors
+	sectorSize = 512
+)
+
+// sysUint reads a sysfs attribute holding a decimal number.
+func sysUint(path string) (uint64, error) {
+	buf, err := os.ReadFile(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+}
+
+// partUUID returns the GPT unique partition GUID of a device, as found by
+// udev.
+func partUUID(dev string) (efivar.GUID, error) {
+	entries, err := os.ReadDir(partUUIDDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		if p, err := filepath.EvalSymlinks(filepath.Join(partUUIDDir, e.Name())); err == nil && p == dev {
+			return efivar.ParseGUID(e.Name())
+		}
+	}
+
+	return "", fmt.Errorf("%s is not a GPT partition", dev)
+}
+
+// partitionPath returns the device path of a file on a GPT partition, given
+// its block device, as a Hard Drive node followed by a File Path node. The
+// firmware expands such short-form paths, as created by efibootmgr.
+func partitionPath(dev string, path string) (p devpath.Path, err error) {
+	if dev, err = filepath.EvalSymlinks(dev); err != nil {
+		return
+	}
+
+	guid, err := partUUID(dev)
+
+	if err != nil {
+		return
+	}
+
+	part, err := filepath.EvalSymlinks(filepath.Join(sysBlock, filepath.Base(dev)))
+
+	if err != nil {
+		return
+	}
+
+	num, err := sysUint(filepath.Join(part, "partition"))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a partition, %v", dev, err)
+	}
+
+	start, err := sysUint(filepath.Join(part, "start"))
+
+	if err != nil {
+		return
+	}
+
+	size, err := sysUint(filepath.Join(part, "size"))
+
+	if err != nil {
+		return
+	}
+
+	// the device path uses logical blocks of the parent disk
+	lbs, err := sysUint(filepath.Join(filepath.Dir(part), "queue", "logical_block_size"))
+
+	if err != nil || lbs == 0 {
+		lbs = sectorSize
+	}
+
+	hd := &devpath.HardDrive{
+		PartitionNumber: uint32(num),
+		PartitionStart:  start * sectorSize / lbs,
+		PartitionSize:   size * sectorSize / lbs,
+		Format:          devpath.PartitionGPT,
+		SignatureType:   devpath.SignatureGPT,
+	}
+	copy(hd.Signature[:], guid.Bytes())
+
+	path = strings.ReplaceAll(path, "/", "\\")
+
+	if !strings.HasPrefix(path, "\\") {
+		path = "\\" + path
+	}
+
+	return devpath.Path{hd.Node(), devpath.FilePath(path)}, nil
+}
@@ -0,0 +1,238 @@
+// Package bls parses and orders Boot Loader Specification Type #1 entries,
+// the drop-in loader/entries/*.conf files, see
+// https://uapi-group.org/specifications/specs/boot_loader_specification.
+package bls
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Suffix is the entry file name suffix.
+const Suffix = ".conf"
+
+// Entry represents a Type #1 boot entry.
+type Entry struct {
+	// ID is the entry file name, without suffix.
+	ID string
+
+	Title     string
+	Version   string
+	MachineID string
+	SortKey   string
+	Linux     string
+	Initrd    []string
+	Options   string
+}
+
+// Parse parses a Type #1 entry file, unknown keys are ignored.
+func Parse(id string, buf []byte) (e *Entry, err error) {
+	var options []string
+
+	e = &Entry{
+		ID: strings.TrimSuffix(id, Suffix),
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(buf))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// keys are separated from values by any run of whitespace
+		key, val := line, ""
+
+		if i := strings.IndexFunc(line, unicode.IsSpace); i > 0 {
+			key, val = line[:i], strings.TrimSpace(line[i:])
+		}
+
+		switch key {
+		case "title":
+			e.Title = val
+		case "version":
+			e.Version = val
+		case "machine-id":
+			e.MachineID = val
+		case "sort-key":
+			e.SortKey = val
+		case "linux":
+			e.Linux = val
+		case "initrd":
+			e.Initrd = append(e.Initrd, val)
+		case "options":
+			options = append(options, val)
+		}
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(e.Linux) == 0 {
+		return nil, errors.New("missing linux key")
+	}
+
+	e.Options = strings.Join(options, " ")
+
+	return
+}
+
+// Name returns the entry title, or its ID when missing.
+func (e *Entry) Name() string {
+	if len(e.Title) > 0 {
+		return e.Title
+	}
+
+	return e.ID
+}
+
+// Less reports whether entry a sorts before b: entries with a sort key
+// first, ordered by sort key and machine ID, then newest version first, then
+// newest ID first.
+func Less(a, b *Entry) bool {
+	if (len(a.SortKey) > 0) != (len(b.SortKey) > 0) {
+		return len(a.SortKey) > 0
+	}
+
+	if len(a.SortKey) > 0 {
+		if a.SortKey != b.SortKey {
+			return a.SortKey < b.SortKey
+		}
+
+		if a.MachineID != b.MachineID {
+			return a.MachineID < b.MachineID
+		}
+
+		if c := VersionCompare(a.Version, b.Version); c != 0 {
+			return c > 0
+		}
+	}
+
+	return VersionCompare(a.ID, b.ID) > 0
+}
+
+// Sort orders entries as defined by Less(), the default entry is the first.
+func Sort(entries []*Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return Less(entries[i], entries[j])
+	})
+}
+
+// Select returns the first entry whose ID matches the argument glob pattern,
+// the first entry when the pattern is empty or nothing matches, or nil when
+// there are no entries.
+func Select(entries []*Entry, pattern string) *Entry {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if len(pattern) > 0 {
+		for _, e := range entries {
+			if ok, _ := path.Match(pattern, e.ID); ok || pattern == e.ID+Suffix {
+				return e
+			}
+		}
+	}
+
+	return entries[0]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isValid(c byte) bool {
+	return isDigit(c) || isAlpha(c) || strings.IndexByte("~-^.", c) >= 0
+}
+
+func cmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+
+	return -1
+}
+
+// span splits s after its leading characters matching fn.
+func span(s string, fn func(byte) bool) (string, string) {
+	i := 0
+
+	for i < len(s) && fn(s[i]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+// VersionCompare compares version strings as systemd does (see
+// strverscmp_improved), returning -1, 0 or 1. Numeric segments compare by
+// value and are newer than alphabetic ones, `~` marks pre-releases, which are
+// older than anything, and otherwise the string with more segments is newer.
+func VersionCompare(a, b string) int {
+next:
+	for {
+		a = strings.TrimLeftFunc(a, func(r rune) bool { return r > 0x7f || !isValid(byte(r)) })
+		b = strings.TrimLeftFunc(b, func(r rune) bool { return r > 0x7f || !isValid(byte(r)) })
+
+		if (len(a) > 0 && a[0] == '~') || (len(b) > 0 && b[0] == '~') {
+			if r := cmp(len(a) == 0 || a[0] != '~', len(b) == 0 || b[0] != '~'); r != 0 {
+				return r
+			}
+
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if len(a) == 0 || len(b) == 0 {
+			return cmp(len(a) > 0, len(b) > 0)
+		}
+
+		// the string with a separator is older (e.g. 123-9 vs 123.1-1)
+		for _, c := range []byte("-^.") {
+			if a[0] == c || b[0] == c {
+				if r := cmp(a[0] != c, b[0] != c); r != 0 {
+					return r
+				}
+
+				a, b = a[1:], b[1:]
+				continue next
+			}
+		}
+
+		var sa, sb string
+
+		if isDigit(a[0]) || isDigit(b[0]) {
+			sa, a = span(a, isDigit)
+			sb, b = span(b, isDigit)
+
+			sa = strings.TrimLeft(sa, "0")
+			sb = strings.TrimLeft(sb, "0")
+
+			if len(sa) != len(sb) {
+				return cmp(len(sa) > len(sb), len(sa) < len(sb))
+			}
+		} else {
+			sa, a = span(a, isAlpha)
+			sb, b = span(b, isAlpha)
+		}
+
+		if r := strings.Compare(sa, sb); r != 0 {
+			return r
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package bls
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	in := "# Boot Loader Specification type#1 entry\n" +
+		"title      Fedora Linux 40 (Workstation Edition)\n" +
+		"version\t6.8.5-301.fc40.x86_64\n" +
+		"machine-id 6a9857a393724b7a981ebb5b8495b9ea\n" +
+		"sort-key \t fedora  \n" +
+		"linux /6a9857a393724b7a981ebb5b8495b9ea/6.8.5-301.fc40.x86_64/linux\n" +
+		"initrd\t\t/6a9857a393724b7a981ebb5b8495b9ea/6.8.5-301.fc40.x86_64/initrd\n" +
+		"options  root=UUID=0fc63daf rw \n" +
+		"options\tquiet\n" +
+		"architecture\n"
+
+	e, err := Parse("6a9857a393724b7a981ebb5b8495b9ea-6.8.5-301.fc40.x86_64.conf", []byte(in))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Entry{
+		ID:        "6a9857a393724b7a981ebb5b8495b9ea-6.8.5-301.fc40.x86_64",
+		Title:     "Fedora Linux 40 (Workstation Edition)",
+		Version:   "6.8.5-301.fc40.x86_64",
+		MachineID: "6a9857a393724b7a981ebb5b8495b9ea",
+		SortKey:   "fedora",
+		Linux:     "/6a9857a393724b7a981ebb5b8495b9ea/6.8.5-301.fc40.x86_64/linux",
+		Initrd:    []string{"/6a9857a393724b7a981ebb5b8495b9ea/6.8.5-301.fc40.x86_64/initrd"},
+		Options:   "root=UUID=0fc63daf rw quiet",
+	}
+
+	if e.ID != want.ID || e.Title != want.Title || e.Version != want.Version || e.MachineID != want.MachineID ||
+		e.SortKey != want.SortKey || e.Linux != want.Linux || !slices.Equal(e.Initrd, want.Initrd) || e.Options != want.Options {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+
+	if _, err = Parse("empty.conf", []byte("title\tempty\n")); err == nil {
+		t.Error("entry without linux key parsed")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"6.8.5", "6.8.5", 0},
+		{"6.10.1", "6.9.12", 1},
+		{"6.8.5~rc1", "6.8.5", -1},
+		{"123-9", "123.1-1", -1},
+		{"1.0a", "1.0", 1},
+	} {
+		if got := VersionCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("VersionCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package bmp decodes Windows bitmap images, as written by common image
+// editors for firmware logos: uncompressed 8-bit paletted, 24-bit and
+// 32-bit (optionally with BI_BITFIELDS masks) images, bottom-up or top-down.
+//
+// Images are encoded as uncompressed 24-bit bottom-up bitmaps, readable by
+// any viewer.
+package bmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+const (
+	fileHeaderSize = 14
+	infoHeaderSize = 40
+
+	biRGB       = 0
+	biBitfields = 3
+
+	// MaxSize is the maximum width and height of decoded images.
+	MaxSize = 16384
+)
+
+// Magic is the signature of bitmap files.
+const Magic = "BM"
+
+type infoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+// Decode decodes a bitmap image.
+func Decode(r io.Reader) (img image.Image, err error) {
+	buf, err := io.ReadAll(r)
+
+	if err != nil {
+		return
+	}
+
+	if len(buf) < fileHeaderSize+infoHeaderSize || string(buf[:2]) != Magic {
+		return nil, errors.New("not a bitmap image")
+	}
+
+	offset := int(binary.LittleEndian.Uint32(buf[10:]))
+	h := &infoHeader{}
+
+	if _, err = binary.Decode(buf[fileHeaderSize:], binary.LittleEndian, h); err != nil {
+		return
+	}
+
+	width := int(h.Width)
+	height := int(h.Height)
+	topDown := height < 0
+
+	if topDown {
+		height = -height
+	}
+
+	switch {
+	case h.Size < infoHeaderSize:
+		return nil, fmt.Errorf("unsupported header size %d", h.Size)
+	case width <= 0 || height <= 0 || width > MaxSize || height > MaxSize:
+		return nil, fmt.Errorf("invalid size %dx%d", width, height)
+	case h.Compression != biRGB && !(h.Compression == biBitfields && h.BitCount == 32):
+		return nil, fmt.Errorf("unsupported compression %d", h.Compression)
+	}
+
+	var masks [3]uint32
+	var palette color.Palette
+
+	switch h.BitCount {
+	case 8:
+		n := int(h.ClrUsed)
+
+		if n == 0 || n > 256 {
+			n = 256
+		}
+
+		p := fileHeaderSize + int(h.Size)
+
+		if len(buf) < p+n*4 {
+			return nil, errors.New("palette truncated")
+		}
+
+		for i := 0; i < n; i++ {
+			c := buf[p+i*4:]
+			palette = append(palette, color.RGBA{c[2], c[1], c[0], 0xff})
+		}
+	case 24:
+	case 32:
+		masks = [3]uint32{0x00ff0000, 0x0000ff00, 0x000000ff}
+
+		if h.Compression == biBitfields {
+			// masks follow a BITMAPINFOHEADER, or are part of larger ones
+			p := fileHeaderSize + infoHeaderSize
+
+			if len(buf) < p+12 {
+				return nil, errors.New("bitfields truncated")
+			}
+
+			for i := range masks {
+				masks[i] = binary.LittleEndian.Uint32(buf[p+i*4:])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bit count %d", h.BitCount)
+	}
+
+	stride := (width*int(h.BitCount)/8 + 3) &^ 3
+
+	if offset < 0 || len(buf) < offset+stride*height {
+		return nil, errors.New("pixel data truncated")
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		row := y
+
+		if !topDown {
+			row = height - 1 - y
+		}
+
+		src := buf[offset+row*stride:]
+
+		for x := 0; x < width; x++ {
+			var c color.RGBA
+
+			switch h.BitCount {
+			case 8:
+				if i := int(src[x]); i < len(palette) {
+					c = palette[i].(color.RGBA)
+				}
+			case 24:
+				c = color.RGBA{src[x*3+2], src[x*3+1], src[x*3], 0xff}
+			case 32:
+				v := binary.LittleEndian.Uint32(src[x*4:])
+				c = color.RGBA{channel(v, masks[0]), channel(v, masks[1]), channel(v, masks[2]), 0xff}
+			}
+
+			rgba.SetRGBA(x, y, c)
+		}
+	}
+
+	return rgba, nil
+}
+
+// Encode writes an image as a 24-bit bitmap, one row at a time.
+func Encode(w io.Writer, img image.Image) (err error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= 0 || height <= 0 || width > MaxSize || height > MaxSize {
+		return fmt.Errorf("invalid size %dx%d", width, height)
+	}
+
+	stride := (width*3 + 3) &^ 3
+	offset := fileHeaderSize + infoHeaderSize
+	header := make([]byte, offset)
+
+	copy(header, Magic)
+	binary.LittleEndian.PutUint32(header[2:], uint32(offset+stride*height))
+	binary.LittleEndian.PutUint32(header[10:], uint32(offset))
+
+	h := &infoHeader{
+		Size:      infoHeaderSize,
+		Width:     int32(width),
+		Height:    int32(height),
+		Planes:    1,
+		BitCount:  24,
+		SizeImage: uint32(stride * height),
+	}
+
+	if _, err = binary.Encode(header[fileHeaderSize:], binary.LittleEndian, h); err != nil {
+		return
+	}
+
+	if _, err = w.Write(header); err != nil {
+		return
+	}
+
+	rgba, _ := img.(interface{ RGBAAt(x, y int) color.RGBA })
+	row := make([]byte, stride)
+
+	// bottom-up
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := 0; x < width; x++ {
+			var r, g, b uint8
+
+			if rgba != nil {
+				c := rgba.RGBAAt(bounds.Min.X+x, y)
+				r, g, b = c.R, c.G, c.B
+			} else {
+				r32, g32, b32, _ := img.At(bounds.Min.X+x, y).RGBA()
+				r, g, b = uint8(r32>>8), uint8(g32>>8), uint8(b32>>8)
+			}
+
+			row[x*3] = b
+			row[x*3+1] = g
+			row[x*3+2] = r
+		}
+
+		if _, err = w.Write(row); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// channel extracts an 8-bit color component from a pixel bitmask.
+func channel(v uint32, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+
+	shift := bits.TrailingZeros32(mask)
+	n := bits.OnesCount32(mask >> shift)
+	c := (v & mask) >> shift
+
+	if n >= 8 {
+		return uint8(c >> (n - 8))
+	}
+
+	return uint8(c * 0xff / (1<<n - 1))
+}
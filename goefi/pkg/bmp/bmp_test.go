@@ -0,0 +1,187 @@
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage returns an image with distinct colors for every pixel, of a
+// width which requires row padding at 24 bits.
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 5, 3))
+
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 50), uint8(y * 100), uint8(x*y + 7), 0xff})
+		}
+	}
+
+	return img
+}
+
+// bitmap returns a 24 or 32-bit bitmap of img, optionally top-down or with
+// BI_BITFIELDS masks (32-bit only), as written by image editors.
+func bitmap(img *image.RGBA, bitCount int, topDown bool, masks []uint32) []byte {
+	var pixels bytes.Buffer
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	stride := (width*bitCount/8 + 3) &^ 3
+
+	for i := 0; i < height; i++ {
+		y := height - 1 - i
+
+		if topDown {
+			y = i
+		}
+
+		row := make([]byte, stride)
+
+		for x := 0; x < width; x++ {
+			c := img.RGBAAt(x, y)
+
+			switch {
+			case masks != nil:
+				// R10G10B10 in the low bits, left aligned components
+				v := uint32(c.R)<<22 | uint32(c.G)<<12 | uint32(c.B)<<2
+				binary.LittleEndian.PutUint32(row[x*4:], v)
+			case bitCount == 32:
+				copy(row[x*4:], []byte{c.B, c.G, c.R, 0})
+			default:
+				copy(row[x*3:], []byte{c.B, c.G, c.R})
+			}
+		}
+
+		pixels.Write(row)
+	}
+
+	offset := fileHeaderSize + infoHeaderSize + len(masks)*4
+	h := &infoHeader{
+		Size:      infoHeaderSize,
+		Width:     int32(width),
+		Height:    int32(height),
+		Planes:    1,
+		BitCount:  uint16(bitCount),
+		SizeImage: uint32(pixels.Len()),
+	}
+
+	if topDown {
+		h.Height = -h.Height
+	}
+
+	if masks != nil {
+		h.Compression = biBitfields
+	}
+
+	buf := make([]byte, fileHeaderSize)
+	copy(buf, Magic)
+	binary.LittleEndian.PutUint32(buf[2:], uint32(offset+pixels.Len()))
+	binary.LittleEndian.PutUint32(buf[10:], uint32(offset))
+
+	buf, _ = binary.Append(buf, binary.LittleEndian, h)
+	buf, _ = binary.Append(buf, binary.LittleEndian, masks)
+
+	return append(buf, pixels.Bytes()...)
+}
+
+func TestDecode(t *testing.T) {
+	img := testImage()
+	r10g10b10 := []uint32{0x3ff00000, 0x000ffc00, 0x000003ff}
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		{"24-bit bottom-up", bitmap(img, 24, false, nil)},
+		{"24-bit top-down", bitmap(img, 24, true, nil)},
+		{"32-bit bottom-up", bitmap(img, 32, false, nil)},
+		{"32-bit top-down", bitmap(img, 32, true, nil)},
+		{"32-bit bitfields", bitmap(img, 32, false, r10g10b10)},
+	} {
+		got, err := Decode(bytes.NewReader(tt.in))
+
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !equal(got, img) {
+			t.Errorf("%s: decoded image does not match", tt.name)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+
+	img := testImage()
+
+	if err := Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// Encode writes 24-bit bottom-up bitmaps
+	if want := bitmap(img, 24, false, nil); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x\nwant %x", buf.Bytes(), want)
+	}
+
+	got, err := Decode(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal(got, img) {
+		t.Error("decoded image does not match")
+	}
+
+	// sub-images are encoded from their bounds
+	sub := img.SubImage(image.Rect(1, 1, 4, 3)).(*image.RGBA)
+	buf.Reset()
+
+	if err = Encode(&buf, sub); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err = Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Bounds().Dx() != 3 || got.Bounds().Dy() != 2 || got.At(0, 0) != sub.At(1, 1) || got.At(2, 1) != sub.At(3, 2) {
+		t.Error("decoded sub-image does not match")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	in := bitmap(testImage(), 24, false, nil)
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		{"magic", append([]byte("XX"), in[2:]...)},
+		{"header", in[:fileHeaderSize+10]},
+		{"pixels", in[:len(in)-1]},
+	} {
+		if _, err := Decode(bytes.NewReader(tt.in)); err == nil {
+			t.Errorf("%s: invalid bitmap decoded", tt.name)
+		}
+	}
+}
+
+func equal(a image.Image, b *image.RGBA) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		for x := b.Rect.Min.X; x < b.Rect.Max.X; x++ {
+			if a.At(x, y) != b.At(x, y) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
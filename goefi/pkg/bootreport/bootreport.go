@@ -0,0 +1,153 @@
+// Package bootreport defines the boot report, a JSON document describing how
+// the stub booted: the selected entry, the Secure Boot state and the files
+// which were loaded and verified.
+//
+// The stub passes the report to Linux as the /run/uki-stub/boot-report.json
+// initrd file, as a volatile EFI variable, readable from efivarfs, and as an
+// EFI Configuration Table. The same types are used by the stub to write the
+// report and by Linux tools to read it.
+package bootreport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// Version is the report schema version, incremented on incompatible changes.
+const Version = 1
+
+const (
+	// FileName is the report file name, in the initrd overlay directory.
+	FileName = "boot-report.json"
+	// VariableName is the report variable name, under VendorGUID.
+	VariableName = "StubBootReport"
+	// VendorGUID is the variable vendor GUID, also used as the EFI
+	// Configuration Table GUID.
+	VendorGUID = efivar.StubVendor
+)
+
+// Boot modes.
+const (
+	// ModeEmbedded boots the kernel embedded in the stub.
+	ModeEmbedded = "embedded"
+	// ModeEntry boots a Boot Loader Specification entry.
+	ModeEntry = "entry"
+	// ModeUKI boots the payload of a UKI.
+	ModeUKI = "uki"
+)
+
+// File roles.
+const (
+	RoleKernel    = "kernel"
+	RoleInitrd    = "initrd"
+	RoleMicrocode = "microcode"
+	RoleAddon     = "addon"
+	RoleUKI       = "uki"
+)
+
+// File represents a file loaded by the stub.
+type File struct {
+	Role   string `json:"role"`
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Verified is set when the file digest or signature was checked
+	// against the signed configuration or db.
+	Verified bool `json:"verified"`
+}
+
+// Report represents a boot report.
+type Report struct {
+	Version int `json:"version"`
+
+	// Stub is the stub name and version.
+	Stub string `json:"stub"`
+	// Image is the stub path within the ESP.
+	Image string `json:"image,omitempty"`
+	// DevicePartUUID is the GPT partition GUID of the ESP.
+	DevicePartUUID string `json:"device_part_uuid,omitempty"`
+
+	SecureBoot bool `json:"secure_boot"`
+	SetupMode  bool `json:"setup_mode"`
+
+	// ConfigSigned is set for configurations with the UKI header.
+	ConfigSigned bool `json:"config_signed"`
+	// ConfigSHA256 is the digest of the embedded configuration.
+	ConfigSHA256 string `json:"config_sha256"`
+
+	Mode string `json:"mode"`
+	// Entry is the selected entry ID, or the UKI path.
+	Entry string `json:"entry,omitempty"`
+
+	// Machine lists the matching per-machine configuration sections.
+	Machine []string `json:"machine,omitempty"`
+
+	Files   []File `json:"files,omitempty"`
+	Cmdline string `json:"cmdline"`
+
+	// TimeInitUSec and TimeExecUSec are the times since CPU reset when
+	// the stub started, and started the kernel.
+	TimeInitUSec int64 `json:"time_init_usec,omitempty"`
+	TimeExecUSec int64 `json:"time_exec_usec,omitempty"`
+}
+
+// Marshal returns the JSON encoding of the report.
+func (r *Report) Marshal() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Parse decodes a JSON report.
+func Parse(buf []byte) (r *Report, err error) {
+	r = &Report{}
+
+	if err = json.Unmarshal(buf, r); err != nil {
+		return nil, err
+	}
+
+	if r.Version != Version {
+		return nil, fmt.Errorf("unsupported report version %d", r.Version)
+	}
+
+	return
+}
+
+// Table returns the EFI Configuration Table encoding of a JSON report: a
+// 32-bit little endian length, followed by the JSON bytes.
+func Table(buf []byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(buf))), buf...)
+}
+
+// ParseTable decodes an EFI Configuration Table report.
+func ParseTable(buf []byte) (*Report, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("invalid table")
+	}
+
+	n := binary.LittleEndian.Uint32(buf)
+
+	if int(n) > len(buf)-4 {
+		return nil, errors.New("invalid table length")
+	}
+
+	return Parse(buf[4 : 4+n])
+}
+
+// Publish writes the report variable.
+func Publish(s efivar.Store, buf []byte) error {
+	return s.Set(VariableName, VendorGUID, efivar.LoaderAttributes, buf)
+}
+
+// Read reads the report variable.
+func Read(s efivar.Store) (*Report, error) {
+	buf, _, err := s.Get(VariableName, VendorGUID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(buf)
+}
@@ -0,0 +1,210 @@
+// Package cpio writes newc (SVR4 portable, without checksum) archives, the
+// format unpacked by Linux from initrds.
+//
+// Archives are reproducible: inode numbers are sequential and all times,
+// owners and devices are zero. Parent directories are added as needed, since
+// the kernel unpacker does not create them.
+package cpio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Magic is the newc header magic.
+const Magic = "070701"
+
+// Trailer is the name of the entry terminating an archive.
+const Trailer = "TRAILER!!!"
+
+// File mode types.
+const (
+	TypeDir     = 0o040000
+	TypeReg     = 0o100000
+	TypeSymlink = 0o120000
+)
+
+// headerSize is the size of the newc header, including the magic.
+const headerSize = 110
+
+// Writer represents a newc archive writer.
+type Writer struct {
+	w    io.Writer
+	n    int64
+	ino  uint32
+	dirs map[string]bool
+	err  error
+}
+
+// NewWriter returns a writer appending an archive to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:    w,
+		dirs: map[string]bool{".": true},
+	}
+}
+
+// IsNewc returns whether buf starts with an uncompressed newc archive.
+func IsNewc(buf []byte) bool {
+	return bytes.HasPrefix(buf, []byte(Magic))
+}
+
+// clean returns the archive name of a path, relative to the root.
+func clean(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	if len(name) == 0 {
+		return "", errors.New("invalid name")
+	}
+
+	return name, nil
+}
+
+func (w *Writer) write(buf []byte) {
+	if w.err != nil {
+		return
+	}
+
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *Writer) pad() {
+	if r := w.n % 4; r != 0 {
+		w.write(make([]byte, 4-r))
+	}
+}
+
+// entry writes a single archive entry.
+func (w *Writer) entry(name string, mode uint32, data []byte) error {
+	nlink := 1
+
+	if mode&TypeDir == TypeDir {
+		nlink = 2
+	}
+
+	if name != Trailer {
+		w.ino++
+	}
+
+	hdr := fmt.Sprintf("%s%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		Magic,
+		w.ino,
+		mode,
+		0, // uid
+		0, // gid
+		nlink,
+		0, // mtime
+		len(data),
+		0, 0, // device
+		0, 0, // rdev
+		len(name)+1,
+		0, // check
+	)
+
+	w.write([]byte(hdr))
+	w.write(append([]byte(name), 0))
+	w.pad()
+	w.write(data)
+	w.pad()
+
+	return w.err
+}
+
+// parents adds the missing parent directories of name.
+func (w *Writer) parents(name string) error {
+	dir := path.Dir(name)
+
+	if w.dirs[dir] {
+		return nil
+	}
+
+	if err := w.parents(dir); err != nil {
+		return err
+	}
+
+	w.dirs[dir] = true
+
+	return w.entry(dir, TypeDir|0o755, nil)
+}
+
+// Mkdir adds a directory, and its missing parents.
+func (w *Writer) Mkdir(name string, perm uint32) (err error) {
+	if name, err = clean(name); err != nil {
+		return
+	}
+
+	if w.dirs[name] {
+		return nil
+	}
+
+	if err = w.parents(name); err != nil {
+		return
+	}
+
+	w.dirs[name] = true
+
+	return w.entry(name, TypeDir|perm&0o7777, nil)
+}
+
+// WriteFile adds a regular file, and its missing parent directories.
+func (w *Writer) WriteFile(name string, perm uint32, data []byte) (err error) {
+	if name, err = clean(name); err != nil {
+		return
+	}
+
+	if err = w.parents(name); err != nil {
+		return
+	}
+
+	return w.entry(name, TypeReg|perm&0o7777, data)
+}
+
+// Symlink adds a symbolic link, and its missing parent directories.
+func (w *Writer) Symlink(name string, target string) (err error) {
+	if name, err = clean(name); err != nil {
+		return
+	}
+
+	if err = w.parents(name); err != nil {
+		return
+	}
+
+	return w.entry(name, TypeSymlink|0o777, []byte(target))
+}
+
+// Close terminates the archive, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.entry(Trailer, 0, nil)
+}
+
+// File represents a regular file added by Archive.
+type File struct {
+	Name string
+	Mode uint32
+	Data []byte
+}
+
+// Archive returns a newc archive holding the argument files.
+func Archive(files []File) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+
+	for _, f := range files {
+		if err := w.WriteFile(f.Name, f.Mode, f.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,418 @@
+// Package devpath parses, builds and formats EFI Device Paths.
+//
+// It has no dependency on the firmware bindings, so the same code is used by
+// the stubs (reading paths from protocol interfaces) and by Linux tools
+// (reading paths from Boot#### variables).
+//
+// Text conversion follows the UEFI 2.10 "Device Path to Text" rules for the
+// node types commonly found on boot devices - anything else is printed using
+// the generic Path(type,subtype,data) form.
+package devpath
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/efienc"
+)
+
+// Device path types.
+const (
+	TypeHardware  = 0x01
+	TypeACPI      = 0x02
+	TypeMessaging = 0x03
+	TypeMedia     = 0x04
+	TypeBBS       = 0x05
+	TypeEnd       = 0x7f
+)
+
+// End node subtypes.
+const (
+	SubTypeEndInstance = 0x01
+	SubTypeEndEntire   = 0xff
+)
+
+// Media node subtypes.
+const (
+	SubTypeHardDrive = 0x01
+	SubTypeCDROM     = 0x02
+	SubTypeVendor    = 0x03
+	SubTypeFilePath  = 0x04
+)
+
+// Hard drive partition formats and signature types.
+const (
+	PartitionMBR = 0x01
+	PartitionGPT = 0x02
+
+	SignatureNone = 0x00
+	SignatureMBR  = 0x01
+	SignatureGPT  = 0x02
+)
+
+// maxNodes limits parsing of malformed or hostile paths.
+const maxNodes = 64
+
+// Node represents a single EFI Device Path node, Data excludes the 4 bytes
+// generic header.
+type Node struct {
+	Type    uint8
+	SubType uint8
+	Data    []byte
+}
+
+// Path represents a device path instance, without the terminating End node.
+type Path []*Node
+
+// Bytes returns the node in its binary form, including the header.
+func (n *Node) Bytes() []byte {
+	buf := make([]byte, 4, 4+len(n.Data))
+
+	buf[0] = n.Type
+	buf[1] = n.SubType
+	binary.LittleEndian.PutUint16(buf[2:], uint16(4+len(n.Data)))
+
+	return append(buf, n.Data...)
+}
+
+// Bytes returns the path in its binary form, terminated by an End Entire
+// Device Path node.
+func (p Path) Bytes() (buf []byte) {
+	for _, n := range p {
+		buf = append(buf, n.Bytes()...)
+	}
+
+	end := &Node{Type: TypeEnd, SubType: SubTypeEndEntire}
+
+	return append(buf, end.Bytes()...)
+}
+
+// Parse decodes a binary device path up to and including the End Entire
+// Device Path node, returning the parsed path and the number of bytes
+// consumed. End Instance nodes are kept in the path so that multi-instance
+// paths round-trip.
+func Parse(buf []byte) (p Path, n int, err error) {
+	for i := 0; ; i++ {
+		if i == maxNodes {
+			return nil, 0, errors.New("device path nodes limit exceeded")
+		}
+
+		if len(buf[n:]) < 4 {
+			return nil, 0, errors.New("device path truncated")
+		}
+
+		typ := buf[n]
+		subType := buf[n+1]
+		length := int(binary.LittleEndian.Uint16(buf[n+2:]))
+
+		if length < 4 || n+length > len(buf) {
+			return nil, 0, fmt.Errorf("invalid device path node length %d", length)
+		}
+
+		if typ == TypeEnd && subType == SubTypeEndEntire {
+			return p, n + length, nil
+		}
+
+		data := make([]byte, length-4)
+		copy(data, buf[n+4:n+length])
+
+		p = append(p, &Node{Type: typ, SubType: subType, Data: data})
+		n += length
+	}
+}
+
+// String returns the text representation of the path.
+func (p Path) String() string {
+	var s strings.Builder
+
+	for i, n := range p {
+		switch {
+		case n.Type == TypeEnd:
+			s.WriteString(",")
+			continue
+		case i > 0 && p[i-1].Type != TypeEnd:
+			s.WriteString("/")
+		}
+
+		s.WriteString(n.String())
+	}
+
+	return s.String()
+}
+
+// File returns the file name of the last File Path node, if any.
+func (p Path) File() string {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i].Type == TypeMedia && p[i].SubType == SubTypeFilePath {
+			return efienc.DecodeString(p[i].Data)
+		}
+	}
+
+	return ""
+}
+
+// HardDrive returns the first Hard Drive media node, if any.
+func (p Path) HardDrive() *HardDrive {
+	for _, n := range p {
+		if hd, err := n.HardDrive(); err == nil {
+			return hd
+		}
+	}
+
+	return nil
+}
+
+// HardDrive represents an EFI Hard Drive Media Device Path node.
+type HardDrive struct {
+	PartitionNumber uint32
+	PartitionStart  uint64
+	PartitionSize   uint64
+	Signature       [16]byte
+	Format          uint8
+	SignatureType   uint8
+}
+
+// HardDrive decodes the node as a Hard Drive Media Device Path.
+func (n *Node) HardDrive() (hd *HardDrive, err error) {
+	if n.Type != TypeMedia || n.SubType != SubTypeHardDrive || len(n.Data) != 38 {
+		return nil, errors.New("not a hard drive node")
+	}
+
+	hd = &HardDrive{
+		PartitionNumber: binary.LittleEndian.Uint32(n.Data[0:]),
+		PartitionStart:  binary.LittleEndian.Uint64(n.Data[4:]),
+		PartitionSize:   binary.LittleEndian.Uint64(n.Data[12:]),
+		Format:          n.Data[36],
+		SignatureType:   n.Data[37],
+	}
+	copy(hd.Signature[:], n.Data[20:36])
+
+	return
+}
+
+// PartitionGUID returns the GPT unique partition GUID in registry format, or
+// an empty string for non GPT partitions.
+func (hd *HardDrive) PartitionGUID() string {
+	if hd.SignatureType != SignatureGPT {
+		return ""
+	}
+
+	return efienc.FormatGUID(hd.Signature[:])
+}
+
+// Node returns the Hard Drive Media Device Path node.
+func (hd *HardDrive) Node() *Node {
+	data := make([]byte, 38)
+
+	binary.LittleEndian.PutUint32(data[0:], hd.PartitionNumber)
+	binary.LittleEndian.PutUint64(data[4:], hd.PartitionStart)
+	binary.LittleEndian.PutUint64(data[12:], hd.PartitionSize)
+	copy(data[20:36], hd.Signature[:])
+	data[36] = hd.Format
+	data[37] = hd.SignatureType
+
+	return &Node{Type: TypeMedia, SubType: SubTypeHardDrive, Data: data}
+}
+
+// FilePath returns a File Path Media Device Path node for the argument name.
+func FilePath(name string) *Node {
+	return &Node{
+		Type:    TypeMedia,
+		SubType: SubTypeFilePath,
+		Data:    efienc.EncodeString(name),
+	}
+}
+
+// String returns the text representation of the node.
+func (n *Node) String() string {
+	d := n.Data
+
+	switch n.Type {
+	case TypeHardware:
+		switch {
+		case n.SubType == 0x01 && len(d) == 2:
+			return fmt.Sprintf("Pci(%#x,%#x)", d[1], d[0])
+		case n.SubType == 0x03 && len(d) == 20:
+			return fmt.Sprintf("MemoryMapped(%#x,%#x,%#x)",
+				binary.LittleEndian.Uint32(d), le64(d[4:]), le64(d[12:]))
+		case n.SubType == 0x04 && len(d) >= 16:
+			return vendor("VenHw", d)
+		case n.SubType == 0x05 && len(d) == 4:
+			return fmt.Sprintf("Ctrl(%#x)", binary.LittleEndian.Uint32(d))
+		}
+	case TypeACPI:
+		switch {
+		case n.SubType == 0x01 && len(d) == 8:
+			return acpi(binary.LittleEndian.Uint32(d), binary.LittleEndian.Uint32(d[4:]))
+		case n.SubType == 0x03 && len(d) >= 4:
+			return fmt.Sprintf("AcpiAdr(%#x)", binary.LittleEndian.Uint32(d))
+		}
+	case TypeMessaging:
+		if s := messaging(n.SubType, d); s != "" {
+			return s
+		}
+	case TypeMedia:
+		if s := media(n.SubType, d); s != "" {
+			return s
+		}
+	case TypeBBS:
+		if n.SubType == 0x01 && len(d) >= 4 {
+			return fmt.Sprintf("BBS(%#x,%s)", binary.LittleEndian.Uint16(d), cString(d[4:]))
+		}
+	case TypeEnd:
+		if n.SubType == SubTypeEndInstance {
+			return ","
+		}
+		return ""
+	}
+
+	return fmt.Sprintf("Path(%d,%d,%s)", n.Type, n.SubType, strings.ToUpper(hex.EncodeToString(d)))
+}
+
+func acpi(hid uint32, uid uint32) string {
+	switch hid {
+	case 0x0a0341d0:
+		return fmt.Sprintf("PciRoot(%#x)", uid)
+	case 0x0a0841d0:
+		return fmt.Sprintf("PcieRoot(%#x)", uid)
+	case 0x060441d0:
+		return fmt.Sprintf("Floppy(%#x)", uid)
+	case 0x030141d0:
+		return fmt.Sprintf("Keyboard(%#x)", uid)
+	case 0x050141d0:
+		return fmt.Sprintf("Serial(%#x)", uid)
+	}
+
+	if hid&0xffff == 0x41d0 {
+		return fmt.Sprintf("Acpi(PNP%04X,%#x)", hid>>16, uid)
+	}
+
+	return fmt.Sprintf("Acpi(%#x,%#x)", hid, uid)
+}
+
+func messaging(subType uint8, d []byte) string {
+	switch {
+	case subType == 0x01 && len(d) == 4:
+		return fmt.Sprintf("Ata(%d,%d,%d)", d[0], d[1], binary.LittleEndian.Uint16(d[2:]))
+	case subType == 0x02 && len(d) == 4:
+		return fmt.Sprintf("Scsi(%#x,%#x)", binary.LittleEndian.Uint16(d), binary.LittleEndian.Uint16(d[2:]))
+	case subType == 0x05 && len(d) == 2:
+		return fmt.Sprintf("USB(%#x,%#x)", d[0], d[1])
+	case subType == 0x0a && len(d) >= 16:
+		return vendor("VenMsg", d)
+	case subType == 0x0b && len(d) == 33:
+		n := 32
+		if d[32] == 0x00 || d[32] == 0x01 {
+			n = 6
+		}
+		return fmt.Sprintf("MAC(%s,%#x)", strings.ToUpper(hex.EncodeToString(d[:n])), d[32])
+	case subType == 0x0c && len(d) >= 19:
+		return fmt.Sprintf("IPv4(%d.%d.%d.%d,%s,%s)",
+			d[4], d[5], d[6], d[7], protocol(binary.LittleEndian.Uint16(d[12:])), ipOrigin(d[14]))
+	case subType == 0x0d && len(d) >= 40:
+		return fmt.Sprintf("IPv6(%s)", hex.EncodeToString(d[16:32]))
+	case subType == 0x0e && len(d) == 15:
+		return fmt.Sprintf("Uart(%d,%d,%d,%d)", le64(d[4:]), d[12], d[13], d[14])
+	case subType == 0x11 && len(d) == 1:
+		return fmt.Sprintf("Unit(%#x)", d[0])
+	case subType == 0x12 && len(d) == 6:
+		return fmt.Sprintf("Sata(%#x,%#x,%#x)",
+			binary.LittleEndian.Uint16(d), binary.LittleEndian.Uint16(d[2:]), binary.LittleEndian.Uint16(d[4:]))
+	case subType == 0x17 && len(d) == 12:
+		eui := make([]string, 8)
+		for i := range eui {
+			eui[i] = fmt.Sprintf("%02X", d[11-i])
+		}
+		return fmt.Sprintf("NVMe(%#x,%s)", binary.LittleEndian.Uint32(d), strings.Join(eui, "-"))
+	case subType == 0x18:
+		return fmt.Sprintf("Uri(%s)", string(d))
+	case subType == 0x1a && len(d) == 1:
+		return fmt.Sprintf("SD(%#x)", d[0])
+	case subType == 0x1d && len(d) == 1:
+		return fmt.Sprintf("eMMC(%#x)", d[0])
+	}
+
+	return ""
+}
+
+func media(subType uint8, d []byte) string {
+	switch {
+	case subType == SubTypeHardDrive && len(d) == 38:
+		hd, _ := (&Node{Type: TypeMedia, SubType: subType, Data: d}).HardDrive()
+
+		var sig string
+
+		switch hd.SignatureType {
+		case SignatureGPT:
+			sig = "GPT," + efienc.FormatGUID(hd.Signature[:])
+		case SignatureMBR:
+			sig = fmt.Sprintf("MBR,%#08x", binary.LittleEndian.Uint32(hd.Signature[:]))
+		default:
+			sig = fmt.Sprintf("%d,0", hd.SignatureType)
+		}
+
+		return fmt.Sprintf("HD(%d,%s,%#x,%#x)", hd.PartitionNumber, sig, hd.PartitionStart, hd.PartitionSize)
+	case subType == SubTypeCDROM && len(d) == 20:
+		return fmt.Sprintf("CDROM(%#x,%#x,%#x)", binary.LittleEndian.Uint32(d), le64(d[4:]), le64(d[12:]))
+	case subType == SubTypeVendor && len(d) >= 16:
+		return vendor("VenMedia", d)
+	case subType == SubTypeFilePath:
+		return efienc.DecodeString(d)
+	case subType == 0x05 && len(d) == 16:
+		return fmt.Sprintf("Media(%s)", efienc.FormatGUID(d))
+	case subType == 0x06 && len(d) == 16:
+		return fmt.Sprintf("FvFile(%s)", efienc.FormatGUID(d))
+	case subType == 0x07 && len(d) == 16:
+		return fmt.Sprintf("Fv(%s)", efienc.FormatGUID(d))
+	case subType == 0x08 && len(d) == 20:
+		return fmt.Sprintf("Offset(%#x,%#x)", le64(d[4:]), le64(d[12:]))
+	case subType == 0x09 && len(d) == 34:
+		return fmt.Sprintf("RamDisk(%#x,%#x,%s,%d)", le64(d), le64(d[8:]), efienc.FormatGUID(d[16:32]), binary.LittleEndian.Uint16(d[32:]))
+	}
+
+	return ""
+}
+
+func vendor(name string, d []byte) string {
+	if len(d) == 16 {
+		return fmt.Sprintf("%s(%s)", name, efienc.FormatGUID(d))
+	}
+
+	return fmt.Sprintf("%s(%s,%s)", name, efienc.FormatGUID(d[:16]), strings.ToUpper(hex.EncodeToString(d[16:])))
+}
+
+func protocol(p uint16) string {
+	switch p {
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	}
+
+	return fmt.Sprintf("%#x", p)
+}
+
+func ipOrigin(static byte) string {
+	if static == 1 {
+		return "Static"
+	}
+
+	return "DHCP"
+}
+
+func le64(b []byte) uint64 {
+	return binary.LittleEndian.Uint64(b)
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,77 @@
+// Package efienc converts the EFI binary encodings of GUIDs and strings.
+//
+// It is the single implementation behind package efivar (which re-exports it
+// for the firmware bindings) and package devpath, which efivar depends on
+// and therefore cannot import efivar itself.
+package efienc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// GUIDSize is the size of a binary GUID.
+const GUIDSize = 16
+
+// FormatGUID returns the registry format of a mixed endian binary GUID, or an
+// empty string when the argument is not a GUID.
+func FormatGUID(b []byte) string {
+	if len(b) != GUIDSize {
+		return ""
+	}
+
+	// https://uefi.org/specs/UEFI/2.10/Apx_A_GUID_and_Time_Formats.html
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16])
+}
+
+// GUIDBytes returns the mixed endian binary form of a registry format GUID,
+// invalid GUIDs return all zeroes.
+func GUIDBytes(s string) []byte {
+	buf := make([]byte, GUIDSize)
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+
+	if err != nil || len(b) != GUIDSize {
+		return buf
+	}
+
+	binary.LittleEndian.PutUint32(buf[0:], binary.BigEndian.Uint32(b[0:]))
+	binary.LittleEndian.PutUint16(buf[4:], binary.BigEndian.Uint16(b[4:]))
+	binary.LittleEndian.PutUint16(buf[6:], binary.BigEndian.Uint16(b[6:]))
+	copy(buf[8:], b[8:])
+
+	return buf
+}
+
+// EncodeString returns the argument as a NUL terminated UTF-16 string.
+func EncodeString(s string) (buf []byte) {
+	for _, r := range utf16.Encode([]rune(s)) {
+		buf = binary.LittleEndian.AppendUint16(buf, r)
+	}
+
+	return append(buf, 0x00, 0x00)
+}
+
+// DecodeString returns the argument UTF-16 string, up to its NUL terminator.
+func DecodeString(buf []byte) string {
+	var s []uint16
+
+	for i := 0; i+1 < len(buf); i += 2 {
+		c := binary.LittleEndian.Uint16(buf[i:])
+
+		if c == 0 {
+			break
+		}
+
+		s = append(s, c)
+	}
+
+	return string(utf16.Decode(s))
+}
@@ -0,0 +1,50 @@
+package efienc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGUID(t *testing.T) {
+	// EFI_GLOBAL_VARIABLE
+	s := "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	b := []byte{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11, 0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+
+	if got := GUIDBytes(s); !bytes.Equal(got, b) {
+		t.Errorf("GUIDBytes: got %x, want %x", got, b)
+	}
+
+	if got := FormatGUID(b); got != s {
+		t.Errorf("FormatGUID: got %s, want %s", got, s)
+	}
+
+	if got := FormatGUID(b[:15]); got != "" {
+		t.Errorf("FormatGUID: got %s for a short GUID", got)
+	}
+
+	if got := GUIDBytes("8be4df61-93ca-11d2-aa0d"); !bytes.Equal(got, make([]byte, GUIDSize)) {
+		t.Errorf("GUIDBytes: got %x for an invalid GUID", got)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []byte
+	}{
+		{"", []byte{0, 0}},
+		{`\EFI`, []byte{'\\', 0, 'E', 0, 'F', 0, 'I', 0, 0, 0}},
+		{"é😀", []byte{0xe9, 0x00, 0x3d, 0xd8, 0x00, 0xde, 0, 0}},
+	} {
+		buf := EncodeString(tt.in)
+
+		if !bytes.Equal(buf, tt.want) {
+			t.Errorf("EncodeString(%q): got %x, want %x", tt.in, buf, tt.want)
+		}
+
+		// trailing data after the terminator is ignored
+		if got := DecodeString(append(buf, 'x', 0)); got != tt.in {
+			t.Errorf("DecodeString: got %q, want %q", got, tt.in)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package efivar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/costinm/uki-stub/pkg/loadopt"
+)
+
+// Boot manager variables.
+const (
+	BootOrder   = "BootOrder"
+	BootNext    = "BootNext"
+	BootCurrent = "BootCurrent"
+)
+
+// maxBootOptions is the number of Boot#### variables.
+const maxBootOptions = 0x10000
+
+// BootOption represents a Boot#### variable.
+type BootOption struct {
+	Num uint16
+	*loadopt.LoadOption
+}
+
+// BootOptionName returns the Boot#### variable name for the argument option
+// number.
+func BootOptionName(num uint16) string {
+	return fmt.Sprintf("Boot%04X", num)
+}
+
+// ParseBootNum parses a hexadecimal boot option number (e.g. 0001).
+func ParseBootNum(s string) (num uint16, err error) {
+	n, err := strconv.ParseUint(s, 16, 16)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid boot option %s", s)
+	}
+
+	return uint16(n), nil
+}
+
+func getUint16s(s Store, name string) (v []uint16, err error) {
+	data, _, err := s.Get(name, GlobalVariable)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	for i := 0; i+1 < len(data); i += 2 {
+		v = append(v, binary.LittleEndian.Uint16(data[i:]))
+	}
+
+	return
+}
+
+func setUint16s(s Store, name string, v []uint16) error {
+	var data []byte
+
+	for _, n := range v {
+		data = binary.LittleEndian.AppendUint16(data, n)
+	}
+
+	return s.Set(name, GlobalVariable, DefaultAttributes, data)
+}
+
+// GetBootOrder returns the BootOrder variable, an empty list is returned when
+// it does not exist.
+func GetBootOrder(s Store) ([]uint16, error) {
+	return getUint16s(s, BootOrder)
+}
+
+// SetBootOrder writes the BootOrder variable.
+func SetBootOrder(s Store, order []uint16) error {
+	return setUint16s(s, BootOrder, order)
+}
+
+// GetBootNext returns the BootNext variable, ErrNotFound is returned when it
+// is not set.
+func GetBootNext(s Store) (num uint16, err error) {
+	v, err := getUint16s(s, BootNext)
+
+	if err != nil {
+		return
+	}
+
+	if len(v) != 1 {
+		return 0, ErrNotFound
+	}
+
+	return v[0], nil
+}
+
+// SetBootNext writes the BootNext variable, selecting the option to be used
+// for the next boot only.
+func SetBootNext(s Store, num uint16) error {
+	return setUint16s(s, BootNext, []uint16{num})
+}
+
+// DeleteBootNext deletes the BootNext variable.
+func DeleteBootNext(s Store) error {
+	if err := s.Set(BootNext, GlobalVariable, 0, nil); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// GetBootOption returns a Boot#### variable.
+func GetBootOption(s Store, num uint16) (*BootOption, error) {
+	data, _, err := s.Get(BootOptionName(num), GlobalVariable)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := loadopt.Parse(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BootOption{Num: num, LoadOption: o}, nil
+}
+
+// SetBootOption writes a Boot#### variable, without changing BootOrder.
+func SetBootOption(s Store, num uint16, o *loadopt.LoadOption) error {
+	data, err := o.Bytes()
+
+	if err != nil {
+		return err
+	}
+
+	return s.Set(BootOptionName(num), GlobalVariable, DefaultAttributes, data)
+}
+
+// bootNums returns the number of all existing Boot#### variables.
+func bootNums(s Store) (nums []uint16, err error) {
+	vars, err := s.List()
+
+	if err != nil {
+		return
+	}
+
+	for _, v := range vars {
+		if v.GUID != GlobalVariable || len(v.Name) != 8 || v.Name[:4] != "Boot" {
+			continue
+		}
+
+		if n, err := ParseBootNum(v.Name[4:]); err == nil {
+			nums = append(nums, n)
+		}
+	}
+
+	slices.Sort(nums)
+
+	return
+}
+
+// AddBootOption writes a new Boot#### variable, using the lowest free number,
+// and inserts it first in BootOrder as efibootmgr does.
+func AddBootOption(s Store, o *loadopt.LoadOption) (num uint16, err error) {
+	nums, err := bootNums(s)
+
+	if err != nil {
+		return
+	}
+
+	free := -1
+
+	for i := 0; i < maxBootOptions; i++ {
+		if !slices.Contains(nums, uint16(i)) {
+			free = i
+			break
+		}
+	}
+
+	if free < 0 {
+		return 0, errors.New("no free boot option")
+	}
+
+	num = uint16(free)
+
+	if err = SetBootOption(s, num, o); err != nil {
+		return
+	}
+
+	order, err := GetBootOrder(s)
+
+	if err != nil {
+		return
+	}
+
+	return num, SetBootOrder(s, append([]uint16{num}, order...))
+}
+
+// DeleteBootOption deletes a Boot#### variable, removing it from BootOrder
+// and clearing BootNext if it points to it. A missing variable is not an
+// error, so that dangling BootOrder and BootNext entries can be removed.
+func DeleteBootOption(s Store, num uint16) (err error) {
+	if err = s.Set(BootOptionName(num), GlobalVariable, 0, nil); err != nil && !errors.Is(err, ErrNotFound) {
+		return
+	}
+
+	order, err := GetBootOrder(s)
+
+	if err != nil {
+		return
+	}
+
+	if i := slices.Index(order, num); i >= 0 {
+		if err = SetBootOrder(s, slices.Delete(order, i, i+1)); err != nil {
+			return
+		}
+	}
+
+	if next, err := GetBootNext(s); err == nil && next == num {
+		return DeleteBootNext(s)
+	}
+
+	return nil
+}
+
+// BootOptions returns all Boot#### variables, those listed in BootOrder
+// first and in order. Variables which cannot be parsed are skipped.
+func BootOptions(s Store) (opts []*BootOption, err error) {
+	nums, err := bootNums(s)
+
+	if err != nil {
+		return
+	}
+
+	order, err := GetBootOrder(s)
+
+	if err != nil {
+		return
+	}
+
+	for _, n := range nums {
+		if !slices.Contains(order, n) {
+			order = append(order, n)
+		}
+	}
+
+	for _, n := range order {
+		if !slices.Contains(nums, n) {
+			continue
+		}
+
+		if o, err := GetBootOption(s, n); err == nil {
+			opts = append(opts, o)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,290 @@
+package efivar
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/loadopt"
+)
+
+// Decoder returns the text representation of a variable value.
+type Decoder func(data []byte) (string, error)
+
+// EFI_SIGNATURE_LIST types.
+const (
+	CertSHA256       GUID = "c1c41626-504c-4092-aca9-41f936934328"
+	CertRSA2048      GUID = "3c5766e8-269c-4e34-aa14-ed776e85b3b6"
+	CertX509         GUID = "a5c059a1-94e4-4aa7-87b5-ab155c2bf072"
+	CertX509SHA256   GUID = "3bd2a492-96c0-4079-b420-fcf98ef103ed"
+	CertX509SHA384   GUID = "7076876e-80c2-4ee6-aad2-28b349a6865b"
+	CertX509SHA512   GUID = "446dbf63-2502-4cda-bcfa-2465d2b0fe9d"
+	CertSHA1         GUID = "826ca512-cf10-4ac9-b187-be01496631bd"
+	CertSHA384       GUID = "ff3e5307-9fd0-48c9-85f1-8ad56c701e01"
+	CertSHA512       GUID = "093e0fae-a6c4-4f50-9f1b-d41e2b89c19a"
+	signatureListLen      = 28
+)
+
+// OsIndications bits.
+const (
+	BootToFWUI                   = 0x0000000000000001
+	TimestampRevocation          = 0x0000000000000002
+	FileCapsuleDeliverySupported = 0x0000000000000004
+	FMPCapsuleSupported          = 0x0000000000000008
+	CapsuleResultVarSupported    = 0x0000000000000010
+	StartOSRecovery              = 0x0000000000000020
+	StartPlatformRecovery        = 0x0000000000000040
+	JSONConfigDataRefresh        = 0x0000000000000080
+)
+
+var signatureTypes = map[GUID]string{
+	CertSHA256:     "SHA256",
+	CertRSA2048:    "RSA2048",
+	CertX509:       "X509",
+	CertX509SHA256: "X509_SHA256",
+	CertX509SHA384: "X509_SHA384",
+	CertX509SHA512: "X509_SHA512",
+	CertSHA1:       "SHA1",
+	CertSHA384:     "SHA384",
+	CertSHA512:     "SHA512",
+}
+
+var osIndications = []string{
+	"BOOT_TO_FW_UI",
+	"TIMESTAMP_REVOCATION",
+	"FILE_CAPSULE_DELIVERY_SUPPORTED",
+	"FMP_CAPSULE_SUPPORTED",
+	"CAPSULE_RESULT_VAR_SUPPORTED",
+	"START_OS_RECOVERY",
+	"START_PLATFORM_RECOVERY",
+	"JSON_CONFIG_DATA_REFRESH",
+}
+
+var loadOptionPattern = regexp.MustCompile(`^(Boot|Driver|SysPrep|PlatformRecovery)[[:xdigit:]]{4}$`)
+
+var globalDecoders = map[string]Decoder{
+	"BootOrder":              decodeOrder,
+	"DriverOrder":            decodeOrder,
+	"SysPrepOrder":           decodeOrder,
+	"BootNext":               decodeUint16,
+	"BootCurrent":            decodeUint16,
+	"Timeout":                decodeUint16,
+	"SecureBoot":             decodeBool,
+	"SetupMode":              decodeBool,
+	"AuditMode":              decodeBool,
+	"DeployedMode":           decodeBool,
+	"VendorKeys":             decodeBool,
+	"PK":                     decodeSignatureLists,
+	"KEK":                    decodeSignatureLists,
+	"PKDefault":              decodeSignatureLists,
+	"KEKDefault":             decodeSignatureLists,
+	"dbDefault":              decodeSignatureLists,
+	"dbxDefault":             decodeSignatureLists,
+	"OsIndications":          decodeOsIndications,
+	"OsIndicationsSupported": decodeOsIndications,
+	"Lang":                   decodeASCII,
+	"LangCodes":              decodeASCII,
+	"PlatformLang":           decodeASCII,
+	"PlatformLangCodes":      decodeASCII,
+	"ConIn":                  decodeDevicePath,
+	"ConOut":                 decodeDevicePath,
+	"ErrOut":                 decodeDevicePath,
+	"ConInDev":               decodeDevicePath,
+	"ConOutDev":              decodeDevicePath,
+	"ErrOutDev":              decodeDevicePath,
+}
+
+var securityDecoders = map[string]Decoder{
+	"db":  decodeSignatureLists,
+	"dbx": decodeSignatureLists,
+	"dbt": decodeSignatureLists,
+	"dbr": decodeSignatureLists,
+}
+
+var loaderDecoders = map[string]Decoder{
+	LoaderDevicePartUUID:  decodeString,
+	LoaderImageIdentifier: decodeString,
+	LoaderFirmwareInfo:    decodeString,
+	LoaderFirmwareType:    decodeString,
+	LoaderTimeInitUSec:    decodeString,
+	LoaderTimeExecUSec:    decodeString,
+	StubInfo:              decodeString,
+	StubFeatures:          decodeUint64,
+	"LoaderInfo":          decodeString,
+	LoaderEntrySelected:   decodeString,
+	LoaderEntryDefault:    decodeString,
+	LoaderEntryOneShot:    decodeString,
+}
+
+var stubDecoders = map[string]Decoder{
+	"StubBootReport": decodeASCII,
+}
+
+// LookupDecoder returns the decoder for a well known variable, or nil when
+// none is available.
+func LookupDecoder(name string, guid GUID) Decoder {
+	switch guid {
+	case GlobalVariable:
+		if loadOptionPattern.MatchString(name) {
+			return decodeLoadOption
+		}
+
+		return globalDecoders[name]
+	case ImageSecurityDatabase:
+		return securityDecoders[name]
+	case LoaderVendor:
+		return loaderDecoders[name]
+	case StubVendor:
+		return stubDecoders[name]
+	}
+
+	return nil
+}
+
+func decodeUint16(data []byte) (string, error) {
+	if len(data) != 2 {
+		return "", errors.New("invalid length")
+	}
+
+	return fmt.Sprintf("%04X", binary.LittleEndian.Uint16(data)), nil
+}
+
+func decodeUint64(data []byte) (string, error) {
+	if len(data) != 8 {
+		return "", errors.New("invalid length")
+	}
+
+	return fmt.Sprintf("%#x", binary.LittleEndian.Uint64(data)), nil
+}
+
+func decodeString(data []byte) (string, error) {
+	return DecodeString(data), nil
+}
+
+func decodeOrder(data []byte) (string, error) {
+	var s []string
+
+	if len(data)%2 != 0 {
+		return "", errors.New("invalid length")
+	}
+
+	for i := 0; i < len(data); i += 2 {
+		s = append(s, fmt.Sprintf("%04X", binary.LittleEndian.Uint16(data[i:])))
+	}
+
+	return strings.Join(s, ","), nil
+}
+
+func decodeBool(data []byte) (string, error) {
+	if len(data) != 1 {
+		return "", errors.New("invalid length")
+	}
+
+	switch data[0] {
+	case 0:
+		return "disabled", nil
+	case 1:
+		return "enabled", nil
+	}
+
+	return fmt.Sprintf("%#x", data[0]), nil
+}
+
+func decodeASCII(data []byte) (string, error) {
+	return strings.TrimRight(string(data), "\x00"), nil
+}
+
+func decodeDevicePath(data []byte) (string, error) {
+	p, _, err := devpath.Parse(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	return p.String(), nil
+}
+
+func decodeOsIndications(data []byte) (string, error) {
+	var s []string
+
+	if len(data) != 8 {
+		return "", errors.New("invalid length")
+	}
+
+	v := binary.LittleEndian.Uint64(data)
+
+	for i, name := range osIndications {
+		if v&(1<<i) != 0 {
+			s = append(s, name)
+		}
+	}
+
+	if rest := v >> len(osIndications); rest != 0 {
+		s = append(s, fmt.Sprintf("%#x", rest<<len(osIndications)))
+	}
+
+	return fmt.Sprintf("%#x %s", v, strings.Join(s, "|")), nil
+}
+
+func decodeLoadOption(data []byte) (string, error) {
+	o, err := loadopt.Parse(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("attr:%#x %s", o.Attributes, o), nil
+}
+
+// decodeSignatureLists summarizes EFI_SIGNATURE_LIST entries, showing the
+// subject of X.509 certificates and the number of other signatures.
+func decodeSignatureLists(data []byte) (string, error) {
+	var s strings.Builder
+
+	for len(data) > 0 {
+		if len(data) < signatureListLen {
+			return "", errors.New("signature list truncated")
+		}
+
+		typ := NewGUID(data[0:16])
+		listSize := int(binary.LittleEndian.Uint32(data[16:]))
+		headerSize := int(binary.LittleEndian.Uint32(data[20:]))
+		sigSize := int(binary.LittleEndian.Uint32(data[24:]))
+
+		if listSize > len(data) || signatureListLen+headerSize > listSize || sigSize < 16 {
+			return "", errors.New("invalid signature list")
+		}
+
+		name, ok := signatureTypes[typ]
+
+		if !ok {
+			name = string(typ)
+		}
+
+		sigs := data[signatureListLen+headerSize : listSize]
+		count := len(sigs) / sigSize
+
+		if typ != CertX509 {
+			fmt.Fprintf(&s, "%s: %d entries\n", name, count)
+		}
+
+		for i := 0; typ == CertX509 && i < count; i++ {
+			sig := sigs[i*sigSize : (i+1)*sigSize]
+			owner := NewGUID(sig[0:16])
+
+			if cert, err := x509.ParseCertificate(sig[16:]); err == nil {
+				fmt.Fprintf(&s, "%s: %s (owner %s)\n", name, cert.Subject, owner)
+			} else {
+				fmt.Fprintf(&s, "%s: <%v> (owner %s)\n", name, err, owner)
+			}
+		}
+
+		data = data[listSize:]
+	}
+
+	return s.String(), nil
+}
@@ -0,0 +1,180 @@
+// Package efivar defines the types shared by all EFI variable stores, along
+// with decoders for well known variables.
+//
+// The same code is used by the stubs, where variables are accessed through
+// EFI Runtime Services, and by Linux tools, where variables are accessed
+// through efivarfs.
+package efivar
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/efienc"
+)
+
+// Variable attributes.
+const (
+	NonVolatile                       = 0x00000001
+	BootserviceAccess                 = 0x00000002
+	RuntimeAccess                     = 0x00000004
+	HardwareErrorRecord               = 0x00000008
+	AuthenticatedWriteAccess          = 0x00000010
+	TimeBasedAuthenticatedWriteAccess = 0x00000020
+	AppendWrite                       = 0x00000040
+)
+
+// Default attributes for variables written by the project.
+const DefaultAttributes = NonVolatile | BootserviceAccess | RuntimeAccess
+
+// Well known vendor GUIDs.
+const (
+	GlobalVariable        GUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	ImageSecurityDatabase GUID = "d719b2cb-3d3a-4596-a3bc-dad00e67656f"
+	ShimLock              GUID = "605dab50-e046-4300-abb6-3dd810dd8b23"
+	LoaderVendor          GUID = "4a67b082-0a4c-41cf-b6c7-440b29bb8c4f"
+	StubVendor            GUID = "aabc54d8-7b8e-5680-9f6c-68da0dbbcdbf" // project vendor
+)
+
+var attrNames = []struct {
+	attr uint32
+	name string
+}{
+	{NonVolatile, "NV"},
+	{BootserviceAccess, "BS"},
+	{RuntimeAccess, "RT"},
+	{HardwareErrorRecord, "HR"},
+	{AuthenticatedWriteAccess, "AW"},
+	{TimeBasedAuthenticatedWriteAccess, "AT"},
+	{AppendWrite, "AP"},
+}
+
+var guidAliases = map[string]GUID{
+	"global":   GlobalVariable,
+	"security": ImageSecurityDatabase,
+	"shim":     ShimLock,
+	"loader":   LoaderVendor,
+	"stub":     StubVendor,
+}
+
+var guidPattern = regexp.MustCompile(`^[[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12}$`)
+
+// ErrNotFound is returned by stores for variables which do not exist.
+var ErrNotFound = errors.New("variable not found")
+
+// GUID represents a vendor GUID in registry format.
+type GUID string
+
+// Variable identifies an EFI variable.
+type Variable struct {
+	Name string
+	GUID GUID
+}
+
+// Store represents an EFI variable store.
+type Store interface {
+	// Get returns the variable data and attributes, or ErrNotFound.
+	Get(name string, guid GUID) (data []byte, attr uint32, err error)
+	// Set writes the variable, empty data deletes it.
+	Set(name string, guid GUID, attr uint32, data []byte) error
+	// List returns all variables.
+	List() ([]Variable, error)
+}
+
+// ParseGUID parses a registry format GUID, or one of the global, security,
+// shim and loader aliases.
+func ParseGUID(s string) (GUID, error) {
+	if g, ok := guidAliases[strings.ToLower(s)]; ok {
+		return g, nil
+	}
+
+	if !guidPattern.MatchString(s) {
+		return "", fmt.Errorf("invalid GUID %s", s)
+	}
+
+	return GUID(strings.ToLower(s)), nil
+}
+
+// NewGUID returns the registry format GUID for its argument mixed endian byte
+// representation.
+func NewGUID(buf []byte) GUID {
+	return GUID(efienc.FormatGUID(buf))
+}
+
+// Bytes returns the GUID mixed endian byte representation.
+func (g GUID) Bytes() []byte {
+	return efienc.GUIDBytes(string(g))
+}
+
+// String returns the GUID alias, if any, or the GUID itself.
+func (g GUID) String() string {
+	for name, guid := range guidAliases {
+		if g == guid {
+			return name
+		}
+	}
+
+	return string(g)
+}
+
+// String returns the variable in Name-GUID form, as used by efivarfs.
+func (v Variable) String() string {
+	return v.Name + "-" + string(v.GUID)
+}
+
+// FormatAttributes returns the text representation of variable attributes
+// (e.g. NV|BS|RT).
+func FormatAttributes(attr uint32) string {
+	var s []string
+
+	for _, a := range attrNames {
+		if attr&a.attr != 0 {
+			s = append(s, a.name)
+			attr &^= a.attr
+		}
+	}
+
+	if attr != 0 {
+		s = append(s, fmt.Sprintf("%#x", attr))
+	}
+
+	return strings.Join(s, "|")
+}
+
+// ParseAttributes parses variable attributes, either as a number or as a
+// list of NV, BS, RT, HR, AW, AT and AP flags separated by `|` or `,`.
+func ParseAttributes(s string) (attr uint32, err error) {
+	if n, err := strconv.ParseUint(s, 0, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		found := false
+
+		for _, a := range attrNames {
+			if strings.EqualFold(f, a.name) {
+				attr |= a.attr
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("invalid attribute %s", f)
+		}
+	}
+
+	return
+}
+
+// EncodeString returns the argument as a NUL terminated UTF-16 string.
+func EncodeString(s string) []byte {
+	return efienc.EncodeString(s)
+}
+
+// DecodeString returns the argument UTF-16 string, up to its NUL terminator.
+func DecodeString(buf []byte) string {
+	return efienc.DecodeString(buf)
+}
@@ -0,0 +1,126 @@
+package efivar
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Boot Loader Interface variables, under the LoaderVendor GUID, see
+// https://systemd.io/BOOT_LOADER_INTERFACE.
+const (
+	LoaderDevicePartUUID  = "LoaderDevicePartUUID"
+	LoaderImageIdentifier = "LoaderImageIdentifier"
+	LoaderFirmwareInfo    = "LoaderFirmwareInfo"
+	LoaderFirmwareType    = "LoaderFirmwareType"
+	LoaderTimeInitUSec    = "LoaderTimeInitUSec"
+	LoaderTimeExecUSec    = "LoaderTimeExecUSec"
+	StubInfo              = "StubInfo"
+	StubFeatures          = "StubFeatures"
+
+	// LoaderEntrySelected is the ID of the booted entry.
+	LoaderEntrySelected = "LoaderEntrySelected"
+	// LoaderEntryDefault is the pattern of the default entry.
+	LoaderEntryDefault = "LoaderEntryDefault"
+	// LoaderEntryOneShot is the pattern of the entry for the next boot
+	// only, it is removed once read.
+	LoaderEntryOneShot = "LoaderEntryOneShot"
+)
+
+// StubFeatures bits, as defined by systemd-stub.
+const (
+	StubFeatureReportBootPartition = 1 << 0
+	StubFeaturePickUpCredentials   = 1 << 1
+	StubFeaturePickUpSysExts       = 1 << 2
+	StubFeatureThreePCRs           = 1 << 3
+	StubFeatureRandomSeed          = 1 << 4
+	StubFeatureCmdlineAddons       = 1 << 5
+	StubFeatureCmdlineSMBIOS       = 1 << 6
+	StubFeatureDevicetreeAddons    = 1 << 7
+)
+
+// LoaderAttributes are the attributes of Boot Loader Interface variables,
+// which are volatile and describe the current boot only.
+const LoaderAttributes = BootserviceAccess | RuntimeAccess
+
+// LoaderInfo represents the Boot Loader Interface variables published by the
+// stubs.
+type LoaderInfo struct {
+	// DevicePartUUID is the GPT partition GUID of the ESP.
+	DevicePartUUID string
+	// ImageIdentifier is the path of the stub image within the ESP.
+	ImageIdentifier string
+	// FirmwareInfo is the firmware vendor and revision.
+	FirmwareInfo string
+	// FirmwareType is the firmware type and specification revision.
+	FirmwareType string
+
+	// TimeInit is the time since CPU reset when the stub started.
+	TimeInit time.Duration
+	// TimeExec is the time since CPU reset when the stub started the kernel.
+	TimeExec time.Duration
+
+	// StubInfo is the stub name and version.
+	StubInfo string
+	// StubFeatures is the StubFeature* bitmask.
+	StubFeatures uint64
+}
+
+func usec(d time.Duration) string {
+	return strconv.FormatInt(d.Microseconds(), 10)
+}
+
+// setString writes a UTF-16 string variable, if not empty and, unless
+// overwrite is set, not already published by a boot loader which
+// chainloaded the stub.
+func setString(s Store, name string, val string, overwrite bool) error {
+	if len(val) == 0 {
+		return nil
+	}
+
+	if !overwrite {
+		if _, _, err := s.Get(name, LoaderVendor); err == nil {
+			return nil
+		}
+	}
+
+	return s.Set(name, LoaderVendor, LoaderAttributes, EncodeString(val))
+}
+
+// PublishLoaderInfo writes the Boot Loader Interface variables. Variables
+// describing the boot loader are left unchanged when already set, so that
+// a boot loader which chainloaded the stub keeps precedence, as done by
+// systemd-stub.
+func PublishLoaderInfo(s Store, info *LoaderInfo) (err error) {
+	var errs []error
+
+	loader := []struct {
+		name string
+		val  string
+	}{
+		{LoaderDevicePartUUID, info.DevicePartUUID},
+		{LoaderImageIdentifier, info.ImageIdentifier},
+		{LoaderFirmwareInfo, info.FirmwareInfo},
+		{LoaderFirmwareType, info.FirmwareType},
+	}
+
+	for _, v := range loader {
+		errs = append(errs, setString(s, v.name, v.val, false))
+	}
+
+	if info.TimeInit > 0 {
+		errs = append(errs, setString(s, LoaderTimeInitUSec, usec(info.TimeInit), false))
+	}
+
+	if info.TimeExec > 0 {
+		errs = append(errs, setString(s, LoaderTimeExecUSec, usec(info.TimeExec), false))
+	}
+
+	errs = append(errs, setString(s, StubInfo, info.StubInfo, true))
+
+	features := binary.LittleEndian.AppendUint64(nil, info.StubFeatures)
+	errs = append(errs, s.Set(StubFeatures, LoaderVendor, LoaderAttributes, features))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,19 @@
+package efivar
+
+// Secure Boot state variables, under the GlobalVariable GUID.
+const (
+	SecureBoot = "SecureBoot"
+	SetupMode  = "SetupMode"
+)
+
+// GetBool returns whether a boolean global variable is set to 1.
+func GetBool(s Store, name string) bool {
+	data, _, err := s.Get(name, GlobalVariable)
+	return err == nil && len(data) == 1 && data[0] == 1
+}
+
+// SecureBootEnabled returns whether firmware enforces Secure Boot, meaning
+// that images loaded through EFI Boot Services are verified against db.
+func SecureBootEnabled(s Store) bool {
+	return GetBool(s, SecureBoot) && !GetBool(s, SetupMode)
+}
@@ -0,0 +1,155 @@
+// Package efivarfs implements efivar.Store over the Linux efivarfs file
+// system, so the OS side reads and writes the same variables as the stubs.
+//
+// Each variable is a file named Name-GUID, whose content is the 4 byte
+// little endian attributes followed by the variable data. Most variables
+// are marked immutable by the kernel, the flag is cleared before writes and
+// deletes and restored afterwards.
+package efivarfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// DefaultPath is the efivarfs mount point.
+const DefaultPath = "/sys/firmware/efi/efivars"
+
+// guidLen is the length of a registry format GUID.
+const guidLen = 36
+
+// attrLen is the size of the attributes prefix.
+const attrLen = 4
+
+// FS represents an efivarfs mount point.
+type FS struct {
+	// Path is the mount point directory.
+	Path string
+}
+
+// New returns an efivarfs store rooted at the argument path, DefaultPath is
+// used when empty.
+func New(path string) *FS {
+	if len(path) == 0 {
+		path = DefaultPath
+	}
+
+	return &FS{Path: path}
+}
+
+func (fs *FS) path(name string, guid efivar.GUID) string {
+	return filepath.Join(fs.Path, efivar.Variable{Name: name, GUID: guid}.String())
+}
+
+// Get implements efivar.Store.Get().
+func (fs *FS) Get(name string, guid efivar.GUID) (data []byte, attr uint32, err error) {
+	buf, err := os.ReadFile(fs.path(name, guid))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, efivar.ErrNotFound
+	}
+
+	if err != nil {
+		return
+	}
+
+	if len(buf) < attrLen {
+		return nil, 0, fmt.Errorf("invalid variable %s, missing attributes", name)
+	}
+
+	return buf[attrLen:], binary.LittleEndian.Uint32(buf), nil
+}
+
+// Set implements efivar.Store.Set(), empty data deletes the variable.
+func (fs *FS) Set(name string, guid efivar.GUID, attr uint32, data []byte) (err error) {
+	path := fs.path(name, guid)
+
+	immutable, err := setImmutable(path, false)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	// restored on failure as well, a deleted variable has no flag to restore
+	if immutable {
+		defer func() {
+			if _, e := setImmutable(path, true); e != nil && !errors.Is(e, os.ErrNotExist) && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if len(data) == 0 {
+		if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			return efivar.ErrNotFound
+		}
+
+		return
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+
+	if attr&efivar.AppendWrite != 0 {
+		flags |= os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+
+	if err != nil {
+		return
+	}
+
+	// efivarfs requires attributes and data in a single write
+	buf := binary.LittleEndian.AppendUint32(nil, attr)
+	buf = append(buf, data...)
+
+	if _, err = f.Write(buf); err != nil {
+		f.Close()
+		return
+	}
+
+	// efivarfs replaces the variable on each write, while a regular file
+	// (e.g. a copy of efivarfs) keeps any stale trailing bytes
+	if flags&os.O_APPEND == 0 {
+		if fi, err := f.Stat(); err == nil && fi.Size() > int64(len(buf)) {
+			if err = f.Truncate(int64(len(buf))); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+
+	return f.Close()
+}
+
+// List implements efivar.Store.List().
+func (fs *FS) List() (vars []efivar.Variable, err error) {
+	entries, err := os.ReadDir(fs.Path)
+
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if e.IsDir() || len(name) < guidLen+2 || name[len(name)-guidLen-1] != '-' {
+			continue
+		}
+
+		guid, err := efivar.ParseGUID(name[len(name)-guidLen:])
+
+		if err != nil {
+			continue
+		}
+
+		vars = append(vars, efivar.Variable{Name: name[:len(name)-guidLen-1], GUID: guid})
+	}
+
+	return
+}
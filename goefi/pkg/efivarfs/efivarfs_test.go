@@ -0,0 +1,221 @@
+package efivarfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/loadopt"
+)
+
+func TestGetSet(t *testing.T) {
+	fs := New(t.TempDir())
+	data := []byte{0x01, 0x02, 0x03}
+
+	if err := fs.Set("Test", efivar.LoaderVendor, efivar.DefaultAttributes, data); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(fs.Path, "Test-4a67b082-0a4c-41cf-b6c7-440b29bb8c4f"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, []byte{0x07, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03}) {
+		t.Fatalf("unexpected file content %x", buf)
+	}
+
+	got, attr, err := fs.Get("Test", efivar.LoaderVendor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attr != efivar.DefaultAttributes || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected variable %#x %x", attr, got)
+	}
+
+	if err = fs.Set("Test", efivar.LoaderVendor, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = fs.Get("Test", efivar.LoaderVendor); !errors.Is(err, efivar.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err = fs.Set("Test", efivar.LoaderVendor, 0, nil); !errors.Is(err, efivar.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	fs := New(t.TempDir())
+
+	if err := fs.Set("Test", efivar.LoaderVendor, efivar.DefaultAttributes, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a regular file gets the attributes appended as well, efivarfs would
+	// merge them
+	if err := fs.Set("Test", efivar.LoaderVendor, efivar.DefaultAttributes|efivar.AppendWrite, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(fs.path("Test", efivar.LoaderVendor))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buf) != 10 || buf[4] != 'a' || buf[9] != 'b' {
+		t.Fatalf("unexpected file content %x", buf)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	fs := New(t.TempDir())
+
+	if err := os.WriteFile(fs.path("Short", efivar.GlobalVariable), []byte{0x07}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := fs.Get("Short", efivar.GlobalVariable); err == nil {
+		t.Fatal("expected error for missing attributes")
+	}
+}
+
+func TestList(t *testing.T) {
+	fs := New(t.TempDir())
+
+	for _, name := range []string{
+		"BootOrder-8be4df61-93ca-11d2-aa0d-00e098032b8c",
+		"Dash-Name-4a67b082-0a4c-41cf-b6c7-440b29bb8c4f",
+		"not-a-variable",
+	} {
+		if err := os.WriteFile(filepath.Join(fs.Path, name), []byte{0x07, 0, 0, 0}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(fs.Path, "dir-8be4df61-93ca-11d2-aa0d-00e098032b8c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := fs.List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []efivar.Variable{
+		{Name: "BootOrder", GUID: efivar.GlobalVariable},
+		{Name: "Dash-Name", GUID: efivar.LoaderVendor},
+	}
+
+	if len(vars) != len(want) {
+		t.Fatalf("unexpected variables %v", vars)
+	}
+
+	for i := range want {
+		if vars[i] != want[i] {
+			t.Fatalf("unexpected variable %v, want %v", vars[i], want[i])
+		}
+	}
+}
+
+func TestBootOptions(t *testing.T) {
+	fs := New(t.TempDir())
+	p := devpath.Path{devpath.FilePath(`\EFI\BOOT\BOOTX64.EFI`)}
+
+	first, err := efivar.AddBootOption(fs, loadopt.New("first", p, nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := efivar.AddBootOption(fs, loadopt.New("second", p, efivar.EncodeString("quiet")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != 0 || second != 1 {
+		t.Fatalf("unexpected boot numbers %d %d", first, second)
+	}
+
+	if err = efivar.SetBootNext(fs, second); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := efivar.BootOptions(fs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts) != 2 || opts[0].Description != "second" || opts[1].Description != "first" {
+		t.Fatalf("unexpected boot options %v", opts)
+	}
+
+	if s := efivar.DecodeString(opts[0].OptionalData); s != "quiet" {
+		t.Fatalf("unexpected optional data %q", s)
+	}
+
+	if opts[0].Path().File() != `\EFI\BOOT\BOOTX64.EFI` {
+		t.Fatalf("unexpected path %s", opts[0].Path())
+	}
+
+	if err = efivar.DeleteBootOption(fs, second); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := efivar.GetBootOrder(fs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 1 || order[0] != first {
+		t.Fatalf("unexpected BootOrder %v", order)
+	}
+
+	if _, err = efivar.GetBootNext(fs); !errors.Is(err, efivar.ErrNotFound) {
+		t.Fatalf("expected BootNext to be deleted, got %v", err)
+	}
+}
+
+func TestDeleteDanglingBootOption(t *testing.T) {
+	fs := New(t.TempDir())
+
+	if err := efivar.SetBootOrder(fs, []uint16{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := efivar.SetBootNext(fs, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Boot0002 does not exist
+	if err := efivar.DeleteBootOption(fs, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := efivar.GetBootOrder(fs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 1 || order[0] != 1 {
+		t.Fatalf("unexpected BootOrder %v", order)
+	}
+
+	if _, err = efivar.GetBootNext(fs); !errors.Is(err, efivar.ErrNotFound) {
+		t.Fatalf("expected BootNext to be deleted, got %v", err)
+	}
+}
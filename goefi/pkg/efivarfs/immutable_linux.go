@@ -0,0 +1,60 @@
+package efivarfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl(2) file attribute requests, see linux/fs.h
+const (
+	fsIocGetFlags = 0x80086601
+	fsIocSetFlags = 0x40086602
+	fsImmutableFl = 0x00000010
+)
+
+func ioctl(fd uintptr, req uintptr, flags *int32) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(flags))); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// setImmutable sets or clears the immutable flag on the argument file,
+// returning whether it was previously set. File systems without flag support
+// (e.g. the temporary directories used by tests) are treated as never
+// immutable.
+func setImmutable(path string, on bool) (was bool, err error) {
+	var flags int32
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if err = ioctl(f.Fd(), fsIocGetFlags, &flags); err != nil {
+		if errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EINVAL) {
+			return false, nil
+		}
+
+		return
+	}
+
+	was = flags&fsImmutableFl != 0
+
+	if was == on {
+		return
+	}
+
+	if on {
+		flags |= fsImmutableFl
+	} else {
+		flags &^= fsImmutableFl
+	}
+
+	return was, ioctl(f.Fd(), fsIocSetFlags, &flags)
+}
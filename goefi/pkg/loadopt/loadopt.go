@@ -0,0 +1,171 @@
+// Package loadopt parses and serializes EFI_LOAD_OPTION descriptors, as
+// found in Boot####, Driver####, SysPrep#### and PlatformRecovery####
+// variables.
+//
+// It has no dependency on the firmware bindings, so the same code is used by
+// the stubs and by Linux tools.
+package loadopt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efienc"
+)
+
+// Load option attributes.
+const (
+	Active         = 0x00000001
+	ForceReconnect = 0x00000002
+	Hidden         = 0x00000008
+	CategoryMask   = 0x00001f00
+	CategoryBoot   = 0x00000000
+	CategoryApp    = 0x00000100
+)
+
+// headerLen is the size of the Attributes and FilePathListLength fields.
+const headerLen = 6
+
+// maxLen is the largest FilePathListLength and device path node length, both
+// 16-bit fields.
+const maxLen = 0xffff
+
+// LoadOption represents an EFI_LOAD_OPTION descriptor.
+type LoadOption struct {
+	Attributes   uint32
+	Description  string
+	FilePathList []devpath.Path
+	OptionalData []byte
+}
+
+// New returns an active load option booting the argument device path.
+func New(description string, path devpath.Path, optionalData []byte) *LoadOption {
+	return &LoadOption{
+		Attributes:   Active,
+		Description:  description,
+		FilePathList: []devpath.Path{path},
+		OptionalData: optionalData,
+	}
+}
+
+// Parse decodes a binary EFI_LOAD_OPTION.
+func Parse(buf []byte) (o *LoadOption, err error) {
+	if len(buf) < headerLen {
+		return nil, errors.New("load option truncated")
+	}
+
+	o = &LoadOption{
+		Attributes: binary.LittleEndian.Uint32(buf[0:]),
+	}
+
+	pathLen := int(binary.LittleEndian.Uint16(buf[4:]))
+	off := headerLen
+
+	var desc []uint16
+
+	for {
+		if off+2 > len(buf) {
+			return nil, errors.New("description not terminated")
+		}
+
+		c := binary.LittleEndian.Uint16(buf[off:])
+		off += 2
+
+		if c == 0 {
+			break
+		}
+
+		desc = append(desc, c)
+	}
+
+	o.Description = string(utf16.Decode(desc))
+
+	if off+pathLen > len(buf) {
+		return nil, fmt.Errorf("invalid file path list length %d", pathLen)
+	}
+
+	paths := buf[off : off+pathLen]
+
+	for len(paths) > 0 {
+		p, n, err := devpath.Parse(paths)
+
+		if err != nil {
+			return nil, err
+		}
+
+		o.FilePathList = append(o.FilePathList, p)
+		paths = paths[n:]
+	}
+
+	if rest := buf[off+pathLen:]; len(rest) > 0 {
+		o.OptionalData = append([]byte{}, rest...)
+	}
+
+	return
+}
+
+// Bytes returns the load option in its binary form, device paths which do
+// not fit the 16-bit length fields return an error.
+func (o *LoadOption) Bytes() ([]byte, error) {
+	var paths []byte
+
+	for _, p := range o.FilePathList {
+		for _, n := range p {
+			if 4+len(n.Data) > maxLen {
+				return nil, fmt.Errorf("device path node length %d exceeds %d", 4+len(n.Data), maxLen)
+			}
+		}
+
+		paths = append(paths, p.Bytes()...)
+	}
+
+	if len(paths) > maxLen {
+		return nil, fmt.Errorf("file path list length %d exceeds %d", len(paths), maxLen)
+	}
+
+	buf := make([]byte, headerLen)
+	binary.LittleEndian.PutUint32(buf[0:], o.Attributes)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(len(paths)))
+
+	buf = append(buf, efienc.EncodeString(o.Description)...)
+	buf = append(buf, paths...)
+
+	return append(buf, o.OptionalData...), nil
+}
+
+// Path returns the first device path, which is the one used to boot the
+// option, or nil if none.
+func (o *LoadOption) Path() devpath.Path {
+	if len(o.FilePathList) == 0 {
+		return nil
+	}
+
+	return o.FilePathList[0]
+}
+
+// Active returns whether the option is active.
+func (o *LoadOption) Active() bool {
+	return o.Attributes&Active != 0
+}
+
+// String returns a one line summary of the load option.
+func (o *LoadOption) String() string {
+	var s strings.Builder
+
+	s.WriteString(o.Description)
+
+	for _, p := range o.FilePathList {
+		s.WriteString(" ")
+		s.WriteString(p.String())
+	}
+
+	if len(o.OptionalData) > 0 {
+		fmt.Fprintf(&s, " [%d bytes]", len(o.OptionalData))
+	}
+
+	return s.String()
+}
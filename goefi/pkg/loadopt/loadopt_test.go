@@ -0,0 +1,128 @@
+package loadopt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+)
+
+// Boot#### variable payloads, without the efivarfs attributes prefix, as
+// created by `efibootmgr -c -d /dev/sda -p 1 -L <label> -l <loader>` (with -u
+// for OptionalData) and by OVMF for its setup application.
+const (
+	bootSystemd = "0100000074004c0069006e0075007800200042006f006f00740020004d0061006e0061006700650072000000" +
+		"04012a000100000000080000000000000000100000000000af3dc60f838472478e793d69d8477de40202" +
+		"040446005c004500460049005c00730079007300740065006d0064005c00730079007300740065006d00" +
+		"64002d0062006f006f0074007800360034002e0065006600690000007fff0400"
+	bootUKI = "010000005c004c0069006e0075007800000004012a000100000000080000000000000000100000000000af3d" +
+		"c60f838472478e793d69d8477de4020204042e005c004500460049005c004c0069006e00750078005c006c" +
+		"0069006e00750078002e0065006600690000007fff040072006f006f0074003d0050004100520054005500" +
+		"5500490044003d0024007b00500041005200540055005500490044003a006c006100620065006c003d0072" +
+		"006f006f0074007d002000710075006900650074000000"
+	bootUiApp = "090100002c005500690041007000700000000407140021aa2c4614760345836e8ab6f466233104061400c9" +
+		"bdb87cebf8344faaea3ee4af6516a17fff0400"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+		attr uint32
+		data []byte
+	}{
+		{
+			in:   bootSystemd,
+			want: `Linux Boot Manager HD(1,GPT,0fc63daf-8483-4772-8e79-3d69d8477de4,0x800,0x100000)/\EFI\systemd\systemd-bootx64.efi`,
+			attr: Active,
+		},
+		{
+			in:   bootUKI,
+			want: `Linux HD(1,GPT,0fc63daf-8483-4772-8e79-3d69d8477de4,0x800,0x100000)/\EFI\Linux\linux.efi [86 bytes]`,
+			attr: Active,
+			data: utf16z("root=PARTUUID=${PARTUUID:label=root} quiet"),
+		},
+		{
+			in:   bootUiApp,
+			want: `UiApp Fv(462caa21-7614-4503-836e-8ab6f4662331)/FvFile(7cb8bdc9-f8eb-4f34-aaea-3ee4af6516a1)`,
+			attr: Active | Hidden | CategoryApp,
+		},
+	} {
+		in, err := hex.DecodeString(tt.in)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		o, err := Parse(in)
+
+		if err != nil {
+			t.Fatalf("%s: %v", tt.want, err)
+		}
+
+		if o.Attributes != tt.attr || !bytes.Equal(o.OptionalData, tt.data) {
+			t.Errorf("%s: unexpected attributes %#x or data %x", tt.want, o.Attributes, o.OptionalData)
+		}
+
+		if got := o.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+
+		out, err := o.Bytes()
+
+		if err != nil {
+			t.Fatalf("%s: %v", tt.want, err)
+		}
+
+		if !bytes.Equal(out, in) {
+			t.Errorf("%s: round trip mismatch\n got %x\nwant %x", tt.want, out, in)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	in, _ := hex.DecodeString(bootSystemd)
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+	}{
+		{"header", in[:4]},
+		{"description", in[:10]},
+		{"path", in[:len(in)-2]},
+	} {
+		if _, err := Parse(tt.in); err == nil {
+			t.Errorf("%s: truncated load option parsed", tt.name)
+		}
+	}
+}
+
+func TestBytesTooLong(t *testing.T) {
+	node := &devpath.Node{Type: devpath.TypeMedia, SubType: devpath.SubTypeVendor, Data: make([]byte, 0x4000)}
+	path := devpath.Path{node, node, node, node}
+
+	if _, err := New("long", path, nil).Bytes(); err == nil {
+		t.Error("file path list over 64 KiB serialized")
+	}
+
+	node.Data = make([]byte, maxLen)
+
+	if _, err := New("long", devpath.Path{node}, nil).Bytes(); err == nil {
+		t.Error("device path node over 64 KiB serialized")
+	}
+
+	node.Data = make([]byte, 0x1000)
+
+	if _, err := New("ok", path, nil).Bytes(); err != nil {
+		t.Error(err)
+	}
+}
+
+func utf16z(s string) (buf []byte) {
+	for _, c := range s + "\x00" {
+		buf = append(buf, byte(c), 0)
+	}
+
+	return
+}
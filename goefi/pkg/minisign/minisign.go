@@ -0,0 +1,163 @@
+// Package minisign verifies minisign detached signatures, the Ed25519 format
+// used by setup-efi to sign boot files, see https://jedisct1.github.io/minisign.
+//
+// Only legacy (non pre-hashed) signatures are supported, as created by
+// minisign -S -l, since pre-hashed signatures require BLAKE2b.
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Signature algorithms.
+const (
+	Legacy    = "Ed"
+	Prehashed = "ED"
+)
+
+const (
+	untrustedPrefix = "untrusted comment:"
+	trustedPrefix   = "trusted comment: "
+)
+
+// PublicKey represents a minisign public key.
+type PublicKey struct {
+	KeyID [8]byte
+	Key   ed25519.PublicKey
+}
+
+// Signature represents a minisign signature file.
+type Signature struct {
+	Algorithm       string
+	KeyID           [8]byte
+	Signature       []byte
+	TrustedComment  string
+	GlobalSignature []byte
+}
+
+// lines returns the lines of a minisign file, without untrusted comments and
+// blank lines. Only line terminators are removed, as the trusted comment is
+// signed verbatim, base64 lines must be trimmed by the caller.
+func lines(buf []byte) (l []string) {
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, untrustedPrefix) {
+			continue
+		}
+
+		l = append(l, line)
+	}
+
+	return
+}
+
+// ParsePublicKey parses a public key, either the base64 line (as found in
+// configurations) or the content of a minisign.pub file.
+func ParsePublicKey(s string) (pk *PublicKey, err error) {
+	l := lines([]byte(s))
+
+	if len(l) != 1 {
+		return nil, errors.New("invalid public key")
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(l[0]))
+
+	if err != nil || len(buf) != 2+8+ed25519.PublicKeySize || string(buf[:2]) != Legacy {
+		return nil, errors.New("invalid public key")
+	}
+
+	pk = &PublicKey{
+		Key: ed25519.PublicKey(buf[10:]),
+	}
+
+	copy(pk.KeyID[:], buf[2:10])
+
+	return
+}
+
+// String returns the key ID, in the format displayed by minisign.
+func (pk *PublicKey) String() string {
+	return fmt.Sprintf("%X", reverse(pk.KeyID[:]))
+}
+
+func reverse(b []byte) (r []byte) {
+	for i := len(b) - 1; i >= 0; i-- {
+		r = append(r, b[i])
+	}
+
+	return
+}
+
+// ParseSignature parses the content of a .minisig file.
+func ParseSignature(buf []byte) (sig *Signature, err error) {
+	l := lines(buf)
+
+	if len(l) != 3 || !strings.HasPrefix(l[1], trustedPrefix) {
+		return nil, errors.New("invalid signature file")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(l[0]))
+
+	if err != nil || len(b) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("invalid signature")
+	}
+
+	sig = &Signature{
+		Algorithm:      string(b[:2]),
+		Signature:      b[10:],
+		TrustedComment: strings.TrimPrefix(l[1], trustedPrefix),
+	}
+
+	copy(sig.KeyID[:], b[2:10])
+
+	if sig.GlobalSignature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(l[2])); err != nil || len(sig.GlobalSignature) != ed25519.SignatureSize {
+		return nil, errors.New("invalid global signature")
+	}
+
+	return
+}
+
+// Verify checks the signature of data, including its trusted comment.
+func (pk *PublicKey) Verify(data []byte, sig *Signature) error {
+	switch {
+	case sig.KeyID != pk.KeyID:
+		return fmt.Errorf("signature key %X does not match %s", reverse(sig.KeyID[:]), pk)
+	case sig.Algorithm == Prehashed:
+		return errors.New("pre-hashed signatures are not supported, sign with minisign -l")
+	case sig.Algorithm != Legacy:
+		return errors.New("unsupported signature algorithm")
+	case !ed25519.Verify(pk.Key, data, sig.Signature):
+		return errors.New("invalid signature")
+	}
+
+	global := append(bytes.Clone(sig.Signature), sig.TrustedComment...)
+
+	if !ed25519.Verify(pk.Key, global, sig.GlobalSignature) {
+		return errors.New("invalid trusted comment signature")
+	}
+
+	return nil
+}
+
+// VerifyAny checks the signature of data against any of the argument keys.
+func VerifyAny(keys []*PublicKey, data []byte, sig []byte) error {
+	s, err := ParseSignature(sig)
+
+	if err != nil {
+		return err
+	}
+
+	for _, pk := range keys {
+		if pk.KeyID == s.KeyID {
+			return pk.Verify(data, s)
+		}
+	}
+
+	return fmt.Errorf("untrusted signature key %X", reverse(s.KeyID[:]))
+}
@@ -0,0 +1,86 @@
+package minisign
+
+import (
+	"strings"
+	"testing"
+)
+
+// Known answer vectors in the minisign -S -l (legacy) format, signing
+// testData with the testKey key pair.
+const (
+	testKey  = "RWQ9HJZeJ4oL9H14BJ+Rd/niguT4IV4q5Y029qYXDe/VUrRHQEtaQOhS"
+	testData = "test data signed with minisign -S -l\n"
+
+	testSig = "untrusted comment: signature from minisign secret key\n" +
+		"RWQ9HJZeJ4oL9FxEaWtR2PZ536Rt9UtlkFScgf0TjRQLLwW3GXPemimj935/KPV3ljT2weQNcLteR/TOuso0Xq8tvRbRMaPH1gE=\n" +
+		"trusted comment: timestamp:1700000000\tfile:test.txt\n" +
+		"RrZuS/y4IC8CT5nyZ+YIwTf/FifwuerV9Ne1eCQLYs8ZPr2dxrUkdGalB1NynNVAk7iNcrhSPe0uLm3a4g3gAA==\n"
+
+	// the trusted comment ends with two spaces, which are signed
+	testSigSpaces = "untrusted comment: signature from minisign secret key\n" +
+		"RWQ9HJZeJ4oL9FxEaWtR2PZ536Rt9UtlkFScgf0TjRQLLwW3GXPemimj935/KPV3ljT2weQNcLteR/TOuso0Xq8tvRbRMaPH1gE=\n" +
+		"trusted comment: timestamp:1700000000\tfile:test.txt  \n" +
+		"xfFzAd48bINAjt7SHoNnMDl0Dnz5MByCktBww/GGsoD7doaL0cp8m8yXK/0QiO8Knftm8bNB/PJlmisL06znAw==\n"
+)
+
+func TestVerify(t *testing.T) {
+	pk, err := ParsePublicKey("untrusted comment: minisign public key F40B8A275E961C3D\n" + testKey + "\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pk.String() != "F40B8A275E961C3D" {
+		t.Errorf("unexpected key ID %s", pk)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data string
+		sig  string
+		err  string
+	}{
+		{"valid", testData, testSig, ""},
+		{"crlf", testData, strings.ReplaceAll(testSig, "\n", "\r\n"), ""},
+		{"trailing spaces", testData, testSigSpaces, ""},
+		{"tampered data", strings.ToUpper(testData), testSig, "invalid signature"},
+		{"tampered comment", testData, strings.Replace(testSig, "test.txt", "evil.txt", 1), "invalid trusted comment signature"},
+		{"trimmed comment", testData, strings.Replace(testSigSpaces, "test.txt  \n", "test.txt\n", 1), "invalid trusted comment signature"},
+		{"extra comment space", testData, strings.Replace(testSig, "test.txt\n", "test.txt \n", 1), "invalid trusted comment signature"},
+	} {
+		err := VerifyAny([]*PublicKey{pk}, []byte(tt.data), []byte(tt.sig))
+
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestTrustedComment(t *testing.T) {
+	sig, err := ParseSignature([]byte(testSigSpaces))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "timestamp:1700000000\tfile:test.txt  "; sig.TrustedComment != want {
+		t.Errorf("got %q, want %q", sig.TrustedComment, want)
+	}
+}
+
+func TestUntrustedKey(t *testing.T) {
+	pk, err := ParsePublicKey(testKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk.KeyID[0] ^= 0xff
+
+	if err = VerifyAny([]*PublicKey{pk}, []byte(testData), []byte(testSig)); err == nil || !strings.HasPrefix(err.Error(), "untrusted signature key") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
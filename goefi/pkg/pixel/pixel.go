@@ -0,0 +1,58 @@
+// Package pixel converts colors to the EFI Graphics Output Protocol
+// framebuffer pixel formats.
+//
+// It has no dependency on the firmware bindings, so the conversions are
+// tested on the host.
+package pixel
+
+import (
+	"math/bits"
+)
+
+// EFI_GRAPHICS_PIXEL_FORMAT
+const (
+	RedGreenBlueReserved8BitPerColor = iota
+	BlueGreenRedReserved8BitPerColor
+	BitMask
+	BltOnly
+)
+
+// Format represents a framebuffer pixel format, the masks are only used by
+// BitMask formats.
+type Format struct {
+	PixelFormat uint32
+	RedMask     uint32
+	GreenMask   uint32
+	BlueMask    uint32
+}
+
+// channel scales an 8-bit color component to a pixel bitmask.
+func channel(v uint8, mask uint32) uint32 {
+	if mask == 0 {
+		return 0
+	}
+
+	shift := bits.TrailingZeros32(mask)
+	n := bits.OnesCount32(mask >> shift)
+
+	if n >= 8 {
+		return uint32(v) << (n - 8) << shift
+	}
+
+	return uint32(v) >> (8 - n) << shift
+}
+
+// Pixel returns an RGB color in the framebuffer pixel format, BltOnly and
+// unknown formats return 0.
+func (f Format) Pixel(r, g, b uint8) uint32 {
+	switch f.PixelFormat {
+	case RedGreenBlueReserved8BitPerColor:
+		return uint32(r) | uint32(g)<<8 | uint32(b)<<16
+	case BlueGreenRedReserved8BitPerColor:
+		return uint32(b) | uint32(g)<<8 | uint32(r)<<16
+	case BitMask:
+		return channel(r, f.RedMask) | channel(g, f.GreenMask) | channel(b, f.BlueMask)
+	}
+
+	return 0
+}
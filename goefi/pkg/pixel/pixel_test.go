@@ -0,0 +1,33 @@
+package pixel
+
+import (
+	"testing"
+)
+
+func TestPixel(t *testing.T) {
+	rgb565 := Format{PixelFormat: BitMask, RedMask: 0xf800, GreenMask: 0x07e0, BlueMask: 0x001f}
+	rgb10 := Format{PixelFormat: BitMask, RedMask: 0x3ff00000, GreenMask: 0x000ffc00, BlueMask: 0x000003ff}
+	bgrMask := Format{PixelFormat: BitMask, RedMask: 0x00ff0000, GreenMask: 0x0000ff00, BlueMask: 0x000000ff}
+
+	for _, tt := range []struct {
+		f       Format
+		r, g, b uint8
+		want    uint32
+	}{
+		{Format{PixelFormat: RedGreenBlueReserved8BitPerColor}, 0x11, 0x22, 0x33, 0x00332211},
+		{Format{PixelFormat: BlueGreenRedReserved8BitPerColor}, 0x11, 0x22, 0x33, 0x00112233},
+		{bgrMask, 0x11, 0x22, 0x33, 0x00112233},
+		{rgb565, 0xff, 0xff, 0xff, 0xffff},
+		{rgb565, 0xff, 0x00, 0x00, 0xf800},
+		{rgb565, 0x00, 0x80, 0x00, 0x0400},
+		{rgb565, 0x00, 0x00, 0x07, 0x0000},
+		{rgb10, 0xff, 0x00, 0x00, 0x3fc00000},
+		{rgb10, 0x00, 0x01, 0x80, 0x00001200},
+		{Format{PixelFormat: BitMask, RedMask: 0xff}, 0x11, 0x22, 0x33, 0x11},
+		{Format{PixelFormat: BltOnly}, 0xff, 0xff, 0xff, 0},
+	} {
+		if got := tt.f.Pixel(tt.r, tt.g, tt.b); got != tt.want {
+			t.Errorf("%+v (%#x,%#x,%#x): got %#x, want %#x", tt.f, tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package placeholder expands the placeholders of signed cmdlines, which
+// refer to values discovered by the stub at boot (e.g. partition GUIDs)
+// rather than to unstable device names.
+//
+// Placeholders are written ${NAME} or ${NAME:arg}. Expansion is strict: an
+// unknown name, a missing value or a value which would alter the cmdline
+// structure (whitespace, quotes, nested placeholders) fails the expansion,
+// so that the stub refuses to boot rather than pass a wrong cmdline.
+package placeholder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Placeholder names.
+const (
+	// ESPPartUUID is the unique partition GUID of the ESP.
+	ESPPartUUID = "ESP_PARTUUID"
+	// Slot is the selected boot slot.
+	Slot = "SLOT"
+	// PartUUID is the unique partition GUID of the GPT partition matching
+	// the argument, label=<name> is the only supported match.
+	PartUUID = "PARTUUID"
+	// SMBIOSUUID is the SMBIOS system UUID.
+	SMBIOSUUID = "SMBIOS_UUID"
+	// SMBIOSSerial is the SMBIOS system serial number.
+	SMBIOSSerial = "SMBIOS_SERIAL"
+)
+
+// Resolver returns the value of a placeholder for its argument, which is
+// empty when not given.
+type Resolver func(arg string) (string, error)
+
+// Resolvers maps placeholder names to their resolver.
+type Resolvers map[string]Resolver
+
+// Value returns a resolver for a placeholder without argument.
+func Value(val string) Resolver {
+	return func(arg string) (string, error) {
+		if len(arg) > 0 {
+			return "", fmt.Errorf("unexpected argument %s", arg)
+		}
+
+		return val, nil
+	}
+}
+
+// Has returns whether s contains placeholders.
+func Has(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// Expand replaces the placeholders of s.
+func Expand(s string, r Resolvers) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.Index(s, "${")
+
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		b.WriteString(s[:i])
+		s = s[i+2:]
+
+		j := strings.IndexByte(s, '}')
+
+		if j < 0 {
+			return "", fmt.Errorf("unterminated placeholder %q", "${"+s)
+		}
+
+		val, err := resolve(s[:j], r)
+
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(val)
+		s = s[j+1:]
+	}
+}
+
+func resolve(p string, r Resolvers) (string, error) {
+	name, arg, _ := strings.Cut(p, ":")
+	fn, ok := r[name]
+
+	if !ok {
+		return "", fmt.Errorf("unknown placeholder ${%s}", p)
+	}
+
+	val, err := fn(arg)
+
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("cannot resolve ${%s}, %v", p, err)
+	case len(val) == 0:
+		return "", fmt.Errorf("cannot resolve ${%s}, no value", p)
+	case strings.ContainsAny(val, " \t\r\n\"'") || Has(val):
+		return "", fmt.Errorf("cannot resolve ${%s}, invalid value %q", p, val)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,106 @@
+package placeholder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	r := Resolvers{
+		ESPPartUUID: Value("0fc63daf-8483-4772-8e79-3d69d8477de4"),
+		Slot:        Value("a"),
+		"EMPTY":     Value(""),
+		"SPACE":     Value("a b"),
+		"TAB":       Value("a\tb"),
+		"NEWLINE":   Value("a\nb"),
+		"DQUOTE":    Value(`a"b`),
+		"SQUOTE":    Value("a'b"),
+		"NESTED":    Value("${SLOT}"),
+		PartUUID: func(arg string) (string, error) {
+			if arg != "label=root" {
+				return "", errors.New("no such partition")
+			}
+
+			return "6a8d1c2e-6b3f-4d4e-9c1a-2f7b8e9d0a1b", nil
+		},
+	}
+
+	for _, tt := range []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "", want: ""},
+		{in: "quiet console=ttyS0", want: "quiet console=ttyS0"},
+		{in: "root=PARTUUID=${ESP_PARTUUID}", want: "root=PARTUUID=0fc63daf-8483-4772-8e79-3d69d8477de4"},
+		{in: "slot=${SLOT} rw slot2=${SLOT}", want: "slot=a rw slot2=a"},
+		{in: "root=PARTUUID=${PARTUUID:label=root}", want: "root=PARTUUID=6a8d1c2e-6b3f-4d4e-9c1a-2f7b8e9d0a1b"},
+		{in: "$SLOT {SLOT} $", want: "$SLOT {SLOT} $"},
+		// unknown names
+		{in: "${UNKNOWN}", err: true},
+		{in: "${}", err: true},
+		{in: "${slot}", err: true},
+		// unterminated
+		{in: "root=${SLOT", err: true},
+		{in: "${", err: true},
+		// resolver errors and missing values
+		{in: "${PARTUUID:label=home}", err: true},
+		{in: "${PARTUUID}", err: true},
+		{in: "${EMPTY}", err: true},
+		// values altering the cmdline structure
+		{in: "${SPACE}", err: true},
+		{in: "${TAB}", err: true},
+		{in: "${NEWLINE}", err: true},
+		{in: "${DQUOTE}", err: true},
+		{in: "${SQUOTE}", err: true},
+		{in: "${NESTED}", err: true},
+		// Value takes no argument
+		{in: "${SLOT:b}", err: true},
+	} {
+		got, err := Expand(tt.in, r)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("Expand(%q) = %q, expected error", tt.in, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expand(%q): %v", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	fn := Value("a")
+
+	if v, err := fn(""); err != nil || v != "a" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+
+	if _, err := fn("x"); err == nil {
+		t.Fatal("expected error for argument")
+	}
+}
+
+func TestHas(t *testing.T) {
+	for in, want := range map[string]bool{
+		"":           false,
+		"quiet":      false,
+		"$SLOT":      false,
+		"${SLOT}":    true,
+		"a=${":       true,
+		"{SLOT} $ {": false,
+	} {
+		if got := Has(in); got != want {
+			t.Errorf("Has(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
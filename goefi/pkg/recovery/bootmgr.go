@@ -0,0 +1,180 @@
+package recovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/loadopt"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name:    "bootmgr",
+		Args:    3,
+		Pattern: regexp.MustCompile(`^bootmgr (list|add|rm|order|next)(?: (\S+))?(?: (.+))?$`),
+		Syntax:  "list | add <vol:\\path> <description> (-- args)? | rm <num> | order <num,...> | next (num|none)",
+		Help:    "manage Boot#### entries, BootOrder and BootNext",
+		Fn:      bootmgrCmd,
+	})
+}
+
+// filePath returns the device path for a `vol:\path` argument, made of the
+// volume device path followed by a File Path node.
+func filePath(arg string) (p devpath.Path, err error) {
+	root, path, err := volumePath(arg)
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	buf, err := x64.UEFI.Boot.DevicePath(root.Handle())
+
+	if err != nil {
+		return
+	}
+
+	if p, _, err = devpath.Parse(buf); err != nil {
+		return
+	}
+
+	return append(p, devpath.FilePath(path)), nil
+}
+
+func bootmgrCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	store := x64.UEFI.Runtime.Variables()
+
+	switch arg[0] {
+	case "list":
+		return bootmgrList(store)
+	case "add":
+		if len(arg[1]) == 0 || len(arg[2]) == 0 {
+			return "", errors.New("missing path or description")
+		}
+
+		return bootmgrAdd(store, arg[1], arg[2])
+	}
+
+	if len(arg[1]) == 0 {
+		return "", errors.New("missing argument")
+	}
+
+	switch arg[0] {
+	case "rm":
+		num, err := efivar.ParseBootNum(arg[1])
+
+		if err != nil {
+			return "", err
+		}
+
+		return "", efivar.DeleteBootOption(store, num)
+	case "next":
+		if arg[1] == "none" {
+			return "", efivar.DeleteBootNext(store)
+		}
+
+		num, err := efivar.ParseBootNum(arg[1])
+
+		if err != nil {
+			return "", err
+		}
+
+		if _, err = efivar.GetBootOption(store, num); err != nil {
+			return "", fmt.Errorf("invalid boot option %s, %v", arg[1], err)
+		}
+
+		return "", efivar.SetBootNext(store, num)
+	}
+
+	var order []uint16
+
+	for _, s := range strings.Split(arg[1], ",") {
+		num, err := efivar.ParseBootNum(s)
+
+		if err != nil {
+			return "", err
+		}
+
+		order = append(order, num)
+	}
+
+	return "", efivar.SetBootOrder(store, order)
+}
+
+func bootmgrList(store efivar.Store) (res string, err error) {
+	var buf bytes.Buffer
+
+	order, err := efivar.GetBootOrder(store)
+
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(&buf, "BootOrder: ")
+
+	for i, n := range order {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		fmt.Fprintf(&buf, "%04X", n)
+	}
+
+	buf.WriteString("\n")
+
+	if n, err := efivar.GetBootNext(store); err == nil {
+		fmt.Fprintf(&buf, "BootNext: %04X\n", n)
+	}
+
+	opts, err := efivar.BootOptions(store)
+
+	if err != nil {
+		return
+	}
+
+	for _, o := range opts {
+		active := " "
+
+		if o.Active() {
+			active = "*"
+		}
+
+		fmt.Fprintf(&buf, "%s%s %s\n", efivar.BootOptionName(o.Num), active, o.LoadOption)
+	}
+
+	return buf.String(), nil
+}
+
+func bootmgrAdd(store efivar.Store, path string, desc string) (res string, err error) {
+	var data []byte
+
+	p, err := filePath(path)
+
+	if err != nil {
+		return
+	}
+
+	// optional data is passed as UTF-16, as efibootmgr -u does, which is what
+	// EFI stubs expect for the kernel command line
+	if d, args, found := strings.Cut(desc, " -- "); found {
+		desc = d
+		data = efivar.EncodeString(args)
+	}
+
+	num, err := efivar.AddBootOption(store, loadopt.New(desc, p, data))
+
+	if err != nil {
+		return
+	}
+
+	return fmt.Sprintf("%s added: %s", efivar.BootOptionName(num), p), nil
+}
@@ -0,0 +1,231 @@
+package recovery
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	uefi "github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name:    "dh",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^dh(?: ([[:xdigit:]]+))?$`),
+		Syntax:  "(index)?",
+		Help:    "list handles and protocols, or show a single handle",
+		Fn:      dhCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "devtree",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^devtree(?: ([[:xdigit:]]+))?$`),
+		Syntax:  "(index)?",
+		Help:    "show controller/children tree",
+		Fn:      devtreeCmd,
+	})
+}
+
+// handleIndex parses a dh/devtree handle index, as printed by `dh`.
+func handleIndex(handles []uint64, arg string) (h uint64, err error) {
+	i, err := strconv.ParseUint(arg, 16, 32)
+
+	if err != nil || i == 0 || int(i) > len(handles) {
+		return 0, fmt.Errorf("invalid handle index %s", arg)
+	}
+
+	return handles[i-1], nil
+}
+
+// devicePathText returns the text device path installed on a handle, or an
+// empty string if none.
+func devicePathText(h uint64) string {
+	buf, err := x64.UEFI.Boot.DevicePath(h)
+
+	if err != nil {
+		return ""
+	}
+
+	p, _, err := devpath.Parse(buf)
+
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+
+	return p.String()
+}
+
+func dhCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var buf bytes.Buffer
+
+	handles, err := x64.UEFI.Boot.LocateHandleBuffer(uefi.AllHandles, "")
+
+	if err != nil {
+		return
+	}
+
+	if len(arg[0]) > 0 {
+		h, err := handleIndex(handles, arg[0])
+
+		if err != nil {
+			return "", err
+		}
+
+		guids, err := x64.UEFI.Boot.ProtocolsPerHandle(h)
+
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&buf, "Handle %s (%#x)\n", arg[0], h)
+
+		for _, g := range guids {
+			fmt.Fprintf(&buf, "  %s %s\n", g, g.Name())
+		}
+
+		if p := devicePathText(h); len(p) > 0 {
+			fmt.Fprintf(&buf, "  DevicePath %s\n", p)
+		}
+
+		return buf.String(), nil
+	}
+
+	for i, h := range handles {
+		var names []string
+
+		guids, err := x64.UEFI.Boot.ProtocolsPerHandle(h)
+
+		if err != nil {
+			fmt.Fprintf(&buf, "%3x: %#x <%v>\n", i+1, h, err)
+			continue
+		}
+
+		for _, g := range guids {
+			names = append(names, g.Name())
+		}
+
+		fmt.Fprintf(&buf, "%3x: %#x %s\n", i+1, h, strings.Join(names, " "))
+
+		if p := devicePathText(h); len(p) > 0 {
+			fmt.Fprintf(&buf, "     %s\n", p)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// children returns, for each handle, the handles of child controllers which
+// opened one of its protocols with EFI_OPEN_PROTOCOL_BY_CHILD_CONTROLLER.
+func children(handles []uint64) (tree map[uint64][]uint64) {
+	tree = make(map[uint64][]uint64)
+
+	for _, h := range handles {
+		guids, err := x64.UEFI.Boot.ProtocolsPerHandle(h)
+
+		if err != nil {
+			continue
+		}
+
+		for _, g := range guids {
+			entries, err := x64.UEFI.Boot.OpenProtocolInformation(h, g)
+
+			if err != nil {
+				continue
+			}
+
+			for _, e := range entries {
+				if e.Attributes&uefi.EFI_OPEN_PROTOCOL_BY_CHILD_CONTROLLER == 0 {
+					continue
+				}
+
+				if e.ControllerHandle == h || slices.Contains(tree[h], e.ControllerHandle) {
+					continue
+				}
+
+				tree[h] = append(tree[h], e.ControllerHandle)
+			}
+		}
+	}
+
+	return
+}
+
+func devtreeCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var buf bytes.Buffer
+	var roots []uint64
+
+	handles, err := x64.UEFI.Boot.LocateHandleBuffer(uefi.AllHandles, "")
+
+	if err != nil {
+		return
+	}
+
+	index := make(map[uint64]int)
+
+	for i, h := range handles {
+		index[h] = i + 1
+	}
+
+	tree := children(handles)
+
+	isChild := make(map[uint64]bool)
+
+	for _, c := range tree {
+		for _, h := range c {
+			isChild[h] = true
+		}
+	}
+
+	if len(arg[0]) > 0 {
+		h, err := handleIndex(handles, arg[0])
+
+		if err != nil {
+			return "", err
+		}
+
+		roots = append(roots, h)
+	} else {
+		// like the UEFI Shell, only list controllers with a device path
+		for _, h := range handles {
+			if !isChild[h] && len(devicePathText(h)) > 0 {
+				roots = append(roots, h)
+			}
+		}
+	}
+
+	var walk func(h uint64, depth int, seen []uint64)
+
+	walk = func(h uint64, depth int, seen []uint64) {
+		p := devicePathText(h)
+
+		if len(p) == 0 {
+			p = fmt.Sprintf("%#x", h)
+		}
+
+		fmt.Fprintf(&buf, "%s%x %s\n", strings.Repeat("  ", depth), index[h], p)
+
+		// guard against firmware reporting loops
+		if slices.Contains(seen, h) {
+			return
+		}
+
+		for _, c := range tree[h] {
+			walk(c, depth+1, append(seen, h))
+		}
+	}
+
+	for _, h := range roots {
+		walk(h, 0, nil)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,506 @@
+package recovery
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	uefi "github.com/costinm/uki-stub/pkg/ueficore"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+const (
+	// maxHexdump is the default number of bytes shown by hexdump.
+	maxHexdump = 512
+	// maxFileSize is the largest file read in memory (e.g. by vars set).
+	maxFileSize = 1 << 20
+	// copyBufferSize is the size of each read when streaming files.
+	copyBufferSize = 64 * 1024
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name: "vol",
+		Help: "list mounted volumes",
+		Fn:   volCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "ls",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^ls(?: (\S+))?$`),
+		Syntax:  "(vol:\\path)?",
+		Help:    "list directory",
+		Fn:      lsCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "cat",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^cat (\S+)$`),
+		Syntax:  "<vol:\\path>",
+		Help:    "show file contents",
+		Fn:      catCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "hexdump",
+		Args:    3,
+		Pattern: regexp.MustCompile(`^hexdump (\S+)(?: (\S+))?(?: (\S+))?$`),
+		Syntax:  "<vol:\\path> (offset)? (length)?",
+		Help:    "show file contents in hex",
+		Fn:      hexdumpCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "cp",
+		Args:    2,
+		Pattern: regexp.MustCompile(`^cp (\S+) (\S+)$`),
+		Syntax:  "<vol:\\src> <vol:\\dst>",
+		Help:    "copy file, across volumes",
+		Fn:      cpCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "rm",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^rm (\S+)$`),
+		Syntax:  "<vol:\\path>",
+		Help:    "delete file or empty directory",
+		Fn:      rmCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "mkdir",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^mkdir (\S+)$`),
+		Syntax:  "<vol:\\path>",
+		Help:    "create directory",
+		Fn:      mkdirCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "sha256sum",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^sha256sum (.+)$`),
+		Syntax:  "<vol:\\path>...",
+		Help:    "show SHA256 of files",
+		Fn:      sha256sumCmd,
+	})
+}
+
+// volumePath resolves a `vol:\path` argument to its volume and path, the
+// volume must be closed once no longer needed.
+//
+// Volumes are named fsN, in firmware order as listed by `vol`, or by their
+// label. The volume of the running image is used when none is given.
+func volumePath(arg string) (root *uefi.FS, path string, err error) {
+	name, path, found := strings.Cut(arg, ":")
+
+	if !found {
+		name, path = "", arg
+	}
+
+	path = strings.ReplaceAll(path, "/", "\\")
+
+	if !strings.HasPrefix(path, "\\") {
+		path = "\\" + path
+	}
+
+	if len(name) == 0 {
+		root, err = x64.UEFI.Root()
+		return
+	}
+
+	volumes, err := x64.UEFI.Volumes()
+
+	if err != nil {
+		return
+	}
+
+	selected := -1
+
+	if n, ok := strings.CutPrefix(strings.ToLower(name), "fs"); ok {
+		if i, err := strconv.Atoi(n); err == nil && i >= 0 && i < len(volumes) {
+			selected = i
+		}
+	}
+
+	for i, v := range volumes {
+		if selected >= 0 {
+			break
+		}
+
+		if info, err := v.Info(); err == nil && strings.EqualFold(info.VolumeLabel, name) {
+			selected = i
+		}
+	}
+
+	for i, v := range volumes {
+		if i != selected {
+			v.Close()
+		}
+	}
+
+	if selected < 0 {
+		return nil, "", fmt.Errorf("volume %s not found", name)
+	}
+
+	return volumes[selected], path, nil
+}
+
+// volumeFile represents a file opened from a `vol:\path` argument, its
+// volume is closed with it.
+type volumeFile struct {
+	*uefi.File
+
+	root *uefi.FS
+	path string
+}
+
+// openFile opens a `vol:\path` argument for reading.
+func openFile(arg string) (f *volumeFile, err error) {
+	root, path, err := volumePath(arg)
+
+	if err != nil {
+		return
+	}
+
+	file, err := root.OpenFile(path, uefi.EFI_FILE_MODE_READ, 0)
+
+	if err != nil {
+		root.Close()
+		return nil, fmt.Errorf("could not open file, %v", err)
+	}
+
+	return &volumeFile{File: file, root: root, path: path}, nil
+}
+
+// Close closes the file and its volume.
+func (f *volumeFile) Close() error {
+	defer f.root.Close()
+	return f.File.Close()
+}
+
+func volCmd(_ *shell.Interface, _ []string) (res string, err error) {
+	var buf bytes.Buffer
+	var boot uint64
+
+	if root, err := x64.UEFI.Root(); err == nil {
+		boot = root.Handle()
+		root.Close()
+	}
+
+	volumes, err := x64.UEFI.Volumes()
+
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		for _, v := range volumes {
+			v.Close()
+		}
+	}()
+
+	for i, v := range volumes {
+		var p string
+
+		mark := " "
+
+		if v.Handle() == boot {
+			mark = "*"
+		}
+
+		if b, err := x64.UEFI.Boot.DevicePath(v.Handle()); err == nil {
+			if dp, _, err := devpath.Parse(b); err == nil {
+				p = dp.String()
+			}
+		}
+
+		info, err := v.Info()
+
+		if err != nil {
+			fmt.Fprintf(&buf, "%sfs%d: <%v> %s\n", mark, i, err, p)
+			continue
+		}
+
+		ro := "rw"
+
+		if info.ReadOnly {
+			ro = "ro"
+		}
+
+		fmt.Fprintf(&buf, "%sfs%d: %-12s %s %10d %10d %s\n", mark, i, info.VolumeLabel, ro, info.VolumeSize, info.FreeSpace, p)
+	}
+
+	return buf.String(), nil
+}
+
+func lsCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var buf bytes.Buffer
+
+	root, path, err := volumePath(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	entries, err := root.ReadDir(path)
+
+	if err != nil {
+		return "", fmt.Errorf("could not read directory, %v", err)
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+
+		if err != nil {
+			return "", err
+		}
+
+		size := fmt.Sprintf("%d", info.Size())
+
+		if info.IsDir() {
+			size = "<DIR>"
+		}
+
+		fmt.Fprintf(&buf, "%s %12s %s\n", info.ModTime().Format("2006-01-02 15:04:05"), size, e.Name())
+	}
+
+	return buf.String(), nil
+}
+
+// readFile reads a `vol:\path` argument in memory, up to maxFileSize.
+func readFile(arg string) (buf []byte, err error) {
+	f, err := openFile(arg)
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	if buf, err = io.ReadAll(io.LimitReader(f, maxFileSize+1)); err != nil {
+		return nil, fmt.Errorf("could not read file, %v", err)
+	}
+
+	if len(buf) > maxFileSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxFileSize)
+	}
+
+	return
+}
+
+func catCmd(iface *shell.Interface, arg []string) (res string, err error) {
+	f, err := openFile(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	if _, err = io.CopyBuffer(iface.Output, f, make([]byte, copyBufferSize)); err != nil {
+		return "", fmt.Errorf("could not read file, %v", err)
+	}
+
+	return
+}
+
+func hexdumpCmd(iface *shell.Interface, arg []string) (res string, err error) {
+	var off uint64
+	var n uint64 = maxHexdump
+
+	if len(arg[1]) > 0 {
+		if off, err = strconv.ParseUint(arg[1], 0, 63); err != nil {
+			return "", fmt.Errorf("invalid offset, %v", err)
+		}
+	}
+
+	if len(arg[2]) > 0 {
+		if n, err = strconv.ParseUint(arg[2], 0, 64); err != nil {
+			return "", fmt.Errorf("invalid length, %v", err)
+		}
+	}
+
+	f, err := openFile(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && off > uint64(info.Size()) {
+		return "", io.EOF
+	}
+
+	if _, err = f.Seek(int64(off), io.SeekStart); err != nil {
+		return "", fmt.Errorf("could not seek, %v", err)
+	}
+
+	// a multiple of the line size, to keep lines aligned
+	buf := make([]byte, 256*16)
+	r := io.LimitReader(f, int64(min(n, math.MaxInt64)))
+
+	for {
+		m, err := io.ReadFull(r, buf)
+
+		if m > 0 {
+			io.WriteString(iface.Output, hexdump(buf[:m], off))
+			off += uint64(m)
+		}
+
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return "", nil
+		case err != nil:
+			return "", fmt.Errorf("could not read file, %v", err)
+		}
+	}
+}
+
+// hexdump returns the canonical hex+ASCII representation of its argument,
+// with offsets starting at off.
+func hexdump(buf []byte, off uint64) string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(buf); i += 16 {
+		line := buf[i:min(i+16, len(buf))]
+		text := []byte(string(line))
+
+		for j, c := range text {
+			if c < 0x20 || c > 0x7e {
+				text[j] = '.'
+			}
+		}
+
+		fmt.Fprintf(&out, "%08x  % -47x  |%s|\n", off+uint64(i), line, text)
+	}
+
+	return out.String()
+}
+
+func cpCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	src, err := openFile(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer src.Close()
+
+	root, path, err := volumePath(arg[1])
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	// copy into directory when the destination is one
+	if f, err := root.Open(path); err == nil {
+		stat, err := f.Stat()
+		f.Close()
+
+		if err == nil && stat.IsDir() {
+			name := arg[0][strings.LastIndexAny(arg[0], "\\/:")+1:]
+			path = strings.TrimSuffix(path, "\\") + "\\" + name
+		}
+	}
+
+	// the destination is truncated before the source is read
+	if root.Handle() == src.root.Handle() && strings.EqualFold(path, src.path) {
+		return "", fmt.Errorf("%s is the source file", path)
+	}
+
+	f, err := root.Create(path)
+
+	if err != nil {
+		return "", fmt.Errorf("could not create file, %v", err)
+	}
+
+	n, err := io.CopyBuffer(f, src, make([]byte, copyBufferSize))
+
+	if err != nil {
+		f.Close()
+		return "", fmt.Errorf("could not copy file, %v", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return
+	}
+
+	return fmt.Sprintf("%d bytes copied to %s", n, path), f.Close()
+}
+
+func rmCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	root, path, err := volumePath(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	return "", root.Remove(path)
+}
+
+func mkdirCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	root, path, err := volumePath(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	return "", root.Mkdir(path)
+}
+
+func sha256sumCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var out bytes.Buffer
+
+	buf := make([]byte, copyBufferSize)
+
+	for _, name := range strings.Fields(arg[0]) {
+		if sum, err := fileSum(name, buf); err != nil {
+			fmt.Fprintf(&out, "%s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&out, "%x  %s\n", sum, name)
+		}
+	}
+
+	return out.String(), nil
+}
+
+// fileSum streams a `vol:\path` argument through SHA256.
+func fileSum(arg string, buf []byte) (sum []byte, err error) {
+	f, err := openFile(arg)
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err = io.CopyBuffer(h, f, buf); err != nil {
+		return nil, fmt.Errorf("could not read file, %v", err)
+	}
+
+	return h.Sum(nil), nil
+}
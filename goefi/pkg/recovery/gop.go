@@ -0,0 +1,84 @@
+package recovery
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name:    "gop",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^gop(?: (\d+))?$`),
+		Syntax:  "(mode)?",
+		Help:    "list graphics modes, or set one",
+		Fn:      gopCmd,
+	})
+}
+
+func gopCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var buf bytes.Buffer
+
+	gop, err := x64.UEFI.Boot.GetGraphicsOutput()
+
+	if err != nil {
+		return
+	}
+
+	if len(arg[0]) > 0 {
+		mode, err := strconv.ParseUint(arg[0], 10, 32)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid mode %s", arg[0])
+		}
+
+		if err = gop.SetMode(uint32(mode)); err != nil {
+			return "", err
+		}
+
+		// the framebuffer console follows the new resolution
+		if x64.Mux.Display != nil {
+			fb, err := gop.NewConsole()
+
+			if err != nil {
+				return "", err
+			}
+
+			x64.Mux.Display = fb
+		}
+	}
+
+	pm, err := gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	modes, err := gop.Modes()
+
+	if err != nil {
+		return
+	}
+
+	for i, mi := range modes {
+		if mi == nil {
+			continue
+		}
+
+		current := " "
+
+		if uint32(i) == pm.Mode {
+			current = "*"
+		}
+
+		fmt.Fprintf(&buf, "%s %3d %s\n", current, i, mi)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,45 @@
+// Package recovery implements the recovery shell commands, to inspect and
+// repair EFI variables, boot options and volumes.
+//
+// The shell is started by the recovery image and, on hotkey, by efiload
+// before booting.
+package recovery
+
+import (
+	"io"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name: "exit",
+		Help: "leave the shell",
+		Fn: func(_ *shell.Interface, _ []string) (string, error) {
+			return "", io.EOF
+		},
+	})
+}
+
+// Start runs the shell on the consoles (see x64.Mux), until the exit
+// command.
+func Start(banner string) {
+	iface := &shell.Interface{
+		Banner: banner,
+	}
+
+	// disable UEFI watchdog
+	x64.UEFI.Boot.SetWatchdogTimer(0)
+
+	// best effort, the current mode is kept on error, the framebuffer
+	// console relies on the graphics mode set by firmware
+	if x64.Mux.Display == nil {
+		x64.UEFI.Console.SetLargestMode()
+	}
+
+	// escape sequences are interpreted on the UEFI console
+	iface.ReadWriter = x64.Mux
+	iface.Start(true)
+}
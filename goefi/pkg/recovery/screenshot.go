@@ -0,0 +1,98 @@
+package recovery
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/bmp"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name:    "screenshot",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^screenshot (\S+)$`),
+		Syntax:  "<vol:\\path.(bmp|png)>",
+		Help:    "save the screen as BMP or PNG, by extension",
+		Fn:      screenshotCmd,
+	})
+}
+
+// screenshotEncoders are the supported image encoders, by file extension.
+var screenshotEncoders = map[string]func(io.Writer, image.Image) error{
+	".bmp": bmp.Encode,
+	".png": png.Encode,
+}
+
+func screenshotCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var ext string
+
+	if i := strings.LastIndexAny(arg[0], ".\\/:"); i >= 0 && arg[0][i] == '.' {
+		ext = strings.ToLower(arg[0][i:])
+	}
+
+	encode, ok := screenshotEncoders[ext]
+
+	if !ok {
+		return "", fmt.Errorf("unsupported format %q, use .bmp or .png", ext)
+	}
+
+	root, path, err := volumePath(arg[0])
+
+	if err != nil {
+		return
+	}
+
+	defer root.Close()
+
+	gop, err := x64.UEFI.Boot.GetGraphicsOutput()
+
+	if err != nil {
+		return
+	}
+
+	screen, err := gop.Screen()
+
+	if err != nil {
+		return "", fmt.Errorf("could not read screen, %v", err)
+	}
+
+	f, err := root.Create(path)
+
+	if err != nil {
+		return "", fmt.Errorf("could not create file, %v", err)
+	}
+
+	// the screen is read while encoding, straight into the file
+	w := bufio.NewWriterSize(f, copyBufferSize)
+
+	if err = encode(w, screen); err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = screen.Err()
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err != nil {
+		f.Remove()
+		return "", fmt.Errorf("could not save screen, %v", err)
+	}
+
+	size, _ := f.Seek(0, io.SeekCurrent)
+	bounds := screen.Bounds()
+
+	return fmt.Sprintf("%dx%d screen saved to %s (%d bytes)", bounds.Dx(), bounds.Dy(), path, size), f.Close()
+}
@@ -0,0 +1,42 @@
+package recovery
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/smbios"
+	"github.com/costinm/uki-stub/pkg/stubcfg"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name: "smbios",
+		Help: "show machine identification, as matched by per-machine config sections",
+		Fn:   smbiosCmd,
+	})
+}
+
+func smbiosCmd(_ *shell.Interface, _ []string) (res string, err error) {
+	var buf bytes.Buffer
+
+	ep, table, err := x64.UEFI.SMBIOS()
+
+	if err != nil {
+		return
+	}
+
+	sys := smbios.ParseSystem(ep, table)
+
+	fmt.Fprintf(&buf, "%-14s %s\n", "Manufacturer", sys.Manufacturer)
+	fmt.Fprintf(&buf, "%-14s %s\n", "Product", sys.Product)
+	fmt.Fprintf(&buf, "%-14s %s\n", "Version", sys.Version)
+	fmt.Fprintf(&buf, "%-14s %s\n", "Board", sys.BoardManufacturer+" "+sys.BoardProduct)
+	fmt.Fprintf(&buf, "\n[%s=%s]\n", stubcfg.MatchUUID, sys.UUID)
+	fmt.Fprintf(&buf, "[%s=%s]\n", stubcfg.MatchSerial, sys.Serial)
+	fmt.Fprintf(&buf, "[%s=%s]\n", stubcfg.MatchProduct, sys.BoardProduct)
+
+	return buf.String(), nil
+}
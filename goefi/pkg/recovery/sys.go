@@ -0,0 +1,267 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package recovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/usbarmory/go-boot/shell"
+	"github.com/usbarmory/tamago/amd64"
+	"github.com/usbarmory/tamago/dma"
+	"github.com/usbarmory/tamago/soc/intel/pci"
+
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+// The commands below are ported from the go-boot built-ins, which depend on
+// the go-boot runtime rather than ueficore.
+
+const maxBufferSize = 102400
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name: "build",
+		Help: "build information",
+		Fn:   buildInfoCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name: "stack",
+		Help: "goroutine stack trace (current)",
+		Fn:   stackCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name: "stackall",
+		Help: "goroutine stack trace (all)",
+		Fn:   stackallCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "date",
+		Args:    1,
+		Pattern: regexp.MustCompile(`^date(.*)`),
+		Syntax:  "(time in RFC339 format)?",
+		Help:    "show/change runtime date and time",
+		Fn:      dateCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name: "uptime",
+		Help: "show time since CPU reset",
+		Fn:   uptimeCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name: "info",
+		Help: "device information",
+		Fn:   infoCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "cpuid",
+		Args:    2,
+		Pattern: regexp.MustCompile(`^cpuid\s+([[:xdigit:]]+) ([[:xdigit:]]+)$`),
+		Syntax:  "<leaf> <subleaf>",
+		Help:    "show CPU capabilities",
+		Fn:      cpuidCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name: "lspci",
+		Help: "list PCI devices",
+		Fn:   lspciCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "peek",
+		Args:    2,
+		Pattern: regexp.MustCompile(`^peek ([[:xdigit:]]+) (\d+)$`),
+		Syntax:  "<hex offset> <size>",
+		Help:    "memory display (use with caution)",
+		Fn:      memReadCmd,
+	})
+
+	shell.Add(shell.Cmd{
+		Name:    "poke",
+		Args:    2,
+		Pattern: regexp.MustCompile(`^poke ([[:xdigit:]]+) ([[:xdigit:]]+)$`),
+		Syntax:  "<hex offset> <hex value>",
+		Help:    "memory write   (use with caution)",
+		Fn:      memWriteCmd,
+	})
+}
+
+func buildInfoCmd(_ *shell.Interface, _ []string) (string, error) {
+	res := new(bytes.Buffer)
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		res.WriteString(bi.String())
+	}
+
+	return res.String(), nil
+}
+
+func stackCmd(_ *shell.Interface, _ []string) (string, error) {
+	return string(debug.Stack()), nil
+}
+
+func stackallCmd(_ *shell.Interface, _ []string) (string, error) {
+	buf := new(bytes.Buffer)
+	pprof.Lookup("goroutine").WriteTo(buf, 1)
+
+	return buf.String(), nil
+}
+
+func dateCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	if len(arg[0]) > 1 {
+		t, err := time.Parse(time.RFC3339, arg[0][1:])
+
+		if err != nil {
+			return "", err
+		}
+
+		x64.AMD64.SetTime(t.UnixNano())
+	}
+
+	return time.Now().Format(time.RFC3339), nil
+}
+
+func uptimeCmd(_ *shell.Interface, _ []string) (string, error) {
+	return x64.Uptime().Round(time.Second).String(), nil
+}
+
+func infoCmd(_ *shell.Interface, _ []string) (string, error) {
+	var res bytes.Buffer
+
+	ramStart, ramEnd := runtime.MemRegion()
+	textStart, textEnd := runtime.TextRegion()
+
+	m := &runtime.MemStats{}
+	runtime.ReadMemStats(m)
+
+	fmt.Fprintf(&res, "Runtime ......: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&res, "RAM ..........: %#08x-%#08x (%d MiB)\n", ramStart, ramEnd, (ramEnd-ramStart)/(1024*1024))
+	fmt.Fprintf(&res, "Text .........: %#08x-%#08x\n", textStart, textEnd)
+	fmt.Fprintf(&res, "Heap .........: %#08x-%#08x Alloc:%d MiB Sys:%d MiB\n", ramStart, ramEnd, m.HeapAlloc/(1024*1024), m.HeapSys/(1024*1024))
+	fmt.Fprintf(&res, "CPU ..........: %s\n", x64.AMD64.Name())
+	fmt.Fprintf(&res, "Cores ........: %d\n", amd64.NumCPU())
+	fmt.Fprintf(&res, "Frequency ....: %v GHz\n", float32(x64.AMD64.Freq())/1e9)
+
+	return res.String(), nil
+}
+
+func cpuidCmd(_ *shell.Interface, arg []string) (string, error) {
+	var res bytes.Buffer
+
+	leaf, err := strconv.ParseUint(arg[0], 16, 32)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid leaf, %v", err)
+	}
+
+	subleaf, err := strconv.ParseUint(arg[1], 10, 32)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid subleaf, %v", err)
+	}
+
+	eax, ebx, ecx, edx := x64.AMD64.CPUID(uint32(leaf), uint32(subleaf))
+
+	fmt.Fprintf(&res, "EAX      EBX      ECX      EDX\n")
+	fmt.Fprintf(&res, "%08x %08x %08x %08x\n", eax, ebx, ecx, edx)
+
+	return res.String(), nil
+}
+
+func lspciCmd(_ *shell.Interface, _ []string) (string, error) {
+	var res bytes.Buffer
+
+	fmt.Fprintf(&res, "Bus Vendor Device Bar0\n")
+
+	for i := 0; i < 256; i++ {
+		for _, d := range pci.Devices(i) {
+			fmt.Fprintf(&res, "%03d %04x   %04x   %#016x\n", i, d.Vendor, d.Device, d.BaseAddress(0))
+		}
+	}
+
+	return res.String(), nil
+}
+
+// memCopy reads size bytes at start, or writes w there when not empty.
+func memCopy(start uint, size int, w []byte) (b []byte) {
+	mem, err := dma.NewRegion(start, size, true)
+
+	if err != nil {
+		panic("could not allocate memory copy DMA")
+	}
+
+	start, buf := mem.Reserve(size, 0)
+	defer mem.Release(start)
+
+	if len(w) > 0 {
+		copy(buf, w)
+	} else {
+		b = make([]byte, size)
+		copy(b, buf)
+	}
+
+	return
+}
+
+func memReadCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	addr, err := strconv.ParseUint(arg[0], 16, 64)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid address, %v", err)
+	}
+
+	size, err := strconv.ParseUint(arg[1], 10, 64)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid size, %v", err)
+	}
+
+	if (addr%8) != 0 || (size%8) != 0 {
+		return "", fmt.Errorf("only 64-bit aligned accesses are supported")
+	}
+
+	if size > maxBufferSize {
+		return "", fmt.Errorf("size argument must be <= %d", maxBufferSize)
+	}
+
+	return hex.Dump(memCopy(uint(addr), int(size), nil)), nil
+}
+
+func memWriteCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	addr, err := strconv.ParseUint(arg[0], 16, 64)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid address, %v", err)
+	}
+
+	val, err := strconv.ParseUint(arg[1], 16, 64)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid data, %v", err)
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, uint32(val))
+
+	memCopy(uint(addr), 8, buf)
+
+	return
+}
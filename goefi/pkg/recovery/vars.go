@@ -0,0 +1,158 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/usbarmory/go-boot/shell"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/ueficore/x64"
+)
+
+func init() {
+	shell.Add(shell.Cmd{
+		Name:    "vars",
+		Args:    5,
+		Pattern: regexp.MustCompile(`^vars (list|get|set|rm)(?: (\S+))?(?: (\S+))?(?: (\S+))?(?: (\S+))?$`),
+		Syntax:  "list (guid)? | get <name> <guid> | set <name> <guid> <attr> <hex:|utf16:|file:value> | rm <name> <guid>",
+		Help:    "EFI variables, guid can be global, security, shim, loader or stub",
+		Fn:      varsCmd,
+	})
+}
+
+// varValue parses a `vars set` value, given as hex:<bytes>, utf16:<string>
+// or file:<vol:\path>.
+func varValue(arg string) (data []byte, err error) {
+	kind, val, _ := strings.Cut(arg, ":")
+
+	switch kind {
+	case "hex":
+		return hex.DecodeString(val)
+	case "utf16":
+		return efivar.EncodeString(val), nil
+	case "file":
+		return readFile(val)
+	}
+
+	return nil, fmt.Errorf("invalid value %s", arg)
+}
+
+func varsCmd(_ *shell.Interface, arg []string) (res string, err error) {
+	var guid efivar.GUID
+
+	store := x64.UEFI.Runtime.Variables()
+
+	switch arg[0] {
+	case "list":
+		if len(arg[1]) > 0 {
+			if guid, err = efivar.ParseGUID(arg[1]); err != nil {
+				return
+			}
+		}
+
+		return varsList(store, guid)
+	}
+
+	if len(arg[1]) == 0 || len(arg[2]) == 0 {
+		return "", errors.New("missing name or guid")
+	}
+
+	name := arg[1]
+
+	if guid, err = efivar.ParseGUID(arg[2]); err != nil {
+		return
+	}
+
+	switch arg[0] {
+	case "get":
+		return varsGet(store, name, guid)
+	case "rm":
+		return "", store.Set(name, guid, 0, nil)
+	}
+
+	if len(arg[3]) == 0 || len(arg[4]) == 0 {
+		return "", errors.New("missing attributes or value")
+	}
+
+	attr, err := efivar.ParseAttributes(arg[3])
+
+	if err != nil {
+		return
+	}
+
+	data, err := varValue(arg[4])
+
+	if err != nil {
+		return
+	}
+
+	return fmt.Sprintf("%d bytes written to %s", len(data), name), store.Set(name, guid, attr, data)
+}
+
+func varsList(store efivar.Store, guid efivar.GUID) (res string, err error) {
+	var buf bytes.Buffer
+
+	vars, err := store.List()
+
+	if err != nil {
+		return
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].GUID != vars[j].GUID {
+			return vars[i].GUID < vars[j].GUID
+		}
+
+		return vars[i].Name < vars[j].Name
+	})
+
+	for _, v := range vars {
+		if len(guid) > 0 && v.GUID != guid {
+			continue
+		}
+
+		data, attr, err := store.Get(v.Name, v.GUID)
+
+		if err != nil {
+			fmt.Fprintf(&buf, "%-36s %-24s <%v>\n", v.GUID, v.Name, err)
+			continue
+		}
+
+		fmt.Fprintf(&buf, "%-36s %-24s %-8s %6d\n", v.GUID, v.Name, efivar.FormatAttributes(attr), len(data))
+	}
+
+	return buf.String(), nil
+}
+
+func varsGet(store efivar.Store, name string, guid efivar.GUID) (res string, err error) {
+	var buf bytes.Buffer
+
+	data, attr, err := store.Get(name, guid)
+
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(&buf, "%s-%s %s %d bytes\n", name, guid, efivar.FormatAttributes(attr), len(data))
+
+	if decode := efivar.LookupDecoder(name, guid); decode != nil {
+		s, err := decode(data)
+
+		if err == nil {
+			fmt.Fprintf(&buf, "%s\n", strings.TrimSuffix(s, "\n"))
+			return buf.String(), nil
+		}
+
+		fmt.Fprintf(&buf, "<%v>\n", err)
+	}
+
+	buf.WriteString(hexdump(data, 0))
+
+	return buf.String(), nil
+}
@@ -0,0 +1,197 @@
+// Package smbios parses the SMBIOS entry point and structure table, to
+// identify the machine the stub runs on, see DMTF DSP0134.
+package smbios
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EFI Configuration Table GUIDs of the entry points.
+const (
+	TableGUID  = "eb9d2d31-2d88-11d3-9a16-0090273fc14d"
+	Table3GUID = "f2fd1544-9794-4a2c-992e-e5bbcf20e394"
+)
+
+// EntryPointSize is the entry point size to read, enough for either version.
+const EntryPointSize = 0x1f
+
+// Structure types.
+const (
+	TypeBIOS      = 0
+	TypeSystem    = 1
+	TypeBaseboard = 2
+	TypeEnd       = 127
+)
+
+// maxStructures limits parsing of malformed tables.
+const maxStructures = 4096
+
+// EntryPoint represents an SMBIOS 2.x or 3.x entry point.
+type EntryPoint struct {
+	Major uint8
+	Minor uint8
+	// TableAddress and TableLength locate the structure table, for 3.x
+	// entry points the length is a maximum.
+	TableAddress uint64
+	TableLength  uint32
+}
+
+// ParseEntryPoint parses an entry point.
+func ParseEntryPoint(buf []byte) (ep *EntryPoint, err error) {
+	switch {
+	case bytes.HasPrefix(buf, []byte("_SM3_")) && len(buf) >= 0x18:
+		return &EntryPoint{
+			Major:        buf[0x07],
+			Minor:        buf[0x08],
+			TableLength:  binary.LittleEndian.Uint32(buf[0x0c:]),
+			TableAddress: binary.LittleEndian.Uint64(buf[0x10:]),
+		}, nil
+	case bytes.HasPrefix(buf, []byte("_SM_")) && len(buf) >= 0x1f:
+		if !bytes.Equal(buf[0x10:0x15], []byte("_DMI_")) {
+			return nil, errors.New("invalid intermediate anchor")
+		}
+
+		return &EntryPoint{
+			Major:        buf[0x06],
+			Minor:        buf[0x07],
+			TableLength:  uint32(binary.LittleEndian.Uint16(buf[0x16:])),
+			TableAddress: uint64(binary.LittleEndian.Uint32(buf[0x18:])),
+		}, nil
+	}
+
+	return nil, errors.New("invalid entry point")
+}
+
+// AtLeast returns whether the entry point version is major.minor or later.
+func (ep *EntryPoint) AtLeast(major, minor uint8) bool {
+	return ep.Major > major || ep.Major == major && ep.Minor >= minor
+}
+
+// Structure represents an SMBIOS structure.
+type Structure struct {
+	Type   uint8
+	Handle uint16
+	// Formatted holds the formatted area, including the header.
+	Formatted []byte
+	Strings   []string
+}
+
+// Parse parses a structure table, up to the End-of-Table structure.
+func Parse(buf []byte) (table []*Structure, err error) {
+	for i := 0; i < maxStructures && len(buf) >= 4; i++ {
+		n := int(buf[1])
+
+		if n < 4 || n > len(buf) {
+			return nil, fmt.Errorf("invalid structure length at %d", i)
+		}
+
+		s := &Structure{
+			Type:      buf[0],
+			Handle:    binary.LittleEndian.Uint16(buf[2:]),
+			Formatted: buf[:n],
+		}
+
+		// strings end with a double NUL
+		end := bytes.Index(buf[n:], []byte{0, 0})
+
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated strings at %d", i)
+		}
+
+		if end > 0 {
+			s.Strings = strings.Split(string(buf[n:n+end]), "\x00")
+		}
+
+		table = append(table, s)
+		buf = buf[n+end+2:]
+
+		if s.Type == TypeEnd {
+			break
+		}
+	}
+
+	return
+}
+
+// String returns the string referenced by the formatted area byte at the
+// argument offset, or an empty string.
+func (s *Structure) String(off int) string {
+	if off >= len(s.Formatted) {
+		return ""
+	}
+
+	i := int(s.Formatted[off])
+
+	if i == 0 || i > len(s.Strings) {
+		return ""
+	}
+
+	return strings.TrimSpace(s.Strings[i-1])
+}
+
+// System represents the machine identification, from the System and
+// Baseboard Information structures.
+type System struct {
+	Manufacturer string
+	Product      string
+	Version      string
+	Serial       string
+	UUID         string
+
+	BoardManufacturer string
+	BoardProduct      string
+	BoardSerial       string
+}
+
+// uuid formats the System UUID, the first three fields are little endian
+// since SMBIOS 2.6 and big endian (network order) before. UUIDs all set to 0
+// or 1 are reported as empty.
+func uuid(b []byte, order binary.ByteOrder) string {
+	if bytes.Count(b, []byte{0}) == 16 || bytes.Count(b, []byte{0xff}) == 16 {
+		return ""
+	}
+
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		order.Uint32(b[0:4]),
+		order.Uint16(b[4:6]),
+		order.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16])
+}
+
+// ParseSystem returns the machine identification of a structure table, the
+// entry point version selects the UUID encoding, a nil entry point assumes a
+// current version.
+func ParseSystem(ep *EntryPoint, table []*Structure) (sys *System) {
+	var order binary.ByteOrder = binary.LittleEndian
+
+	if ep != nil && !ep.AtLeast(2, 6) {
+		order = binary.BigEndian
+	}
+
+	sys = &System{}
+
+	for _, s := range table {
+		switch s.Type {
+		case TypeSystem:
+			sys.Manufacturer = s.String(0x04)
+			sys.Product = s.String(0x05)
+			sys.Version = s.String(0x06)
+			sys.Serial = s.String(0x07)
+
+			if len(s.Formatted) >= 0x18 {
+				sys.UUID = uuid(s.Formatted[0x08:0x18], order)
+			}
+		case TypeBaseboard:
+			sys.BoardManufacturer = s.String(0x04)
+			sys.BoardProduct = s.String(0x05)
+			sys.BoardSerial = s.String(0x07)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,36 @@
+package smbios
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSystemUUID(t *testing.T) {
+	// System Information structure, UUID 4C4C4544-0042-3610-8052-B3C04F564433
+	// as encoded since SMBIOS 2.6, followed by the End-of-Table structure
+	le, _ := hex.DecodeString("011b0001" + "00000000" + "44454c4c420010368052b3c04f564433" + "060000" + "0000" + "7f040100" + "0000")
+	be := append([]byte{}, le...)
+	copy(be[0x08:], []byte{0x4c, 0x4c, 0x45, 0x44, 0x00, 0x42, 0x36, 0x10})
+
+	for _, tt := range []struct {
+		ep   *EntryPoint
+		in   []byte
+		want string
+	}{
+		{&EntryPoint{Major: 3, Minor: 0}, le, "4C4C4544-0042-3610-8052-B3C04F564433"},
+		{&EntryPoint{Major: 2, Minor: 6}, le, "4C4C4544-0042-3610-8052-B3C04F564433"},
+		{nil, le, "4C4C4544-0042-3610-8052-B3C04F564433"},
+		{&EntryPoint{Major: 2, Minor: 4}, be, "4C4C4544-0042-3610-8052-B3C04F564433"},
+		{&EntryPoint{Major: 2, Minor: 4}, le, "44454C4C-4200-1036-8052-B3C04F564433"},
+	} {
+		table, err := Parse(tt.in)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ParseSystem(tt.ep, table).UUID; got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package stubcfg parses the stub configuration, embedded in the stub image
+// as the .cfg section. When Secure Boot is enabled the configuration is
+// covered by the stub signature, which makes it the root of trust for all
+// files loaded by the stub.
+//
+// The format is line based. Signed configurations start with the header
+// also read by the Zig stub:
+//
+//	UKI
+//	<kernel size>
+//	<kernel sha256>
+//	<initrd size>
+//	<initrd sha256>
+//	<cmdline>
+//
+// Legacy unsigned configurations only hold the embedded kernel size and the
+// cmdline:
+//
+//	<kernel size>
+//	<cmdline>
+//
+// In both cases the header is followed by optional key=value lines, lines
+// starting with # are comments and keys may be repeated.
+//
+// Per-machine sections follow the global options, each starting with a
+// [key=value] line matching the SMBIOS identification of a machine (see the
+// Match* keys), e.g.:
+//
+//	[uuid=4C4C4544-0042-3610-8052-B3C04F564433]
+//	cmdline=initos_sidecar=/dev/nvme1n1
+//
+// Cmdlines may refer to values discovered at boot through placeholders (e.g.
+// root=PARTUUID=${PARTUUID:label=root}), see package placeholder.
+package stubcfg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Magic is the first line of signed configurations.
+const Magic = "UKI"
+
+// Option keys.
+const (
+	// SHA256 adds a trusted file digest, in hex.
+	SHA256 = "sha256"
+	// Entries enables Boot Loader Specification entries, from the
+	// argument directory.
+	Entries = "entries"
+	// Default is the entry selected when LoaderEntryDefault is not set.
+	Default = "default"
+	// UKI boots the payload of a Unified Kernel Image, from the argument
+	// ESP path.
+	UKI = "uki"
+	// Microcode adds an early microcode archive, an uncompressed cpio placed
+	// first in the initrd, from the argument ESP path.
+	Microcode = "microcode"
+	// Slot is the default boot slot, see placeholder.Slot.
+	Slot = "slot"
+	// Recovery is the EFI image booted when recovery is requested through
+	// LoadOptions, from the argument ESP path.
+	Recovery = "recovery"
+	// LoadOptions adds LoadOptions keys honored under Secure Boot, as a
+	// comma separated list, see package stubopt.
+	LoadOptions = "load_options"
+	// Timeout is the time, in milliseconds, waited for the hotkey before
+	// booting. The recovery shell is disabled when not set or 0.
+	Timeout = "timeout"
+	// Hotkey is the key starting the recovery shell, esc or a single
+	// character, esc by default.
+	Hotkey = "hotkey"
+	// HotkeySecureBoot, set to 1, honors the hotkey when Secure Boot is
+	// enforced, the system is then reset when the shell is left.
+	HotkeySecureBoot = "hotkey_secureboot"
+	// Console selects the consoles mirroring output and merging input, as
+	// a comma separated list of conout (UEFI text console, default), gop
+	// (text rendered on the framebuffer, replacing conout output), uart
+	// (COM1) and serial (EFI Serial I/O ports). Firmware may already
+	// redirect conout to serial ports, duplicating output.
+	Console = "console"
+	// BaudRate sets the baud rate of uart and serial consoles, firmware
+	// settings are kept when not set.
+	BaudRate = "baud"
+	// GraphicsMode sets the screen resolution, as <width>x<height>.
+	GraphicsMode = "gfx_mode"
+	// Logo is a BMP or PNG image drawn centered on the screen, from the
+	// argument ESP path.
+	Logo = "logo"
+	// Cmdline adds cmdline arguments, in per-machine sections.
+	Cmdline = "cmdline"
+	// AddonKey adds a minisign public key trusted for add-ons, add-ons are
+	// only loaded when at least one key is set.
+	AddonKey = "addon_key"
+	// AddonCmdline adds cmdline keys which add-ons may set, as a comma
+	// separated list.
+	AddonCmdline = "addon_cmdline"
+)
+
+// Per-machine section keys.
+const (
+	// MatchUUID matches the SMBIOS system UUID.
+	MatchUUID = "uuid"
+	// MatchSerial matches the SMBIOS system serial number.
+	MatchSerial = "serial"
+	// MatchProduct matches the SMBIOS baseboard product name.
+	MatchProduct = "product"
+)
+
+// Option represents a key=value configuration line.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// Config represents a stub configuration.
+type Config struct {
+	// Signed is set for configurations with the UKI header.
+	Signed bool
+
+	KernelSize   int
+	KernelSHA256 []byte
+	InitrdSize   int
+	InitrdSHA256 []byte
+	Cmdline      string
+
+	// Options holds the global key=value lines, in order.
+	Options []Option
+	// Sections holds the per-machine sections, in order.
+	Sections []*Section
+}
+
+// Section represents a per-machine section.
+type Section struct {
+	// Key and Value are the section match, from its [key=value] line.
+	Key   string
+	Value string
+
+	Options []Option
+}
+
+// Name returns the section match, as written in its header.
+func (s *Section) Name() string {
+	return s.Key + "=" + s.Value
+}
+
+// All returns all values of a section option, in order.
+func (s *Section) All(key string) (vals []string) {
+	for _, o := range s.Options {
+		if o.Key == key {
+			vals = append(vals, o.Value)
+		}
+	}
+
+	return
+}
+
+// digest parses a hex SHA256 digest, empty or placeholder values (e.g. 0 for
+// a missing initrd) return nil.
+func digest(s string) ([]byte, error) {
+	if len(s) != sha256.Size*2 {
+		return nil, nil
+	}
+
+	return hex.DecodeString(s)
+}
+
+// Parse parses a configuration, up to the first NUL byte which terminates
+// the embedded section.
+func Parse(buf []byte) (c *Config, err error) {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(buf), "\r\n", "\n"), "\n")
+	c = &Config{}
+	n := 2
+
+	if lines[0] == Magic {
+		c.Signed = true
+		n = 6
+	}
+
+	if len(lines) < n {
+		return nil, errors.New("configuration header truncated")
+	}
+
+	if !c.Signed {
+		if c.KernelSize, err = strconv.Atoi(lines[0]); err != nil {
+			return nil, fmt.Errorf("invalid kernel size, %v", err)
+		}
+
+		c.Cmdline = lines[1]
+
+		return c, c.parseOptions(lines[n:], n)
+	}
+
+	if c.KernelSize, err = strconv.Atoi(lines[1]); err != nil {
+		return nil, fmt.Errorf("invalid kernel size, %v", err)
+	}
+
+	if c.KernelSHA256, err = digest(lines[2]); err != nil {
+		return nil, fmt.Errorf("invalid kernel digest, %v", err)
+	}
+
+	if c.InitrdSize, err = strconv.Atoi(lines[3]); err != nil {
+		return nil, fmt.Errorf("invalid initrd size, %v", err)
+	}
+
+	if c.InitrdSHA256, err = digest(lines[4]); err != nil {
+		return nil, fmt.Errorf("invalid initrd digest, %v", err)
+	}
+
+	c.Cmdline = lines[5]
+
+	return c, c.parseOptions(lines[n:], n)
+}
+
+// parseOptions parses the key=value lines following the header, n is the
+// header length for error reporting.
+func (c *Config) parseOptions(lines []string, n int) error {
+	var section *Section
+
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			key, val, found := strings.Cut(line[1:len(line)-1], "=")
+
+			switch key = strings.TrimSpace(key); {
+			case !found:
+				return fmt.Errorf("invalid section at line %d", n+i+1)
+			case key != MatchUUID && key != MatchSerial && key != MatchProduct:
+				return fmt.Errorf("invalid section key %s at line %d", key, n+i+1)
+			}
+
+			section = &Section{Key: key, Value: strings.TrimSpace(val)}
+			c.Sections = append(c.Sections, section)
+
+			continue
+		}
+
+		key, val, found := strings.Cut(line, "=")
+
+		if !found {
+			return fmt.Errorf("invalid option at line %d", n+i+1)
+		}
+
+		o := Option{Key: strings.TrimSpace(key), Value: strings.TrimSpace(val)}
+
+		if section != nil {
+			section.Options = append(section.Options, o)
+		} else {
+			c.Options = append(c.Options, o)
+		}
+	}
+
+	return nil
+}
+
+// Match returns the per-machine sections matching the argument
+// identification, keyed by Match* keys. Values are compared ignoring case
+// and empty values never match.
+func (c *Config) Match(id map[string]string) (sections []*Section) {
+	for _, s := range c.Sections {
+		if v := id[s.Key]; len(v) > 0 && strings.EqualFold(v, s.Value) {
+			sections = append(sections, s)
+		}
+	}
+
+	return
+}
+
+// Get returns the last value of an option, or an empty string.
+func (c *Config) Get(key string) (val string) {
+	for _, o := range c.Options {
+		if o.Key == key {
+			val = o.Value
+		}
+	}
+
+	return
+}
+
+// All returns all values of an option, in order.
+func (c *Config) All(key string) (vals []string) {
+	for _, o := range c.Options {
+		if o.Key == key {
+			vals = append(vals, o.Value)
+		}
+	}
+
+	return
+}
+
+// List returns all values of a comma separated list option, empty items are
+// skipped.
+func (c *Config) List(key string) (vals []string) {
+	for _, s := range c.All(key) {
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				vals = append(vals, v)
+			}
+		}
+	}
+
+	return
+}
+
+// Trusted returns whether the argument SHA256 digest matches the kernel, the
+// initrd or any sha256 option.
+func (c *Config) Trusted(sum []byte) bool {
+	if len(sum) != sha256.Size {
+		return false
+	}
+
+	if bytes.Equal(sum, c.KernelSHA256) || bytes.Equal(sum, c.InitrdSHA256) {
+		return true
+	}
+
+	for _, s := range c.All(SHA256) {
+		if d, err := digest(s); err == nil && bytes.Equal(sum, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify checks the SHA256 digest of a file against Trusted().
+func (c *Config) Verify(name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	return c.VerifySum(name, sum[:])
+}
+
+// VerifySum checks an already computed SHA256 digest against Trusted().
+func (c *Config) VerifySum(name string, sum []byte) error {
+	if !c.Trusted(sum) {
+		return fmt.Errorf("%s digest %x is not trusted", name, sum)
+	}
+
+	return nil
+}
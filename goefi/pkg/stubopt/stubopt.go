@@ -0,0 +1,197 @@
+// Package stubopt parses the stub's own LoadOptions, the arguments set by the
+// firmware boot entry (e.g. efibootmgr --unicode) or the EFI shell.
+//
+// LoadOptions are not covered by any signature, therefore the grammar is
+// strict and only a few keys are defined:
+//
+//	slot=<name>   selects the boot slot
+//	debug=0|1     enables kernel debug output
+//	recovery      boots the recovery image
+//
+// Options are separated by spaces, values are limited to letters, digits and
+// `.`, `_`, `-`, `:`. Anything else invalidates the whole LoadOptions.
+//
+// When Secure Boot is enforced only the keys allowed by the signed
+// configuration are honored.
+package stubopt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// Option keys.
+const (
+	Slot     = "slot"
+	Debug    = "debug"
+	Recovery = "recovery"
+)
+
+// MaxSize is the maximum size of LoadOptions, in bytes.
+const MaxSize = 512
+
+var (
+	keyPattern   = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	valuePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+)
+
+// values holds the value pattern of each key, an empty pattern marks keys
+// which take no value.
+var values = map[string]*regexp.Regexp{
+	Slot:     regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`),
+	Debug:    regexp.MustCompile(`^[01]$`),
+	Recovery: nil,
+}
+
+// Option represents a LoadOptions argument.
+type Option struct {
+	Key   string
+	Value string
+	// Flag is set for arguments without value.
+	Flag bool
+}
+
+// String returns the option as written in LoadOptions.
+func (o Option) String() string {
+	if o.Flag {
+		return o.Key
+	}
+
+	return o.Key + "=" + o.Value
+}
+
+// Ignored represents an option rejected by the policy.
+type Ignored struct {
+	Option
+	Reason string
+}
+
+// Decode returns the argument LoadOptions as a string, they must be UTF-16
+// text optionally terminated by NUL.
+func Decode(buf []byte) (string, error) {
+	var s []uint16
+
+	if len(buf) > MaxSize {
+		return "", fmt.Errorf("size exceeds %d bytes", MaxSize)
+	}
+
+	if len(buf)%2 != 0 {
+		return "", errors.New("not UTF-16 text")
+	}
+
+	for i := 0; i < len(buf); i += 2 {
+		c := binary.LittleEndian.Uint16(buf[i:])
+
+		if c == 0 {
+			if i+2 != len(buf) {
+				return "", errors.New("data after NUL terminator")
+			}
+
+			break
+		}
+
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("invalid character %#04x", c)
+		}
+
+		s = append(s, c)
+	}
+
+	return string(utf16.Decode(s)), nil
+}
+
+// Parse parses LoadOptions text. A leading image path, as passed by the EFI
+// shell, is skipped.
+func Parse(s string) (opts []Option, err error) {
+	args := strings.Fields(s)
+
+	if len(args) > 0 && isImage(args[0]) {
+		args = args[1:]
+	}
+
+	for _, arg := range args {
+		o := Option{}
+		key, value, found := strings.Cut(arg, "=")
+
+		if !keyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid key in %q", arg)
+		}
+
+		if found && !valuePattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid value in %q", arg)
+		}
+
+		if slices.ContainsFunc(opts, func(o Option) bool { return o.Key == key }) {
+			return nil, fmt.Errorf("duplicate key %s", key)
+		}
+
+		o.Key = key
+		o.Value = value
+		o.Flag = !found
+
+		opts = append(opts, o)
+	}
+
+	return
+}
+
+// isImage returns whether the argument is an EFI image path.
+func isImage(arg string) bool {
+	return strings.Contains(arg, "\\") || strings.HasSuffix(strings.ToLower(arg), ".efi")
+}
+
+// Policy represents the rules applied to parsed options.
+type Policy struct {
+	// SecureBoot is set when Secure Boot is enforced.
+	SecureBoot bool
+	// Allowed holds the keys honored under Secure Boot.
+	Allowed []string
+}
+
+// Apply returns the options honored by the policy, all others are returned
+// as ignored along with the reason.
+func (p *Policy) Apply(opts []Option) (honored []Option, ignored []Ignored) {
+	for _, o := range opts {
+		if reason := p.check(o); len(reason) > 0 {
+			ignored = append(ignored, Ignored{Option: o, Reason: reason})
+			continue
+		}
+
+		honored = append(honored, o)
+	}
+
+	return
+}
+
+func (p *Policy) check(o Option) string {
+	pattern, ok := values[o.Key]
+
+	switch {
+	case !ok:
+		return "unknown key"
+	case pattern == nil && !o.Flag:
+		return "unexpected value"
+	case pattern != nil && !pattern.MatchString(o.Value):
+		return "invalid value"
+	case p.SecureBoot && !slices.Contains(p.Allowed, o.Key):
+		return "not allowed under Secure Boot"
+	}
+
+	return ""
+}
+
+// Get returns the value of the argument key, found is set for flags too.
+func Get(opts []Option, key string) (value string, found bool) {
+	for _, o := range opts {
+		if o.Key == key {
+			return o.Value, true
+		}
+	}
+
+	return
+}
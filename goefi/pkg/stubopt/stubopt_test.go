@@ -0,0 +1,224 @@
+package stubopt
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16le returns the argument string as UTF-16LE bytes.
+func utf16le(s string) (buf []byte) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		buf = binary.LittleEndian.AppendUint16(buf, c)
+	}
+
+	return
+}
+
+func TestDecode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   []byte
+		want string
+		err  bool
+	}{
+		{name: "empty", in: nil, want: ""},
+		{name: "text", in: utf16le("slot=a debug=1"), want: "slot=a debug=1"},
+		{name: "terminated", in: utf16le("recovery\x00"), want: "recovery"},
+		{name: "only NUL", in: utf16le("\x00"), want: ""},
+		{name: "odd length", in: append(utf16le("slot=a"), 0), err: true},
+		{name: "single byte", in: []byte{'a'}, err: true},
+		{name: "data after NUL", in: utf16le("slot=a\x00debug=1"), err: true},
+		{name: "NUL after NUL", in: utf16le("slot=a\x00\x00"), err: true},
+		{name: "control character", in: utf16le("slot=a\tdebug=1"), err: true},
+		{name: "newline", in: utf16le("slot=a\n"), err: true},
+		{name: "DEL", in: utf16le("slot=a\x7f"), err: true},
+		{name: "latin-1", in: utf16le("slot=é"), err: true},
+		{name: "surrogate pair", in: utf16le("slot=\U0001f600"), err: true},
+		{name: "ASCII as UTF-8", in: []byte("slot=a"), err: true},
+		{name: "too large", in: utf16le(strings.Repeat("a", MaxSize/2+1)), err: true},
+		{name: "max size", in: utf16le(strings.Repeat("a", MaxSize/2)), want: strings.Repeat("a", MaxSize/2)},
+	} {
+		got, err := Decode(tt.in)
+
+		switch {
+		case tt.err && err == nil:
+			t.Errorf("%s: Decode() = %q, expected error", tt.name, got)
+		case !tt.err && err != nil:
+			t.Errorf("%s: Decode(): %v", tt.name, err)
+		case !tt.err && got != tt.want:
+			t.Errorf("%s: Decode() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []Option
+		err  bool
+	}{
+		{in: "", want: nil},
+		{in: "   ", want: nil},
+		{in: "slot=a", want: []Option{{Key: Slot, Value: "a"}}},
+		{in: "recovery", want: []Option{{Key: Recovery, Flag: true}}},
+		{in: "slot=b  debug=1 recovery", want: []Option{
+			{Key: Slot, Value: "b"},
+			{Key: Debug, Value: "1"},
+			{Key: Recovery, Flag: true},
+		}},
+		// unknown keys are parsed, the policy rejects them
+		{in: "other=1.2:3", want: []Option{{Key: "other", Value: "1.2:3"}}},
+		// leading image path, as passed by the EFI shell
+		{in: `\EFI\BOOT\BOOTX64.EFI slot=a`, want: []Option{{Key: Slot, Value: "a"}}},
+		{in: "efiload.efi recovery", want: []Option{{Key: Recovery, Flag: true}}},
+		{in: `\EFI\efiload.efi`, want: nil},
+		// an image path is only skipped first
+		{in: `slot=a \EFI\efiload.efi`, err: true},
+		// duplicate keys
+		{in: "slot=a slot=b", err: true},
+		{in: "slot=a slot=a", err: true},
+		{in: "recovery recovery", err: true},
+		{in: "slot slot=a", err: true},
+		// invalid keys
+		{in: "Slot=a", err: true},
+		{in: "1slot=a", err: true},
+		{in: "=a", err: true},
+		{in: "sl-ot=a", err: true},
+		{in: "sl.ot", err: true},
+		// invalid values
+		{in: "slot=", err: true},
+		{in: "slot=a/b", err: true},
+		{in: "slot=a=b", err: true},
+		{in: `slot="a"`, err: true},
+		{in: "slot=$a", err: true},
+		{in: "slot=" + strings.Repeat("a", 65), err: true},
+	} {
+		got, err := Parse(tt.in)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, expected error", tt.in, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	opts := []Option{
+		{Key: Slot, Value: "b"},
+		{Key: Debug, Value: "1"},
+		{Key: Recovery, Flag: true},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		policy  Policy
+		opts    []Option
+		honored []string
+		ignored []string
+	}{
+		{
+			name:    "no Secure Boot",
+			policy:  Policy{},
+			opts:    opts,
+			honored: []string{"slot=b", "debug=1", "recovery"},
+		},
+		{
+			name:    "no Secure Boot, allowed list unused",
+			policy:  Policy{Allowed: []string{Slot}},
+			opts:    opts,
+			honored: []string{"slot=b", "debug=1", "recovery"},
+		},
+		{
+			name:    "Secure Boot, nothing allowed",
+			policy:  Policy{SecureBoot: true},
+			opts:    opts,
+			ignored: []string{"slot=b", "debug=1", "recovery"},
+		},
+		{
+			name:    "Secure Boot, slot allowed",
+			policy:  Policy{SecureBoot: true, Allowed: []string{Slot}},
+			opts:    opts,
+			honored: []string{"slot=b"},
+			ignored: []string{"debug=1", "recovery"},
+		},
+		{
+			name:    "Secure Boot, all allowed",
+			policy:  Policy{SecureBoot: true, Allowed: []string{Slot, Debug, Recovery}},
+			opts:    opts,
+			honored: []string{"slot=b", "debug=1", "recovery"},
+		},
+		{
+			name:    "unknown key",
+			policy:  Policy{SecureBoot: true, Allowed: []string{"other"}},
+			opts:    []Option{{Key: "other", Value: "1"}},
+			ignored: []string{"other=1"},
+		},
+		{
+			name:    "invalid values",
+			policy:  Policy{},
+			opts:    []Option{{Key: Debug, Value: "2"}, {Key: Slot, Value: "a.b"}, {Key: Slot, Flag: true}},
+			ignored: []string{"debug=2", "slot=a.b", "slot"},
+		},
+		{
+			name:    "flag with value",
+			policy:  Policy{},
+			opts:    []Option{{Key: Recovery, Value: "1"}},
+			ignored: []string{"recovery=1"},
+		},
+	} {
+		honored, ignored := tt.policy.Apply(tt.opts)
+
+		var gotHonored, gotIgnored []string
+
+		for _, o := range honored {
+			gotHonored = append(gotHonored, o.String())
+		}
+
+		for _, o := range ignored {
+			if len(o.Reason) == 0 {
+				t.Errorf("%s: %s ignored without reason", tt.name, o)
+			}
+
+			gotIgnored = append(gotIgnored, o.String())
+		}
+
+		if !reflect.DeepEqual(gotHonored, tt.honored) {
+			t.Errorf("%s: honored %v, want %v", tt.name, gotHonored, tt.honored)
+		}
+
+		if !reflect.DeepEqual(gotIgnored, tt.ignored) {
+			t.Errorf("%s: ignored %v, want %v", tt.name, gotIgnored, tt.ignored)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	opts := []Option{{Key: Slot, Value: "a"}, {Key: Recovery, Flag: true}}
+
+	if v, found := Get(opts, Slot); !found || v != "a" {
+		t.Errorf("Get(slot) = %q, %v", v, found)
+	}
+
+	if _, found := Get(opts, Recovery); !found {
+		t.Error("Get(recovery) not found")
+	}
+
+	if _, found := Get(opts, Debug); found {
+		t.Error("Get(debug) found")
+	}
+}
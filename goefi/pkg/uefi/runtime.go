@@ -1,20 +1,30 @@
 package uefi
 
 import (
-	_ "unsafe"
+	"time"
 )
 
-//  // go:linkname gosched runtime.Gosched
-//func gosched()
+// Park, when set, blocks the calling goroutine until the argument event is
+// signaled (e.g. x64.Idle.Park), without stalling other goroutines.
+var Park func(event EFI_EVENT)
 
 // WaitForEvent blocks execution while yielding to other goroutines which differs
 // from BS().WaitForEvent, which is a hard-block; the CPU is entirely stalled.
+//
+// Between checks the goroutine is parked on the event (see Park), or sleeps
+// when no Park hook is set.
 func WaitForEvent(event EFI_EVENT) {
 	for {
 		status := BS().CheckEvent(event)
 		if status == EFI_SUCCESS {
 			return
 		}
-		//gosched()
+
+		if Park != nil {
+			Park(event)
+			continue
+		}
+
+		time.Sleep(time.Millisecond)
 	}
 }
@@ -0,0 +1,460 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const esc = 0x1b
+
+// ansiCursor maps scan codes to xterm cursor key sequences (CSI <final>).
+var ansiCursor = map[uint16]byte{
+	SCAN_UP:    'A',
+	SCAN_DOWN:  'B',
+	SCAN_RIGHT: 'C',
+	SCAN_LEFT:  'D',
+	SCAN_HOME:  'H',
+	SCAN_END:   'F',
+}
+
+// ansiFunction maps scan codes to SS3 function key sequences (SS3 <final>).
+var ansiFunction = map[uint16]byte{
+	SCAN_F1:     'P',
+	SCAN_F1 + 1: 'Q',
+	SCAN_F1 + 2: 'R',
+	SCAN_F1 + 3: 'S',
+}
+
+// ansiTilde maps scan codes to VT220 editing and function key sequences
+// (CSI <n> ~).
+var ansiTilde = map[uint16]int{
+	SCAN_INSERT:    2,
+	SCAN_DELETE:    3,
+	SCAN_PAGE_UP:   5,
+	SCAN_PAGE_DOWN: 6,
+	SCAN_F1 + 4:    15,
+	SCAN_F1 + 5:    17,
+	SCAN_F1 + 6:    18,
+	SCAN_F1 + 7:    19,
+	SCAN_F1 + 8:    20,
+	SCAN_F10:       21,
+	SCAN_F11:       23,
+	SCAN_F12:       24,
+}
+
+// ansiKey returns the keystroke as sent by an xterm compatible terminal,
+// which VT100 line editors (e.g. golang.org/x/term) expect.
+//
+// Escape is discarded, as alone it cannot be told apart from the start of a
+// sequence.
+func ansiKey(k *KeyData) (seq []byte) {
+	mod := 1
+
+	if k.Shift() {
+		mod += 1
+	}
+
+	if k.Alt() {
+		mod += 2
+	}
+
+	if k.Ctrl() {
+		mod += 4
+	}
+
+	s := k.Key.ScanCode
+
+	if s == SCAN_NULL {
+		return ansiChar(k)
+	}
+
+	if c, ok := ansiCursor[s]; ok {
+		if mod > 1 {
+			return []byte{esc, '[', '1', ';', byte('0' + mod), c}
+		}
+
+		return []byte{esc, '[', c}
+	}
+
+	if c, ok := ansiFunction[s]; ok {
+		if mod > 1 {
+			return []byte{esc, '[', '1', ';', byte('0' + mod), c}
+		}
+
+		return []byte{esc, 'O', c}
+	}
+
+	if n, ok := ansiTilde[s]; ok {
+		seq = append([]byte{esc, '['}, strconv.Itoa(n)...)
+
+		if mod > 1 {
+			seq = append(seq, ';', byte('0'+mod))
+		}
+
+		return append(seq, '~')
+	}
+
+	return
+}
+
+// ansiChar returns a character keystroke as UTF-8, with backspace sent as
+// DEL, Ctrl letters as control characters and Alt prefixed with Escape.
+func ansiChar(k *KeyData) (seq []byte) {
+	c := k.Char()
+
+	switch {
+	case c == null:
+		return
+	case c == bs:
+		c = del
+	case k.Ctrl() && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'):
+		c &= 0x1f
+	}
+
+	if k.Alt() {
+		seq = append(seq, esc)
+	}
+
+	return utf8.AppendRune(seq, c)
+}
+
+// maxSequence is the longest output escape sequence interpreted, longer ones
+// are discarded.
+const maxSequence = 32
+
+// ansiColors maps ANSI color indices to EFI text colors.
+var ansiColors = [8]uint64{
+	EFI_BLACK,
+	EFI_RED,
+	EFI_GREEN,
+	EFI_BROWN,
+	EFI_BLUE,
+	EFI_MAGENTA,
+	EFI_CYAN,
+	EFI_LIGHTGRAY,
+}
+
+// screen represents a text output driven by escape sequences, with EFI
+// Simple Text Output semantics: the cursor wraps after the last column and
+// ClearScreen homes it.
+type screen interface {
+	Size() (columns int, rows int, err error)
+	Cursor() (column int, row int, err error)
+	Attribute() (attr uint64, err error)
+	SetCursorPosition(column int, row int) error
+	SetAttribute(attr uint64) error
+	EnableCursor(visible bool) error
+	ClearScreen() error
+
+	// text outputs UTF-8 text, without escape sequences
+	text(p []byte) error
+}
+
+// terminal interprets ANSI escape sequences written to a screen.
+//
+// The following sequences are supported:
+//
+//	ESC 7, ESC 8            save, restore cursor position
+//	CSI n A/B/C/D           cursor up, down, forward, back
+//	CSI n G                 cursor column
+//	CSI r ; c H/f           cursor position
+//	CSI n J                 erase display
+//	CSI n K                 erase line
+//	CSI n ; ... m           select graphic rendition (colors, bold)
+//	CSI s, CSI u            save, restore cursor position
+//	CSI ? 25 h/l            show, hide cursor
+//
+// Others are discarded. Errors are ignored, as not all firmware consoles
+// implement all services.
+type terminal struct {
+	// seq holds an incomplete escape sequence
+	seq []byte
+	// saved holds the cursor position for DECRC
+	saved [2]int
+}
+
+// write interprets escape sequences in buffer and outputs the remaining
+// text.
+func (t *terminal) write(s screen, p []byte) (n int, err error) {
+	var start int
+
+	for i, b := range p {
+		if len(t.seq) == 0 && b != esc {
+			continue
+		}
+
+		if err = s.text(p[start:i]); err != nil {
+			return start, err
+		}
+
+		start = i + 1
+		t.seq = append(t.seq, b)
+
+		if t.escape(s) {
+			t.seq = t.seq[:0]
+		}
+	}
+
+	if err = s.text(p[start:]); err != nil {
+		return start, err
+	}
+
+	return len(p), nil
+}
+
+// escape interprets t.seq, it returns whether the sequence is complete (or
+// discarded).
+func (t *terminal) escape(s screen) bool {
+	seq := t.seq
+
+	switch {
+	case len(seq) < 2:
+		return false
+	case len(seq) > maxSequence:
+		return true
+	case seq[1] == '7':
+		t.saveCursor(s)
+		return true
+	case seq[1] == '8':
+		t.restoreCursor(s)
+		return true
+	case seq[1] != '[':
+		return true
+	case len(seq) < 3:
+		return false
+	}
+
+	final := seq[len(seq)-1]
+
+	if final < 0x40 || final > 0x7e {
+		return false
+	}
+
+	t.csi(s, string(seq[2:len(seq)-1]), final)
+
+	return true
+}
+
+// csiParams parses CSI numeric parameters, missing ones are set to def.
+func csiParams(params string, n int, def int) []int {
+	p := make([]int, n)
+
+	for i := range p {
+		p[i] = def
+	}
+
+	for i, s := range strings.Split(params, ";") {
+		if v, err := strconv.Atoi(s); err == nil && i < n {
+			p[i] = v
+		}
+	}
+
+	return p
+}
+
+// csi interprets a Control Sequence Introducer sequence.
+func (t *terminal) csi(s screen, params string, final byte) {
+	if strings.HasPrefix(params, "?") {
+		if params == "?25" && (final == 'h' || final == 'l') {
+			s.EnableCursor(final == 'h')
+		}
+
+		return
+	}
+
+	switch final {
+	case 'A', 'B', 'C', 'D':
+		n := csiParams(params, 1, 1)[0]
+
+		switch final {
+		case 'A':
+			moveCursor(s, 0, -n)
+		case 'B':
+			moveCursor(s, 0, n)
+		case 'C':
+			moveCursor(s, n, 0)
+		case 'D':
+			moveCursor(s, -n, 0)
+		}
+	case 'G':
+		if _, row, err := s.Cursor(); err == nil {
+			setCursor(s, csiParams(params, 1, 1)[0]-1, row)
+		}
+	case 'H', 'f':
+		p := csiParams(params, 2, 1)
+		setCursor(s, p[1]-1, p[0]-1)
+	case 'J':
+		eraseDisplay(s, csiParams(params, 1, 0)[0])
+	case 'K':
+		eraseLine(s, csiParams(params, 1, 0)[0])
+	case 'm':
+		sgr(s, params)
+	case 's':
+		t.saveCursor(s)
+	case 'u':
+		t.restoreCursor(s)
+	}
+}
+
+func (t *terminal) saveCursor(s screen) {
+	if col, row, err := s.Cursor(); err == nil {
+		t.saved = [2]int{col, row}
+	}
+}
+
+func (t *terminal) restoreCursor(s screen) {
+	setCursor(s, t.saved[0], t.saved[1])
+}
+
+// setCursor moves the cursor to a position clamped to the screen.
+func setCursor(s screen, col int, row int) {
+	cols, rows, err := s.Size()
+
+	if err != nil {
+		return
+	}
+
+	s.SetCursorPosition(min(max(col, 0), cols-1), min(max(row, 0), rows-1))
+}
+
+// moveCursor moves the cursor relatively to its position.
+func moveCursor(s screen, dx int, dy int) {
+	if col, row, err := s.Cursor(); err == nil {
+		setCursor(s, col+dx, row+dy)
+	}
+}
+
+// erase blanks n cells from a position, the cursor is restored afterwards.
+//
+// The last cell of the screen is never written, as it would scroll it.
+func erase(s screen, col int, row int, n int) {
+	cols, rows, err := s.Size()
+
+	if err != nil {
+		return
+	}
+
+	x, y, err := s.Cursor()
+
+	if err != nil {
+		return
+	}
+
+	if end := rows * cols; row*cols+col+n >= end {
+		n = end - 1 - row*cols - col
+	}
+
+	if n > 0 && s.SetCursorPosition(col, row) == nil {
+		s.text([]byte(strings.Repeat(" ", n)))
+	}
+
+	s.SetCursorPosition(x, y)
+}
+
+// eraseLine implements EL: 0 to the end of line, 1 to the cursor, 2 the
+// whole line.
+func eraseLine(s screen, mode int) {
+	cols, _, err := s.Size()
+
+	if err != nil {
+		return
+	}
+
+	col, row, err := s.Cursor()
+
+	if err != nil {
+		return
+	}
+
+	switch mode {
+	case 0:
+		erase(s, col, row, cols-col)
+	case 1:
+		erase(s, 0, row, col+1)
+	case 2:
+		erase(s, 0, row, cols)
+	}
+}
+
+// eraseDisplay implements ED: 0 to the end of screen, 1 to the cursor, 2 and
+// 3 the whole screen.
+func eraseDisplay(s screen, mode int) {
+	cols, rows, err := s.Size()
+
+	if err != nil {
+		return
+	}
+
+	col, row, err := s.Cursor()
+
+	if err != nil {
+		return
+	}
+
+	switch mode {
+	case 0:
+		erase(s, col, row, (rows-row)*cols-col)
+	case 1:
+		erase(s, 0, 0, row*cols+col+1)
+	case 2, 3:
+		// ClearScreen homes the cursor, unlike ED
+		if s.ClearScreen() == nil {
+			s.SetCursorPosition(col, row)
+		}
+	}
+}
+
+// sgr implements Select Graphic Rendition, mapping colors to EFI text
+// attributes. Bright backgrounds are not available and map to normal ones.
+func sgr(s screen, params string) {
+	attr, err := s.Attribute()
+
+	if err != nil {
+		return
+	}
+
+	fg := attr & 0x0f
+	bg := (attr >> 4) & 0x07
+
+	if len(params) == 0 {
+		params = "0"
+	}
+
+	for _, p := range strings.Split(params, ";") {
+		n, err := strconv.Atoi(p)
+
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case n == 0:
+			fg = EFI_LIGHTGRAY
+			bg = EFI_BLACK
+		case n == 1:
+			fg |= EFI_BRIGHT
+		case n == 22:
+			fg &^= EFI_BRIGHT
+		case n >= 30 && n <= 37:
+			fg = fg&EFI_BRIGHT | ansiColors[n-30]
+		case n == 39:
+			fg = fg&EFI_BRIGHT | EFI_LIGHTGRAY
+		case n >= 40 && n <= 47:
+			bg = ansiColors[n-40]
+		case n == 49:
+			bg = EFI_BLACK
+		case n >= 90 && n <= 97:
+			fg = EFI_BRIGHT | ansiColors[n-90]
+		case n >= 100 && n <= 107:
+			bg = ansiColors[n-100]
+		}
+	}
+
+	s.SetAttribute(bg<<4 | fg)
+}
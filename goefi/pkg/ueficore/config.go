@@ -13,6 +13,9 @@ import (
 	"github.com/usbarmory/tamago/dma"
 )
 
+// EFI Boot Services offsets
+const installConfigurationTable = 0xc0
+
 // Configuration represents an EFI Configuration Table.
 type ConfigurationTable struct {
 	GUID        [16]byte
@@ -62,3 +65,17 @@ func (d *SystemTable) ConfigurationTables() (c []*ConfigurationTable, err error)
 
 	return
 }
+
+// InstallConfigurationTable calls
+// EFI_BOOT_SERVICES.InstallConfigurationTable(), a zero table address removes
+// the entry.
+func (s *BootServices) InstallConfigurationTable(guid GUID, table uint64) (err error) {
+	status := CallService(s.base+installConfigurationTable,
+		[]uint64{
+			guid.ptrval(),
+			table,
+		},
+	)
+
+	return parseStatus(status)
+}
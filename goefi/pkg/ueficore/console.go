@@ -8,6 +8,7 @@ package ueficore
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"time"
 	"unicode/utf16"
@@ -15,15 +16,20 @@ import (
 
 // EFI ConOut offsets
 const (
-	outputString = 0x08
-	setMode      = 0x20
-	setAttribute = 0x28
-	clearScreen  = 0x30
+	outputString      = 0x08
+	queryMode         = 0x18
+	setMode           = 0x20
+	setAttribute      = 0x28
+	clearScreen       = 0x30
+	setCursorPosition = 0x38
+	enableCursor      = 0x40
+	outputMode        = 0x48
 )
 
 // EFI ConIn offsets
 const (
 	readKeyStroke = 0x08
+	waitForKey    = 0x10
 )
 
 // EFI text attributes
@@ -55,19 +61,30 @@ const (
 	lf    = 0x0a
 	cr    = 0x0d
 	space = 0x20
+	del   = 0x7f
 )
 
-// Control Sequence Introducer n D - CUB - Cursor Back
-var cub = []byte{0x1b, 0x5b, 0x44, 0x20, 0x1b, 0x5b, 0x44}
-
 // InputKey represents an EFI Input Key descriptor.
 type InputKey struct {
 	ScanCode    uint16
 	UnicodeChar [2]byte
 }
 
+// OutputMode represents an EFI Simple Text Output Mode descriptor.
+type OutputMode struct {
+	MaxMode       int32
+	Mode          int32
+	Attribute     int32
+	CursorColumn  int32
+	CursorRow     int32
+	CursorVisible bool
+	_             [3]byte
+}
+
 // Console implements the [io.ReadWriter] interface over EFI Simple Text
 // Input/Output protocol.
+//
+// Output is interpreted as a VT100 terminal, see Write.
 type Console struct {
 	io.ReadWriter
 
@@ -81,8 +98,20 @@ type Console struct {
 
 	// In should be set to the EFI SystemTable ConIn address.
 	In uint64
+	// InEx can be set to the ConIn EFI Simple Text Input Ex Protocol
+	// address, to read key states.
+	InEx uint64
 	// Out should be set to the EFI SystemTable ConOut address.
 	Out uint64
+
+	// Idle can be set to park Read on the WaitForKey event, rather than
+	// polling for keystrokes.
+	Idle *Idle
+
+	// pending holds translated input not yet read
+	pending []byte
+	// term interprets output escape sequences
+	term terminal
 }
 
 // ClearScreen calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.ClearScreen().
@@ -116,6 +145,156 @@ func (c *Console) SetMode(mode uint64) error {
 	return parseStatus(status)
 }
 
+// QueryMode calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.QueryMode().
+func (c *Console) QueryMode(mode uint64) (columns int, rows int, err error) {
+	var cols, rs uint64
+
+	if c.Out == 0 {
+		return 0, 0, errors.New("no console output")
+	}
+
+	status := CallService(c.Out+queryMode,
+		[]uint64{
+			c.Out,
+			mode,
+			ptrval(&cols),
+			ptrval(&rs),
+		},
+	)
+
+	return int(cols), int(rs), parseStatus(status)
+}
+
+// Mode returns the EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.Mode descriptor.
+func (c *Console) Mode() (m *OutputMode, err error) {
+	if c.Out == 0 {
+		return nil, errors.New("no console output")
+	}
+
+	buf, err := read(c.Out+outputMode, 8)
+
+	if err != nil {
+		return
+	}
+
+	if buf, err = read(binary.LittleEndian.Uint64(buf), 24); err != nil {
+		return
+	}
+
+	m = &OutputMode{}
+	err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, m)
+
+	return
+}
+
+// Size returns the text columns and rows of the current mode.
+func (c *Console) Size() (columns int, rows int, err error) {
+	m, err := c.Mode()
+
+	if err != nil {
+		return
+	}
+
+	return c.QueryMode(uint64(m.Mode))
+}
+
+// Cursor returns the cursor position.
+func (c *Console) Cursor() (column int, row int, err error) {
+	m, err := c.Mode()
+
+	if err != nil {
+		return
+	}
+
+	return int(m.CursorColumn), int(m.CursorRow), nil
+}
+
+// Attribute returns the current text attribute.
+func (c *Console) Attribute() (attr uint64, err error) {
+	m, err := c.Mode()
+
+	if err != nil {
+		return
+	}
+
+	return uint64(m.Attribute), nil
+}
+
+// SetLargestMode sets the supported text mode with most columns and rows.
+func (c *Console) SetLargestMode() (columns int, rows int, err error) {
+	var mode uint64
+
+	m, err := c.Mode()
+
+	if err != nil {
+		return
+	}
+
+	for i := uint64(0); i < uint64(m.MaxMode); i++ {
+		cols, rs, err := c.QueryMode(i)
+
+		// unsupported modes return EFI_UNSUPPORTED
+		if err != nil {
+			continue
+		}
+
+		if cols*rs > columns*rows {
+			columns = cols
+			rows = rs
+			mode = i
+		}
+	}
+
+	if columns == 0 {
+		return 0, 0, errors.New("no text mode available")
+	}
+
+	if int32(mode) == m.Mode {
+		return
+	}
+
+	return columns, rows, c.SetMode(mode)
+}
+
+// SetCursorPosition calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.SetCursorPosition().
+func (c *Console) SetCursorPosition(column int, row int) error {
+	if c.Out == 0 {
+		return nil
+	}
+
+	status := CallService(c.Out+setCursorPosition,
+		[]uint64{
+			c.Out,
+			uint64(column),
+			uint64(row),
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// EnableCursor calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.EnableCursor().
+func (c *Console) EnableCursor(visible bool) error {
+	var v uint64
+
+	if c.Out == 0 {
+		return nil
+	}
+
+	if visible {
+		v = 1
+	}
+
+	status := CallService(c.Out+enableCursor,
+		[]uint64{
+			c.Out,
+			v,
+		},
+	)
+
+	return parseStatus(status)
+}
+
 // SetAttribute calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.SetAttribute().
 func (c *Console) SetAttribute(attr uint64) error {
 	if c.Out == 0 {
@@ -146,6 +325,22 @@ func (c *Console) Input(k *InputKey) (status uint64) {
 	)
 }
 
+// WaitForKey returns the EFI_SIMPLE_TEXT_INPUT_PROTOCOL.WaitForKey event,
+// signaled when a keystroke is available.
+func (c *Console) WaitForKey() (event uint64, err error) {
+	if c.In == 0 {
+		return 0, errors.New("no console input")
+	}
+
+	buf, err := read(c.In+waitForKey, 8)
+
+	if err != nil {
+		return
+	}
+
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
 // Output calls EFI_SIMPLE_TEXT_OUTPUT_PROTOCOL.OutputString().
 func (c *Console) Output(p []byte) (status uint64) {
 	if p[len(p)-1] != null {
@@ -164,52 +359,73 @@ func (c *Console) Output(p []byte) (status uint64) {
 	)
 }
 
-// Read available data to buffer from console.
+// Read reads data to buffer from console, blocking until a keystroke is
+// available, keystrokes are returned as UTF-8 text and ANSI escape sequences
+// (see InputEx).
 func (c *Console) Read(p []byte) (n int, err error) {
-	k := &InputKey{}
+	for {
+		if n, err = c.Poll(p); n > 0 || err != nil || len(p) == 0 {
+			return
+		}
 
-	for n = 0; n < len(p); n += 2 {
-		status := c.Input(k)
+		c.waitKey()
+	}
+}
+
+// Poll reads available data to buffer from console, like Read but without
+// blocking.
+func (c *Console) Poll(p []byte) (n int, err error) {
+	k := &KeyData{}
+
+read:
+	for len(c.pending) < len(p) {
+		status := c.InputEx(k)
 
 		switch {
 		case status&0xff == EFI_NOT_READY:
-			// Compatibility note:
-			//
-			// shell.(*Interface).readLine now starves the
-			// scheduler, however this package currently has no
-			// need for background goroutines.
-			//
-			// In case this becomes undesirable here add:
-			//  runtime.Gosched()
-			//
-			// For now we just take an atomic nap as that eases a
-			// benign HeapAlloc increase due to GC starvation.
-			time.Sleep(1 * time.Millisecond)
-			return
+			break read
 		case status != EFI_SUCCESS:
-			return n, parseStatus(status)
-		case k.ScanCode > 0:
-			binary.LittleEndian.PutUint16(p[n:], k.ScanCode)
-		default:
-			copy(p[n:], k.UnicodeChar[:])
+			err = parseStatus(status)
+			break read
 		}
+
+		c.pending = append(c.pending, ansiKey(k)...)
 	}
 
+	n = copy(p, c.pending)
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+
 	return
 }
 
-// Write data from buffer to console.
+// waitKey blocks the calling goroutine until the next keystroke.
+func (c *Console) waitKey() {
+	if c.Idle != nil {
+		if event, err := c.WaitForKey(); err == nil {
+			c.Idle.Park(event)
+			return
+		}
+	}
+
+	// without idle hook, or console input, nap so that other goroutines
+	// are not starved
+	time.Sleep(1 * time.Millisecond)
+}
+
+// Write data from buffer to console, ANSI escape sequences are interpreted
+// (see terminal) and the remaining UTF-8 text is output.
 func (c *Console) Write(p []byte) (n int, err error) {
+	return c.term.write(c, p)
+}
+
+// text outputs UTF-8 text.
+func (c *Console) text(p []byte) (err error) {
 	var s []byte
 
 	if len(p) == 0 {
 		return
 	}
 
-	if len(p) == len(cub) && bytes.Equal(cub, p) {
-		p = []byte{bs, 0x00}
-	}
-
 	// we receive an UTF-8 string and can output UTF-16
 	b := utf16.Encode([]rune(string(p)))
 
@@ -230,7 +446,7 @@ func (c *Console) Write(p []byte) (n int, err error) {
 	}
 
 	if status := c.Output(s); status != EFI_SUCCESS {
-		return n, parseStatus(status)
+		return parseStatus(status)
 	}
 
 	return
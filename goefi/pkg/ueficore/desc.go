@@ -9,22 +9,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"unicode/utf16"
 
 	"github.com/usbarmory/tamago/dma"
 )
 
 const align = 8
 
-func toUTF16(s string) (buf []byte) {
-	for _, r := range utf16.Encode([]rune(s)) {
-		buf = append(buf, byte(r&0xff))
-		buf = append(buf, byte(r>>8))
-	}
-
-	return append([]byte(buf), []byte{0x00, 0x00}...)
-}
-
 func marshalBinary(data any) (buf []byte, err error) {
 	b := new(bytes.Buffer)
 	err = binary.Write(b, binary.LittleEndian, data)
@@ -0,0 +1,325 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// parkTimeout bounds Park sleeps, as a safety net for one-shot events whose
+// wake up could not be delivered (see Idle.Wait).
+const parkTimeout = 1 * time.Second
+
+// EFI Boot Services offsets
+const (
+	createEvent  = 0x50
+	setTimer     = 0x58
+	waitForEvent = 0x60
+	signalEvent  = 0x68
+	closeEvent   = 0x70
+	checkEvent   = 0x78
+)
+
+// EFI_EVENT types
+const (
+	EVT_TIMER                         = 0x80000000
+	EVT_RUNTIME                       = 0x40000000
+	EVT_NOTIFY_WAIT                   = 0x00000100
+	EVT_NOTIFY_SIGNAL                 = 0x00000200
+	EVT_SIGNAL_EXIT_BOOT_SERVICES     = 0x00000201
+	EVT_SIGNAL_VIRTUAL_ADDRESS_CHANGE = 0x60000202
+)
+
+// EFI_TPL
+const (
+	TPL_APPLICATION = 4
+	TPL_CALLBACK    = 8
+	TPL_NOTIFY      = 16
+)
+
+// EFI_TIMER_DELAY
+const (
+	TimerCancel = iota
+	TimerPeriodic
+	TimerRelative
+)
+
+// CreateEvent calls EFI_BOOT_SERVICES.CreateEvent(), without notification
+// function as firmware cannot call into Go code.
+func (s *BootServices) CreateEvent(eventType uint32, notifyTPL uint64) (event uint64, err error) {
+	status := CallService(s.base+createEvent,
+		[]uint64{
+			uint64(eventType),
+			notifyTPL,
+			0,
+			0,
+			ptrval(&event),
+		},
+	)
+
+	return event, parseStatus(status)
+}
+
+// SetTimer calls EFI_BOOT_SERVICES.SetTimer(), the trigger time is rounded
+// down to the 100ns firmware resolution.
+func (s *BootServices) SetTimer(event uint64, timerType int, trigger time.Duration) error {
+	status := CallService(s.base+setTimer,
+		[]uint64{
+			event,
+			uint64(timerType),
+			uint64(trigger / 100),
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// WaitForEvent calls EFI_BOOT_SERVICES.WaitForEvent(), it returns the index
+// of the signaled event. The CPU is halted by firmware until then, blocking
+// all goroutines.
+func (s *BootServices) WaitForEvent(events ...uint64) (index int, err error) {
+	var i uint64
+
+	if len(events) == 0 {
+		return 0, errors.New("no events")
+	}
+
+	status := CallService(s.base+waitForEvent,
+		[]uint64{
+			uint64(len(events)),
+			ptrval(&events[0]),
+			ptrval(&i),
+		},
+	)
+
+	return int(i), parseStatus(status)
+}
+
+// SignalEvent calls EFI_BOOT_SERVICES.SignalEvent().
+func (s *BootServices) SignalEvent(event uint64) error {
+	status := CallService(s.base+signalEvent,
+		[]uint64{
+			event,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// CloseEvent calls EFI_BOOT_SERVICES.CloseEvent().
+func (s *BootServices) CloseEvent(event uint64) error {
+	status := CallService(s.base+closeEvent,
+		[]uint64{
+			event,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// CheckEvent calls EFI_BOOT_SERVICES.CheckEvent(), it returns whether the
+// event is signaled, which also clears it.
+func (s *BootServices) CheckEvent(event uint64) (bool, error) {
+	status := CallService(s.base+checkEvent,
+		[]uint64{
+			event,
+		},
+	)
+
+	if status&0xff == EFI_NOT_READY {
+		return false, nil
+	}
+
+	return true, parseStatus(status)
+}
+
+// Idle halts the CPU, through EFI_BOOT_SERVICES.WaitForEvent(), until a
+// timeout expires or one of its wake events (e.g. a keystroke or a network
+// packet) is signaled.
+//
+// Its Wait method does not allocate nor lock, so that it can be used as the
+// runtime idle hook, goroutines parked on a wake event (see Park) are woken
+// when it is signaled.
+type Idle struct {
+	s     *BootServices
+	timer uint64
+	index uint64
+	set   []uint64
+
+	// wake events, replaced as a whole under mu so that Wait never
+	// observes a partial update
+	mu    sync.Mutex
+	state atomic.Pointer[idleState]
+}
+
+// idleState holds the wake events and their WaitForEvent() arguments.
+type idleState struct {
+	events  []uint64
+	waiters []*idleWaiter
+	wait    []uint64
+}
+
+// idleWaiter holds the goroutine parked on a wake event.
+type idleWaiter struct {
+	gp       atomic.Uint64
+	signaled atomic.Bool
+}
+
+// NewIdle creates an idle timer with the argument wake events.
+func (s *BootServices) NewIdle(wake ...uint64) (idle *Idle, err error) {
+	timer, err := s.CreateEvent(EVT_TIMER, 0)
+
+	if err != nil {
+		return
+	}
+
+	idle = &Idle{
+		s:     s,
+		timer: timer,
+		set:   []uint64{timer, TimerRelative, 0},
+	}
+
+	idle.update(append([]uint64{timer}, wake...))
+
+	return
+}
+
+// update replaces the wake events, waiters of retained events are kept, mu
+// must be held.
+func (idle *Idle) update(events []uint64) {
+	prev := idle.state.Load()
+
+	st := &idleState{
+		events:  events,
+		waiters: make([]*idleWaiter, len(events)),
+	}
+
+	for i, e := range events {
+		if prev != nil {
+			if j := slices.Index(prev.events, e); j >= 0 {
+				st.waiters[i] = prev.waiters[j]
+				continue
+			}
+		}
+
+		st.waiters[i] = &idleWaiter{}
+	}
+
+	st.wait = []uint64{
+		uint64(len(events)),
+		ptrval(&st.events[0]),
+		ptrval(&idle.index),
+	}
+
+	idle.state.Store(st)
+}
+
+// Add adds a wake event.
+func (idle *Idle) Add(event uint64) {
+	idle.mu.Lock()
+	defer idle.mu.Unlock()
+
+	idle.update(append(slices.Clone(idle.state.Load().events), event))
+}
+
+// Remove removes a wake event.
+func (idle *Idle) Remove(event uint64) {
+	idle.mu.Lock()
+	defer idle.mu.Unlock()
+
+	events := slices.DeleteFunc(slices.Clone(idle.state.Load().events[1:]), func(e uint64) bool {
+		return e == event
+	})
+
+	idle.update(append([]uint64{idle.timer}, events...))
+}
+
+// Wait halts the CPU until the argument timeout expires or a wake event is
+// signaled, wake events are not cleared.
+//
+// The goroutine parked on the signaled event is woken through
+// runtime.WakeG(), which is meant to be called from contexts that cannot
+// block nor allocate: the tamago interrupt handler (amd64/irq.s) invokes it
+// with interrupts disabled. It reports, rather than waits for, a goroutine
+// which is not yet sleeping, in which case the waiter is kept and woken on
+// the next signal (see Park).
+func (idle *Idle) Wait(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	st := idle.state.Load()
+	idle.set[2] = uint64(timeout / 100)
+
+	// the service mutex is not used as goroutines never block while
+	// holding it, the hook runs when none is runnable
+	if status := callFn(idle.s.base+setTimer, len(idle.set), idle.set); status != EFI_SUCCESS {
+		return
+	}
+
+	if status := callFn(idle.s.base+waitForEvent, len(st.wait), st.wait); status != EFI_SUCCESS {
+		return
+	}
+
+	if idle.index >= uint64(len(st.waiters)) {
+		return
+	}
+
+	w := st.waiters[idle.index]
+
+	if gp := w.gp.Load(); gp != 0 {
+		w.signaled.Store(true)
+
+		if runtime.WakeG(gp) == nil {
+			w.gp.CompareAndSwap(gp, 0)
+		}
+	}
+}
+
+// Park blocks the calling goroutine, without polling, until the argument
+// event is signaled while other goroutines keep running. The event is added
+// to the wake events for the duration of the call, if not already present.
+//
+// Only one goroutine can be parked on a given event. A wake up which cannot
+// be delivered, as the goroutine is not yet sleeping, is recorded and retried
+// on the next signal, events which are not signaled again (e.g. one-shot
+// timers) resume after at most parkTimeout.
+func (idle *Idle) Park(event uint64) {
+	idle.mu.Lock()
+
+	st := idle.state.Load()
+	i := slices.Index(st.events, event)
+
+	if i < 1 {
+		idle.update(append(slices.Clone(st.events), event))
+		defer idle.Remove(event)
+
+		st = idle.state.Load()
+		i = len(st.events) - 1
+	}
+
+	w := st.waiters[i]
+	gp, _ := runtime.GetG()
+
+	w.signaled.Store(false)
+	w.gp.Store(gp)
+
+	idle.mu.Unlock()
+
+	defer w.gp.CompareAndSwap(gp, 0)
+
+	// the event might have been signaled before the waiter was set
+	if signaled, err := idle.s.CheckEvent(event); signaled || err != nil || w.signaled.Load() {
+		return
+	}
+
+	time.Sleep(parkTimeout)
+}
@@ -0,0 +1,342 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// fbPalette maps EFI text colors to RGB values.
+var fbPalette = [16][3]byte{
+	EFI_BLACK:        {0x00, 0x00, 0x00},
+	EFI_BLUE:         {0x00, 0x00, 0xaa},
+	EFI_GREEN:        {0x00, 0xaa, 0x00},
+	EFI_CYAN:         {0x00, 0xaa, 0xaa},
+	EFI_RED:          {0xaa, 0x00, 0x00},
+	EFI_MAGENTA:      {0xaa, 0x00, 0xaa},
+	EFI_BROWN:        {0xaa, 0x55, 0x00},
+	EFI_LIGHTGRAY:    {0xaa, 0xaa, 0xaa},
+	EFI_DARKGRAY:     {0x55, 0x55, 0x55},
+	EFI_LIGHTBLUE:    {0x55, 0x55, 0xff},
+	EFI_LIGHTGREEN:   {0x55, 0xff, 0x55},
+	EFI_LIGHTCYAN:    {0x55, 0xff, 0xff},
+	EFI_LIGHTRED:     {0xff, 0x55, 0x55},
+	EFI_LIGHTMAGENTA: {0xff, 0x55, 0xff},
+	EFI_YELLOW:       {0xff, 0xff, 0x55},
+	EFI_WHITE:        {0xff, 0xff, 0xff},
+}
+
+// fbRows is the minimum number of text rows, glyphs are scaled by the
+// largest factor which keeps it.
+const fbRows = 48
+
+// fbCell represents a character on a FramebufferConsole.
+type fbCell struct {
+	r    rune
+	attr uint64
+}
+
+// FramebufferConsole implements the [io.Writer] interface over the EFI
+// Graphics Output Protocol, for firmware without a usable text output.
+//
+// Text is rendered with a built-in 8x8 ASCII font, scaled on large
+// resolutions, through Blt() which supports all pixel formats. ANSI escape
+// sequences are interpreted as for Console.
+type FramebufferConsole struct {
+	gop *GraphicsOutput
+
+	scale   int
+	width   int
+	height  int
+	columns int
+	rows    int
+
+	column int
+	row    int
+	attr   uint64
+	cursor bool
+
+	cells []fbCell
+	// buf holds a cell in EFI_GRAPHICS_OUTPUT_BLT_PIXEL format
+	buf []byte
+	// pixel holds an EfiBltVideoFill color
+	pixel []byte
+
+	term terminal
+}
+
+// NewConsole returns a text console rendered on the current graphics mode,
+// the screen is cleared.
+func (gop *GraphicsOutput) NewConsole() (fb *FramebufferConsole, err error) {
+	pm, err := gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	mi, err := pm.GetInfo()
+
+	if err != nil {
+		return
+	}
+
+	fb = &FramebufferConsole{
+		gop:    gop,
+		scale:  max(int(mi.VerticalResolution)/(fontHeight*fbRows), 1),
+		attr:   EFI_LIGHTGRAY,
+		cursor: true,
+		pixel:  make([]byte, 4),
+	}
+
+	fb.width = fontWidth * fb.scale
+	fb.height = fontHeight * fb.scale
+	fb.columns = int(mi.HorizontalResolution) / fb.width
+	fb.rows = int(mi.VerticalResolution) / fb.height
+
+	if fb.columns == 0 || fb.rows == 0 {
+		return nil, errors.New("invalid graphics mode")
+	}
+
+	fb.cells = make([]fbCell, fb.columns*fb.rows)
+	fb.buf = make([]byte, fb.width*fb.height*4)
+
+	return fb, fb.ClearScreen()
+}
+
+// Size returns the text columns and rows.
+func (fb *FramebufferConsole) Size() (columns int, rows int, err error) {
+	return fb.columns, fb.rows, nil
+}
+
+// Cursor returns the cursor position.
+func (fb *FramebufferConsole) Cursor() (column int, row int, err error) {
+	return fb.column, fb.row, nil
+}
+
+// Attribute returns the current text attribute.
+func (fb *FramebufferConsole) Attribute() (attr uint64, err error) {
+	return fb.attr, nil
+}
+
+// SetAttribute sets the text attribute (e.g. EFI_WHITE | EFI_BLUE<<4) of
+// the following output.
+func (fb *FramebufferConsole) SetAttribute(attr uint64) error {
+	fb.attr = attr & 0x7f
+	return nil
+}
+
+// SetCursorPosition moves the cursor.
+func (fb *FramebufferConsole) SetCursorPosition(column int, row int) (err error) {
+	if column < 0 || column >= fb.columns || row < 0 || row >= fb.rows {
+		return errors.New("invalid cursor position")
+	}
+
+	if err = fb.hideCursor(); err != nil {
+		return
+	}
+
+	fb.column = column
+	fb.row = row
+
+	return fb.showCursor()
+}
+
+// EnableCursor sets the cursor visibility.
+func (fb *FramebufferConsole) EnableCursor(visible bool) (err error) {
+	if err = fb.hideCursor(); err != nil {
+		return
+	}
+
+	fb.cursor = visible
+
+	return fb.showCursor()
+}
+
+// ClearScreen fills the screen with the current background color and homes
+// the cursor.
+func (fb *FramebufferConsole) ClearScreen() (err error) {
+	pm, err := fb.gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	mi, err := pm.GetInfo()
+
+	if err != nil {
+		return
+	}
+
+	for i := range fb.cells {
+		fb.cells[i] = fbCell{r: ' ', attr: fb.attr}
+	}
+
+	fb.column = 0
+	fb.row = 0
+
+	fb.setPixel(fb.pixel, fb.attr>>4)
+
+	if err = fb.gop.Blt(fb.pixel, EfiBltVideoFill, 0, 0, 0, 0, uint64(mi.HorizontalResolution), uint64(mi.VerticalResolution), 0); err != nil {
+		return
+	}
+
+	return fb.showCursor()
+}
+
+// Write data from buffer to the screen, ANSI escape sequences are
+// interpreted (see terminal) and the remaining UTF-8 text is output.
+func (fb *FramebufferConsole) Write(p []byte) (n int, err error) {
+	return fb.term.write(fb, p)
+}
+
+// text outputs UTF-8 text, LF implies CR and characters outside the font are
+// shown as `?`.
+func (fb *FramebufferConsole) text(p []byte) (err error) {
+	if len(p) == 0 {
+		return
+	}
+
+	if err = fb.hideCursor(); err != nil {
+		return
+	}
+
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		p = p[size:]
+
+		switch {
+		case r == lf:
+			fb.column = 0
+			err = fb.newline()
+		case r == cr:
+			fb.column = 0
+		case r == bs:
+			fb.column = max(fb.column-1, 0)
+		case r == tab:
+			for i := fb.column; i < min((fb.column/8+1)*8, fb.columns); i++ {
+				err = fb.put(' ')
+			}
+		case r < fontFirst:
+			continue
+		default:
+			err = fb.put(r)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return fb.showCursor()
+}
+
+// put draws a character at the cursor and advances it, wrapping at the last
+// column.
+func (fb *FramebufferConsole) put(r rune) (err error) {
+	if r > fontLast {
+		r = '?'
+	}
+
+	fb.cells[fb.row*fb.columns+fb.column] = fbCell{r: r, attr: fb.attr}
+
+	if err = fb.draw(fb.column, fb.row, false); err != nil {
+		return
+	}
+
+	if fb.column++; fb.column == fb.columns {
+		fb.column = 0
+		return fb.newline()
+	}
+
+	return
+}
+
+// newline moves the cursor to the next row, scrolling the screen on the last
+// one.
+func (fb *FramebufferConsole) newline() (err error) {
+	if fb.row < fb.rows-1 {
+		fb.row++
+		return
+	}
+
+	w := uint64(fb.columns * fb.width)
+	h := uint64(fb.height)
+
+	if err = fb.gop.Blt(nil, EfiBltVideoToVideo, 0, h, 0, 0, w, uint64(fb.rows-1)*h, 0); err != nil {
+		return
+	}
+
+	copy(fb.cells, fb.cells[fb.columns:])
+	last := fb.cells[(fb.rows-1)*fb.columns:]
+
+	for i := range last {
+		last[i] = fbCell{r: ' ', attr: fb.attr}
+	}
+
+	fb.setPixel(fb.pixel, fb.attr>>4)
+
+	return fb.gop.Blt(fb.pixel, EfiBltVideoFill, 0, 0, 0, uint64(fb.rows-1)*h, w, h, 0)
+}
+
+// setPixel writes an EFI text color as EFI_GRAPHICS_OUTPUT_BLT_PIXEL.
+func (fb *FramebufferConsole) setPixel(p []byte, color uint64) {
+	rgb := fbPalette[color&0x0f]
+
+	p[0] = rgb[2]
+	p[1] = rgb[1]
+	p[2] = rgb[0]
+	p[3] = 0
+}
+
+// draw renders a cell, with an underline for the cursor.
+func (fb *FramebufferConsole) draw(column int, row int, cursor bool) error {
+	c := fb.cells[row*fb.columns+column]
+	glyph := font[0]
+
+	if c.r >= fontFirst && c.r <= fontLast {
+		glyph = font[c.r-fontFirst]
+	}
+
+	for y := 0; y < fb.height; y++ {
+		bits := glyph[y/fb.scale]
+
+		if cursor && y >= fb.height-fb.scale {
+			bits = 0xff
+		}
+
+		for x := 0; x < fb.width; x++ {
+			color := c.attr >> 4
+
+			if bits>>(x/fb.scale)&1 != 0 {
+				color = c.attr
+			}
+
+			off := (y*fb.width + x) * 4
+			fb.setPixel(fb.buf[off:off+4], color)
+		}
+	}
+
+	return fb.gop.Blt(fb.buf, EfiBltBufferToVideo, 0, 0,
+		uint64(column*fb.width), uint64(row*fb.height),
+		uint64(fb.width), uint64(fb.height), uint64(fb.width*4))
+}
+
+func (fb *FramebufferConsole) showCursor() error {
+	if !fb.cursor {
+		return nil
+	}
+
+	return fb.draw(fb.column, fb.row, true)
+}
+
+func (fb *FramebufferConsole) hideCursor() error {
+	if !fb.cursor {
+		return nil
+	}
+
+	return fb.draw(fb.column, fb.row, false)
+}
@@ -6,15 +6,19 @@
 package ueficore
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"time"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
 )
 
 const (
-	EFI_FILE_INFO_ID = "09576e92-6d3f-11d2-8e39-00a0c969723b"
+	EFI_FILE_INFO_ID        = "09576e92-6d3f-11d2-8e39-00a0c969723b"
+	EFI_FILE_SYSTEM_INFO_ID = "09576e93-6d3f-11d2-8e39-00a0c969723b"
 
 	EFI_FILE_PROTOCOL_REVISION  = 0x00010000
 	EFI_FILE_PROTOCOL_REVISION2 = 0x00020000
@@ -23,7 +27,21 @@ const (
 	EFI_FILE_MODE_WRITE  = 0x0000000000000002
 	EFI_FILE_MODE_CREATE = 0x8000000000000000
 
+	EFI_FILE_READ_ONLY = 0x0000000000000001
+	EFI_FILE_HIDDEN    = 0x0000000000000002
+	EFI_FILE_SYSTEM    = 0x0000000000000004
 	EFI_FILE_DIRECTORY = 0x0000000000000010
+	EFI_FILE_ARCHIVE   = 0x0000000000000020
+
+	// EFI_TIME value for local time
+	EFI_UNSPECIFIED_TIMEZONE = 0x07ff
+)
+
+// EFI_FILE_INFO sizes, without and with the largest expected (255
+// characters) file name.
+const (
+	fileInfoSize    = 8*4 + 16*3
+	maxFileInfoSize = fileInfoSize + 512
 )
 
 // fileProtocol represents an EFI File Protocol instance.
@@ -50,10 +68,10 @@ type efiTime struct {
 	Minute     uint8
 	Second     uint8
 	_          uint8
-	Nanosecond uint8
+	Nanosecond uint32
 	TimeZone   int16
 	Daylight   uint8
-	_          uint32
+	_          uint8
 }
 
 // fileInfo represents an EFI_FILE_INFO instance.
@@ -68,8 +86,8 @@ type fileInfo struct {
 }
 
 // open calls EFI_FILE_PROTOCOL.Open().
-func (f *fileProtocol) open(handle uint64, name string, mode uint64) (o *fileProtocol, addr uint64, err error) {
-	fileName := toUTF16(name)
+func (f *fileProtocol) open(handle uint64, name string, mode uint64, attr uint64) (o *fileProtocol, addr uint64, err error) {
+	fileName := efivar.EncodeString(name)
 
 	status := CallService(ptrval(&f.Open),
 		[]uint64{
@@ -77,7 +95,7 @@ func (f *fileProtocol) open(handle uint64, name string, mode uint64) (o *filePro
 			ptrval(&addr),
 			ptrval(&fileName[0]),
 			mode,
-			0,
+			attr,
 		},
 	)
 
@@ -132,9 +150,130 @@ func (f *fileProtocol) read(handle uint64, buf []byte) (n int, err error) {
 	return int(size), parseStatus(status)
 }
 
+// write calls EFI_FILE_PROTOCOL.Write().
+func (f *fileProtocol) write(handle uint64, buf []byte) (n int, err error) {
+	size := uint64(len(buf))
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	status := CallService(ptrval(&f.Write),
+		[]uint64{
+			handle,
+			ptrval(&size),
+			ptrval(&buf[0]),
+		},
+	)
+
+	return int(size), parseStatus(status)
+}
+
+// getPosition calls EFI_FILE_PROTOCOL.GetPosition().
+func (f *fileProtocol) getPosition(handle uint64) (pos uint64, err error) {
+	status := CallService(ptrval(&f.GetPosition),
+		[]uint64{
+			handle,
+			ptrval(&pos),
+		},
+	)
+
+	return pos, parseStatus(status)
+}
+
+// setPosition calls EFI_FILE_PROTOCOL.SetPosition().
+func (f *fileProtocol) setPosition(handle uint64, pos uint64) (err error) {
+	status := CallService(ptrval(&f.SetPosition),
+		[]uint64{
+			handle,
+			pos,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// delete calls EFI_FILE_PROTOCOL.Delete(), the handle is closed even when
+// deletion fails.
+func (f *fileProtocol) delete(handle uint64) (err error) {
+	status := CallService(ptrval(&f.Delete),
+		[]uint64{
+			handle,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// flush calls EFI_FILE_PROTOCOL.Flush().
+func (f *fileProtocol) flush(handle uint64) (err error) {
+	status := CallService(ptrval(&f.Flush),
+		[]uint64{
+			handle,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// readDir reads the next EFI_FILE_INFO entry from a directory, returning
+// io.EOF once all entries have been read.
+func (f *fileProtocol) readDir(handle uint64) (info *fileInfo, name string, err error) {
+	buf := make([]byte, maxFileInfoSize)
+	size := uint64(len(buf))
+
+	status := CallService(ptrval(&f.Read),
+		[]uint64{
+			handle,
+			ptrval(&size),
+			ptrval(&buf[0]),
+		},
+	)
+
+	if status&0xff == EFI_BUFFER_TOO_SMALL && size > uint64(len(buf)) {
+		buf = make([]byte, size)
+
+		status = CallService(ptrval(&f.Read),
+			[]uint64{
+				handle,
+				ptrval(&size),
+				ptrval(&buf[0]),
+			},
+		)
+	}
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	if size == 0 {
+		return nil, "", io.EOF
+	}
+
+	info = &fileInfo{}
+	err = unmarshalBinary(buf[0:size], info)
+
+	return info, efivar.DecodeString(buf[fileInfoSize:size]), err
+}
+
 // getInfo calls EFI_FILE SYSTEM_PROTOCOL.GetInfo().
 func (f *fileProtocol) getInfo(handle uint64, guid []byte) (info *fileInfo, err error) {
-	buf := make([]byte, 8*7+512)
+	buf, err := f.getInfoBytes(handle, guid)
+
+	if err != nil {
+		return
+	}
+
+	info = &fileInfo{}
+	err = unmarshalBinary(buf, info)
+
+	return
+}
+
+// getInfoBytes calls EFI_FILE SYSTEM_PROTOCOL.GetInfo() and returns the raw
+// information buffer.
+func (f *fileProtocol) getInfoBytes(handle uint64, guid []byte) (buf []byte, err error) {
+	buf = make([]byte, maxFileInfoSize)
 	size := uint64(len(buf))
 
 	status := CallService(ptrval(&f.GetInfo),
@@ -150,10 +289,21 @@ func (f *fileProtocol) getInfo(handle uint64, guid []byte) (info *fileInfo, err
 		return
 	}
 
-	info = &fileInfo{}
-	err = unmarshalBinary(buf[0:size], info)
+	return buf[0:size], nil
+}
 
-	return
+// setInfo calls EFI_FILE_PROTOCOL.SetInfo().
+func (f *fileProtocol) setInfo(handle uint64, guid []byte, buf []byte) (err error) {
+	status := CallService(ptrval(&f.SetInfo),
+		[]uint64{
+			handle,
+			ptrval(&guid[0]),
+			uint64(len(buf)),
+			ptrval(&buf[0]),
+		},
+	)
+
+	return parseStatus(status)
 }
 
 // File implements the [fs.File] interface for the EFI File Protocol.
@@ -192,7 +342,12 @@ func (fi *FileInfo) Mode() fs.FileMode {
 // ModTime returns the file modification time.
 func (fi *FileInfo) ModTime() time.Time {
 	m := fi.info.ModificationTime
-	tz := time.FixedZone("tz", int(m.TimeZone))
+	tz := time.UTC
+
+	if m.TimeZone != EFI_UNSPECIFIED_TIMEZONE {
+		// offset in minutes from UTC
+		tz = time.FixedZone("tz", int(m.TimeZone)*60)
+	}
 
 	return time.Date(
 		int(m.Year),
@@ -249,6 +404,123 @@ func (f *File) Read(b []byte) (n int, err error) {
 	return f.file.read(f.addr, b)
 }
 
+// Write writes len(b) bytes from b to the File. It returns the number of bytes
+// written and an error, if any.
+func (f *File) Write(b []byte) (n int, err error) {
+	if f.addr == 0 {
+		return 0, errors.New("invalid file instance")
+	}
+
+	return f.file.write(f.addr, b)
+}
+
+// Seek sets the offset for the next Read or Write on file to offset,
+// interpreted according to whence, it implements the [io.Seeker] interface.
+func (f *File) Seek(offset int64, whence int) (pos int64, err error) {
+	if f.addr == 0 {
+		return 0, errors.New("invalid file instance")
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		cur, err := f.file.getPosition(f.addr)
+
+		if err != nil {
+			return 0, err
+		}
+
+		offset += int64(cur)
+	case io.SeekEnd:
+		info, err := f.Stat()
+
+		if err != nil {
+			return 0, err
+		}
+
+		offset += info.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	return offset, f.file.setPosition(f.addr, uint64(offset))
+}
+
+// Sync flushes any buffered data to the device.
+func (f *File) Sync() (err error) {
+	if f.addr == 0 {
+		return errors.New("invalid file instance")
+	}
+
+	return f.file.flush(f.addr)
+}
+
+// Truncate changes the size of the file, which must be open for writing.
+func (f *File) Truncate(size int64) (err error) {
+	if f.addr == 0 {
+		return errors.New("invalid file instance")
+	}
+
+	infoType := GUID(EFI_FILE_INFO_ID).Bytes()
+	buf, err := f.file.getInfoBytes(f.addr, infoType)
+
+	if err != nil {
+		return
+	}
+
+	if len(buf) < fileInfoSize {
+		return errors.New("invalid file information")
+	}
+
+	// Size, FileSize, ... the file name is kept
+	binary.LittleEndian.PutUint64(buf[8:], uint64(size))
+
+	return f.file.setInfo(f.addr, infoType, buf)
+}
+
+// ReadDir reads the contents of the directory and returns a slice of up to n
+// DirEntry values in directory order, all remaining entries are returned when
+// n <= 0.
+func (f *File) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if f.addr == 0 {
+		return nil, errors.New("invalid file instance")
+	}
+
+	for n <= 0 || len(entries) < n {
+		info, name, err := f.file.readDir(f.addr)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return entries, err
+		}
+
+		if name == "." || name == ".." {
+			continue
+		}
+
+		fi := &FileInfo{
+			info: info,
+			name: name,
+			addr: f.addr,
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+
+	return
+}
+
 // Close closes the File, rendering it unusable for I/O.
 func (f *File) Close() (err error) {
 	if f.addr == 0 {
@@ -257,3 +529,16 @@ func (f *File) Close() (err error) {
 
 	return f.file.close(f.addr)
 }
+
+// Remove deletes the File, its handle is closed in all cases.
+func (f *File) Remove() (err error) {
+	if f.addr == 0 {
+		return errors.New("invalid file instance")
+	}
+
+	defer func() {
+		f.addr = 0
+	}()
+
+	return f.file.delete(f.addr)
+}
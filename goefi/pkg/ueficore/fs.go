@@ -6,17 +6,21 @@
 package ueficore
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/fs"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
 )
 
 const (
 	EFI_LOADED_IMAGE_PROTOCOL_GUID             = "5b1b31a1-9562-11d2-8e3f-00a0c969723b"
 	EFI_LOADED_IMAGE_DEVICE_PATH_PROTOCOL_GUID = "09576e91-6d3f-11d2-8e39-00a0c969723b"
 	EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_GUID       = "964e5b22-6459-11d2-8e39-00a0c969723b"
+	EFI_DEVICE_PATH_PROTOCOL_GUID              = "09576e91-6d3f-11d2-8e39-00a0c969723b"
 
-EFI_LOADED_IMAGE_PROTOCOL_REVISION       = 0x00001000
+	EFI_LOADED_IMAGE_PROTOCOL_REVISION       = 0x00001000
 	EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_REVISION = 0x00010000
 )
 
@@ -74,6 +78,7 @@ func (root *simpleFileSystem) openVolume(handle uint64) (f *fileProtocol, addr u
 // FS implements the [fs.FS] interface for an EFI Simple File System.
 type FS struct {
 	image  *LoadedImage
+	handle uint64
 	device uint64
 	addr   uint64
 
@@ -81,12 +86,36 @@ type FS struct {
 	volume *File
 }
 
+// VolumeInfo represents an EFI_FILE_SYSTEM_INFO instance.
+type VolumeInfo struct {
+	ReadOnly    bool
+	VolumeSize  uint64
+	FreeSpace   uint64
+	BlockSize   uint32
+	VolumeLabel string
+}
+
+// Handle returns the EFI handle of the volume device.
+func (root *FS) Handle() uint64 {
+	return root.handle
+}
+
 // Open opens the named file [File.Close] must be called to release any
 // associated resources.
 func (root *FS) Open(name string) (fs.File, error) {
-	var err error
+	f, err := root.OpenFile(name, EFI_FILE_MODE_READ, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.File(f), nil
+}
 
-	f := &File{
+// OpenFile opens the named file with the argument EFI_FILE_MODE flags, the
+// EFI_FILE attributes are only used when creating a file.
+func (root *FS) OpenFile(name string, mode uint64, attr uint64) (f *File, err error) {
+	f = &File{
 		name: name,
 	}
 
@@ -94,11 +123,104 @@ func (root *FS) Open(name string) (fs.File, error) {
 		return nil, errors.New("invalid file system instance")
 	}
 
-	if f.file, f.addr, err = root.volume.file.open(root.volume.addr, name, EFI_FILE_MODE_READ); err != nil {
+	if f.file, f.addr, err = root.volume.file.open(root.volume.addr, name, mode, attr); err != nil {
 		return nil, err
 	}
 
-	return fs.File(f), nil
+	return
+}
+
+// Create creates or truncates the named file.
+func (root *FS) Create(name string) (f *File, err error) {
+	if f, err = root.OpenFile(name, EFI_FILE_MODE_READ|EFI_FILE_MODE_WRITE|EFI_FILE_MODE_CREATE, 0); err != nil {
+		return
+	}
+
+	// EFI has no truncation on open, existing contents are only dropped
+	// once the file could be opened for writing.
+	if err = f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return
+}
+
+// Mkdir creates the named directory.
+func (root *FS) Mkdir(name string) (err error) {
+	f, err := root.OpenFile(name, EFI_FILE_MODE_READ|EFI_FILE_MODE_WRITE|EFI_FILE_MODE_CREATE, EFI_FILE_DIRECTORY)
+
+	if err != nil {
+		return
+	}
+
+	return f.Close()
+}
+
+// Remove deletes the named file or empty directory.
+func (root *FS) Remove(name string) (err error) {
+	f, err := root.OpenFile(name, EFI_FILE_MODE_READ|EFI_FILE_MODE_WRITE, 0)
+
+	if err != nil {
+		return
+	}
+
+	return f.Remove()
+}
+
+// ReadDir reads the named directory and returns all its entries, it
+// implements the [fs.ReadDirFS] interface.
+func (root *FS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	f, err := root.OpenFile(name, EFI_FILE_MODE_READ, 0)
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	return f.ReadDir(-1)
+}
+
+// Close closes the volume root directory, rendering the instance unusable.
+func (root *FS) Close() (err error) {
+	if root.volume == nil || root.volume.file == nil || root.volume.addr == 0 {
+		return errors.New("invalid file system instance")
+	}
+
+	err = root.volume.Close()
+	root.volume = nil
+
+	return
+}
+
+// Info returns the volume information.
+func (root *FS) Info() (info *VolumeInfo, err error) {
+	if root.volume == nil || root.volume.file == nil || root.volume.addr == 0 {
+		return nil, errors.New("invalid file system instance")
+	}
+
+	infoType := GUID(EFI_FILE_SYSTEM_INFO_ID).Bytes()
+	buf, err := root.volume.file.getInfoBytes(root.volume.addr, infoType)
+
+	if err != nil {
+		return
+	}
+
+	// Size, ReadOnly, VolumeSize, FreeSpace, BlockSize, VolumeLabel[]
+	if len(buf) < 36 {
+		return nil, errors.New("invalid file system information")
+	}
+
+	info = &VolumeInfo{
+		ReadOnly:    buf[8] != 0,
+		VolumeSize:  binary.LittleEndian.Uint64(buf[16:]),
+		FreeSpace:   binary.LittleEndian.Uint64(buf[24:]),
+		BlockSize:   binary.LittleEndian.Uint32(buf[32:]),
+		VolumeLabel: efivar.DecodeString(buf[36:]),
+	}
+
+	return
 }
 
 func (s *BootServices) LoadImageHandle(imageHandle uint64) (image *LoadedImage, addr uint64, err error) {
@@ -123,20 +245,61 @@ func (s *BootServices) LoadImageHandle(imageHandle uint64) (image *LoadedImage,
 // Root returns an EFI Simple File System instance for the current EFI image
 // root volume.
 func (s *Services) Root() (root *FS, err error) {
-	root = &FS{
-		fs:     &simpleFileSystem{},
-		volume: &File{},
+	image, _, err := s.Boot.LoadImageHandle(s.imageHandle)
+
+	if err != nil {
+		return
 	}
 
-	if root.image, _, err = s.Boot.LoadImageHandle(s.imageHandle); err != nil {
+	if root, err = s.Boot.OpenVolume(image.DeviceHandle); err != nil {
 		return
 	}
 
-	if root.device, err = s.Boot.HandleProtocol(root.image.DeviceHandle, EFI_LOADED_IMAGE_DEVICE_PATH_PROTOCOL_GUID); err != nil {
+	root.image = image
+
+	return
+}
+
+// Volumes returns EFI Simple File System instances for all volumes mounted by
+// the firmware.
+func (s *Services) Volumes() (volumes []*FS, err error) {
+	handles, err := s.Boot.LocateHandleBuffer(ByProtocol, EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_GUID)
+
+	if err != nil {
+		return
+	}
+
+	for _, h := range handles {
+		root, err := s.Boot.OpenVolume(h)
+
+		if err != nil {
+			for _, v := range volumes {
+				v.Close()
+			}
+
+			return nil, err
+		}
+
+		volumes = append(volumes, root)
+	}
+
+	return
+}
+
+// OpenVolume returns an EFI Simple File System instance for the argument
+// device handle.
+func (s *BootServices) OpenVolume(handle uint64) (root *FS, err error) {
+	root = &FS{
+		handle: handle,
+		fs:     &simpleFileSystem{},
+		volume: &File{},
+	}
+
+	if root.device, err = s.HandleProtocol(handle, EFI_LOADED_IMAGE_DEVICE_PATH_PROTOCOL_GUID); err != nil {
 		return
 	}
 
-	if root.addr, err = s.Boot.HandleProtocol(root.image.DeviceHandle, EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_GUID); err != nil {
+	if root.addr, err = s.HandleProtocol(handle, EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_GUID); err != nil {
 		return
 	}
 
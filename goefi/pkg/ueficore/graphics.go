@@ -5,11 +5,30 @@
 
 package ueficore
 
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/costinm/uki-stub/pkg/pixel"
+)
+
 const EFI_GRAPHICS_OUTPUT_PROTOCOL_GUID = "9042a9de-23dc-4a38-96fb-7aded080516a"
 
 // EFI Graphics Output Protocol offsets
 const (
-	blt = 0x10
+	gopQueryMode = 0x00
+	gopSetMode   = 0x08
+	blt          = 0x10
+)
+
+// EFI_GRAPHICS_PIXEL_FORMAT
+const (
+	PixelRedGreenBlueReserved8BitPerColor = pixel.RedGreenBlueReserved8BitPerColor
+	PixelBlueGreenRedReserved8BitPerColor = pixel.BlueGreenRedReserved8BitPerColor
+	PixelBitMask                          = pixel.BitMask
+	PixelBltOnly                          = pixel.BltOnly
 )
 
 type BltOperation int
@@ -36,6 +55,30 @@ type ModeInformation struct {
 	PixelsPerScanLine    uint32
 }
 
+// String returns the resolution and pixel format.
+func (mi *ModeInformation) String() string {
+	format := []string{"RGB", "BGR", "bitmask", "blt"}
+	f := "unknown"
+
+	if int(mi.PixelFormat) < len(format) {
+		f = format[mi.PixelFormat]
+	}
+
+	return fmt.Sprintf("%dx%d %s", mi.HorizontalResolution, mi.VerticalResolution, f)
+}
+
+// Pixel returns an RGB color in the mode framebuffer pixel format.
+func (mi *ModeInformation) Pixel(r, g, b uint8) uint32 {
+	f := pixel.Format{
+		PixelFormat: mi.PixelFormat,
+		RedMask:     mi.RedMask,
+		GreenMask:   mi.GreenMask,
+		BlueMask:    mi.BlueMask,
+	}
+
+	return f.Pixel(r, g, b)
+}
+
 // ProtocolMode represents an EFI Graphics Output Protocol Mode instance.
 type ProtocolMode struct {
 	MaxMode         uint32
@@ -57,6 +100,144 @@ func (d *ProtocolMode) GetInfo() (mi *ModeInformation, err error) {
 type GraphicsOutput struct {
 	base uint64
 	mode uint64
+	boot *BootServices
+}
+
+// QueryMode calls EFI_GRAPHICS_OUTPUT_PROTOCOL.QueryMode().
+func (gop *GraphicsOutput) QueryMode(mode uint32) (mi *ModeInformation, err error) {
+	var size uint64
+	var info uint64
+
+	status := CallService(gop.base+gopQueryMode,
+		[]uint64{
+			gop.base,
+			uint64(mode),
+			ptrval(&size),
+			ptrval(&info),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	defer gop.boot.FreePool(info)
+
+	mi = &ModeInformation{}
+	err = decode(mi, info)
+
+	return
+}
+
+// Modes returns the information of all graphics modes, indexed by mode
+// number. Modes which cannot be queried are nil.
+func (gop *GraphicsOutput) Modes() (modes []*ModeInformation, err error) {
+	pm, err := gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	for i := uint32(0); i < pm.MaxMode; i++ {
+		mi, _ := gop.QueryMode(i)
+		modes = append(modes, mi)
+	}
+
+	return
+}
+
+// SetMode calls EFI_GRAPHICS_OUTPUT_PROTOCOL.SetMode(), which also clears
+// the screen.
+func (gop *GraphicsOutput) SetMode(mode uint32) error {
+	status := CallService(gop.base+gopSetMode,
+		[]uint64{
+			gop.base,
+			uint64(mode),
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// FindMode returns the mode number of a resolution.
+func (gop *GraphicsOutput) FindMode(width int, height int) (mode uint32, err error) {
+	modes, err := gop.Modes()
+
+	if err != nil {
+		return
+	}
+
+	for i, mi := range modes {
+		if mi != nil && int(mi.HorizontalResolution) == width && int(mi.VerticalResolution) == height {
+			return uint32(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("no %dx%d graphics mode", width, height)
+}
+
+// DrawImage draws an image centered on the screen, cropped to it. The
+// framebuffer is written directly in its pixel format, Blt() is used when
+// it is not accessible. Transparent pixels are drawn over black.
+func (gop *GraphicsOutput) DrawImage(img image.Image) (err error) {
+	pm, err := gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	mi, err := pm.GetInfo()
+
+	if err != nil {
+		return
+	}
+
+	bounds := img.Bounds()
+	sw, sh := int(mi.HorizontalResolution), int(mi.VerticalResolution)
+	w, h := min(bounds.Dx(), sw), min(bounds.Dy(), sh)
+
+	// destination and source origins
+	dx, dy := (sw-w)/2, (sh-h)/2
+	sx, sy := bounds.Min.X+(bounds.Dx()-w)/2, bounds.Min.Y+(bounds.Dy()-h)/2
+
+	if w == 0 || h == 0 {
+		return
+	}
+
+	if mi.PixelFormat == PixelBltOnly || pm.FrameBufferBase == 0 {
+		buf := make([]byte, w*h*4)
+
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				r, g, b, _ := img.At(sx+x, sy+y).RGBA()
+				off := (y*w + x) * 4
+
+				// EFI_GRAPHICS_OUTPUT_BLT_PIXEL
+				buf[off] = uint8(b >> 8)
+				buf[off+1] = uint8(g >> 8)
+				buf[off+2] = uint8(r >> 8)
+			}
+		}
+
+		return gop.Blt(buf, EfiBltBufferToVideo, 0, 0, uint64(dx), uint64(dy), uint64(w), uint64(h), uint64(w*4))
+	}
+
+	row := make([]byte, w*4)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(sx+x, sy+y).RGBA()
+			binary.LittleEndian.PutUint32(row[x*4:], mi.Pixel(uint8(r>>8), uint8(g>>8), uint8(b>>8)))
+		}
+
+		off := uint64(((dy+y)*int(mi.PixelsPerScanLine) + dx) * 4)
+
+		if err = write(pm.FrameBufferBase+off, row); err != nil {
+			return
+		}
+	}
+
+	return
 }
 
 // GetMode returns the EFI Graphics Output Mode instance.
@@ -68,14 +249,21 @@ func (gop *GraphicsOutput) GetMode() (pm *ProtocolMode, err error) {
 
 // Blt calls EFI_GRAPHICS_OUTPUT_PROTCOL.Blt().
 func (gop *GraphicsOutput) Blt(buf []byte, op BltOperation, srcX, srcY, dstX, dstY, width, height, delta uint64) (err error) {
+	var addr uint64
+
 	if gop.base == 0 {
 		return nil
 	}
 
+	// EfiBltVideoToVideo takes no buffer
+	if len(buf) > 0 {
+		addr = ptrval(&buf[0])
+	}
+
 	status := CallService(gop.base+blt,
 		[]uint64{
 			gop.base,
-			ptrval(&buf[0]),
+			addr,
 			uint64(op),
 			srcX,
 			srcY,
@@ -90,10 +278,119 @@ func (gop *GraphicsOutput) Blt(buf []byte, op BltOperation, srcX, srcY, dstX, ds
 	return parseStatus(status)
 }
 
+// screenRows is the number of framebuffer rows read by each Blt() of Screen.
+const screenRows = 64
+
+// Screen implements the [image.Image] interface over the framebuffer, which
+// is read in bands of rows, with Blt() and EfiBltVideoToBltBuffer, as pixels
+// are accessed rather than captured in memory at once.
+type Screen struct {
+	gop    *GraphicsOutput
+	width  int
+	height int
+
+	// band holds rows y0 to y1 (excluded)
+	band []byte
+	y0   int
+	y1   int
+	err  error
+}
+
+// Screen returns the current mode framebuffer as an image, the screen
+// contents are read as the image is accessed (e.g. while encoding).
+func (gop *GraphicsOutput) Screen() (s *Screen, err error) {
+	pm, err := gop.GetMode()
+
+	if err != nil {
+		return
+	}
+
+	mi, err := pm.GetInfo()
+
+	if err != nil {
+		return
+	}
+
+	if mi.HorizontalResolution == 0 || mi.VerticalResolution == 0 {
+		return nil, fmt.Errorf("invalid resolution %dx%d", mi.HorizontalResolution, mi.VerticalResolution)
+	}
+
+	s = &Screen{
+		gop:    gop,
+		width:  int(mi.HorizontalResolution),
+		height: int(mi.VerticalResolution),
+	}
+
+	s.band = make([]byte, s.width*min(screenRows, s.height)*4)
+
+	return
+}
+
+// ColorModel returns the image color model.
+func (s *Screen) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds returns the screen resolution.
+func (s *Screen) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.width, s.height)
+}
+
+// At returns the color of the pixel at (x, y).
+func (s *Screen) At(x, y int) color.Color {
+	return s.RGBAAt(x, y)
+}
+
+// RGBAAt returns the color of the pixel at (x, y), pixels which could not be
+// read are black (see Err).
+func (s *Screen) RGBAAt(x, y int) color.RGBA {
+	if !(image.Point{x, y}.In(s.Bounds())) {
+		return color.RGBA{}
+	}
+
+	if y < s.y0 || y >= s.y1 {
+		s.read(y)
+	}
+
+	if s.err != nil {
+		return color.RGBA{}
+	}
+
+	// EFI_GRAPHICS_OUTPUT_BLT_PIXEL to RGBA
+	p := s.band[((y-s.y0)*s.width+x)*4:]
+
+	return color.RGBA{p[2], p[1], p[0], 0xff}
+}
+
+// Err returns the first error encountered reading the framebuffer.
+func (s *Screen) Err() error {
+	return s.err
+}
+
+// read reads the band holding row y, in the direction of access so that
+// bottom-up encoders (e.g. BMP) also read each row once.
+func (s *Screen) read(y int) {
+	rows := len(s.band) / (s.width * 4)
+	y0 := y
+
+	if y < s.y0 {
+		y0 = max(0, y-rows+1)
+	}
+
+	y0 = min(y0, s.height-rows)
+	s.y0, s.y1 = y0, y0+rows
+
+	if err := s.gop.Blt(s.band, EfiBltVideoToBltBuffer, 0, uint64(y0), 0, 0, uint64(s.width), uint64(rows), uint64(s.width*4)); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
 // GetGraphicsOutput locates and returns the EFI Graphics Output Protocol
 // instance.
 func (s *BootServices) GetGraphicsOutput() (gop *GraphicsOutput, err error) {
-	gop = &GraphicsOutput{}
+	gop = &GraphicsOutput{
+		boot: s,
+	}
 
 	var data struct {
 		QueryMode uint64
@@ -6,48 +6,116 @@
 package ueficore
 
 import (
-	"encoding/hex"
-	"regexp"
+	"github.com/costinm/uki-stub/pkg/efivar"
+	"github.com/costinm/uki-stub/pkg/smbios"
 )
 
-var guidPattern = regexp.MustCompile(`^([[:xdigit:]]{8})-([[:xdigit:]]{4})-([[:xdigit:]]{4})-([[:xdigit:]]{4})-([[:xdigit:]]{12})$`)
-
 // GUID represents an EFI GUID (Globally Unique Identifier).
 type GUID string
 
-// Bytes returns the GUID as byte slice.
-func (g GUID) Bytes() (guid []byte) {
-	var buf []byte
-	var err error
+// guidNames maps well known protocol and table GUIDs to short names.
+var guidNames = map[GUID]string{
+	EFI_LOADED_IMAGE_PROTOCOL_GUID:         "LoadedImage",
+	"bc62157e-3e33-4fec-9920-2d3b36d750df": "LoadedImageDevicePath",
+	EFI_DEVICE_PATH_PROTOCOL_GUID:          "DevicePath",
+	EFI_SIMPLE_FILE_SYSTEM_PROTOCOL_GUID:   "SimpleFileSystem",
+	EFI_FILE_INFO_ID:                       "FileInfo",
+	EFI_FILE_SYSTEM_INFO_ID:                "FileSystemInfo",
+	EFI_GRAPHICS_OUTPUT_PROTOCOL_GUID:      "GraphicsOutput",
+	"1c0c34f6-d380-41fa-a049-8ad06c1a66aa": "EdidDiscovered",
+	"bd8c1056-9f36-44ec-92a8-a6337f817986": "EdidActive",
+	"387477c1-69c7-11d2-8e39-00a0c969723b": "SimpleTextIn",
+	EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL_GUID: "SimpleTextInEx",
+	"387477c2-69c7-11d2-8e39-00a0c969723b": "SimpleTextOut",
+	"31878c87-0b75-11d5-9a4f-0090273fc14d": "SimplePointer",
+	"8d59d32b-c655-4ae9-9b15-f25904992a43": "AbsolutePointer",
+	EFI_SERIAL_IO_PROTOCOL_GUID:            "SerialIo",
+	"964e5b21-6459-11d2-8e39-00a0c969723b": "BlockIo",
+	"a77b2472-e282-4e9f-a245-c2c0e27bbcc1": "BlockIo2",
+	"ce345171-ba0b-11d2-8e4f-00a0c969723b": "DiskIo",
+	"151c8eae-7f2c-472c-9e54-9828194f6a88": "DiskIo2",
+	"d432a67f-14dc-484b-b3bb-3f0291849327": "DiskInfo",
+	EFI_PARTITION_INFO_PROTOCOL_GUID:       "PartitionInfo",
+	"c88b0b6d-0dfc-49a7-9cb4-49074b4c3a78": "StorageSecurityCommand",
+	"1d3de7f0-0807-424f-aa69-11a54e19a46f": "AtaPassThru",
+	"143b7632-b81b-4cb7-abd3-b625a5b9bffe": "ExtScsiPassThru",
+	"932f47e6-2362-4002-803e-3cd54b138f85": "ScsiIo",
+	"52c78312-8edc-4233-98f2-1a1aa5e388a5": "NvmExpressPassThru",
+	"2b2f68d6-0cd2-44cf-8e8b-bba20b1b5b75": "UsbIo",
+	"3e745226-9818-45b6-a2ac-d7cd0e8ba2bc": "Usb2Hc",
+	"4cf5b200-68b8-4ca5-9eec-b23e3f50029a": "PciIo",
+	"2f707ebb-4a1a-11d4-9a38-0090273fc14d": "PciRootBridgeIo",
+	"a19832b9-ac25-11d3-9a2d-0090273fc14d": "SimpleNetwork",
+	"03c4e603-ac28-11d3-9a2d-0090273fc14d": "PxeBaseCode",
+	"f36ff770-a7e1-42cf-9ed2-56f0f271f44c": "ManagedNetworkServiceBinding",
+	"7ab33a91-ace5-4326-b572-e7ee33d39f16": "ManagedNetwork",
+	"9d9a39d8-bd42-4a73-a4d5-8ee94be11380": "Dhcp4ServiceBinding",
+	"8a219718-4ef5-4761-91c8-c0f04bda9e56": "Dhcp4",
+	"5b446ed1-e30b-4faa-871a-3654eca36080": "Ip4Config2",
+	"56ec3091-954c-11d2-8e3f-00a0c969723b": "LoadFile",
+	EFI_LOAD_FILE2_PROTOCOL_GUID:           "LoadFile2",
+	"18a031ab-b443-4d1a-a5c0-0c09261e9f71": "DriverBinding",
+	"107a772c-d5e1-11d4-9a46-0090273fc14d": "ComponentName",
+	"6a7a5cff-e8d9-4f70-bada-75ab3025ce14": "ComponentName2",
+	"4d330321-025f-4aac-90d8-5ed900173b63": "DriverDiagnostics2",
+	"5c198761-16a8-4e69-972c-89d67954f81d": "DriverSupportedEfiVersion",
+	"3bc1b285-8a15-4a82-aabf-4d7d13fb3265": "BusSpecificDriverOverride",
+	"6b30c738-a391-11d4-9a3b-0090273fc14d": "PlatformDriverOverride",
+	"8b843e20-8132-4852-90cc-551a4e4a7f1c": "DevicePathToText",
+	"05c99a21-c70f-4ad2-8a5f-35df3343f51e": "DevicePathFromText",
+	"0379be4e-d706-437d-b037-edb82fb772a4": "DevicePathUtilities",
+	"1d85cd7f-f43d-11d2-9a0c-0090273fc14d": "UnicodeCollation",
+	"a4c751fc-23ae-4c3e-92e9-4964cf63f349": "UnicodeCollation2",
+	"ef9fc172-a1b2-4693-b327-6d32fc416042": "HiiDatabase",
+	"0fd96974-23aa-4cdc-b9cb-98d17750322a": "HiiString",
+	"e9ca4775-8657-47fc-97e7-7ed65a084324": "HiiFont",
+	"587e72d7-cc50-4f79-8209-ca291fc1a10f": "HiiConfigRouting",
+	"6a1ee763-d47a-43b4-aabe-ef1de2ab56fc": "HiiPackageList",
+	"220e73b6-6bdb-4413-8405-b974b108619a": "FirmwareVolume2",
+	"8f644fa9-e850-4db1-9ce2-0b44698e8da4": "FirmwareVolumeBlock2",
+	"d8117cfe-94a6-11d4-9a3a-0090273fc14d": "Decompress",
+	"13ac6dd1-73d0-11d4-b06b-00aa00bd6de7": "Ebc",
+	"2755590c-6f3c-42fa-9ea4-a3ba543cda25": "DebugSupport",
+	"ab38a0df-6873-44a9-87e6-d4eb56148449": "RamDisk",
+	"ffe06bdd-6107-46a6-7bb2-5a9c7ec5275c": "AcpiTable",
+	"03583ff6-cb36-4940-947e-b9b39f4afaf7": "Smbios",
+	"3152bca5-eade-433d-862e-c01cdc291f44": "Rng",
+	"55b1d734-c5e1-49db-9647-b16afb0e305b": "Hash2",
+	"afbfde41-2e6e-4262-ba65-62b9236e5495": "Timestamp",
+	"f4560cf6-40ec-4b4a-a192-bf1d57d0b189": "MemoryAttribute",
+	"f541796d-a62e-4954-a775-9584f61b9cdd": "Tcg",
+	"607f766c-7455-42be-930b-e4d76db2720f": "Tcg2",
+	"752f3136-4e16-4fdc-a22a-e5f46812f4ca": "ShellParameters",
+	"6302d008-7f9b-4f30-87ac-60c9fef5da4e": "Shell",
+	LINUX_EFI_INITRD_MEDIA_GUID:            "LinuxInitrdMedia",
 
-	m := guidPattern.FindStringSubmatch(string(g))
+	// configuration tables
+	"eb9d2d30-2d88-11d3-9a16-0090273fc14d": "Acpi",
+	"8868e871-e4f1-11d3-bc22-0080c73c8881": "Acpi20",
+	smbios.TableGUID:                       "Smbios",
+	smbios.Table3GUID:                      "Smbios3",
+	"7739f24c-93d7-11d4-9a3a-0090273fc14d": "HobList",
+}
 
-	if len(m) != 6 {
-		return make([]byte, 16)
-	}
+// NewGUID returns the registry format GUID for its argument mixed endian byte
+// representation.
+func NewGUID(buf []byte) GUID {
+	return GUID(efivar.NewGUID(buf))
+}
 
-	m = m[1:]
-
-	for i, b := range m {
-		if buf, err = hex.DecodeString(b); err != nil {
-			return make([]byte, 16)
-		}
-
-		switch i {
-		case 0:
-			guid = append(guid, buf[3])
-			guid = append(guid, buf[2])
-			guid = append(guid, buf[1])
-			guid = append(guid, buf[0])
-		case 1, 2:
-			guid = append(guid, buf[1])
-			guid = append(guid, buf[0])
-		default:
-			guid = append(guid, buf...)
-		}
+// Name returns the well known name for the GUID, or the GUID itself when
+// unknown.
+func (g GUID) Name() string {
+	if name, ok := guidNames[g]; ok {
+		return name
 	}
 
-	return
+	return string(g)
+}
+
+// Bytes returns the GUID as byte slice.
+func (g GUID) Bytes() []byte {
+	return efivar.GUID(g).Bytes()
 }
 
 func (g GUID) ptrval() uint64 {
@@ -0,0 +1,307 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/usbarmory/tamago/dma"
+)
+
+// EFI Boot Services offsets
+const (
+	allocatePool            = 0x40
+	freePool                = 0x48
+	openProtocolInformation = 0x128
+	protocolsPerHandle      = 0x130
+	locateHandleBuffer      = 0x138
+)
+
+// maxNodes limits device path parsing of firmware memory.
+const maxNodes = 64
+
+// EFI_LOCATE_SEARCH_TYPE
+const (
+	AllHandles = iota
+	ByRegisterNotify
+	ByProtocol
+)
+
+// EFI_OPEN_PROTOCOL attributes
+const (
+	EFI_OPEN_PROTOCOL_BY_HANDLE_PROTOCOL  = 0x00000001
+	EFI_OPEN_PROTOCOL_GET_PROTOCOL        = 0x00000002
+	EFI_OPEN_PROTOCOL_TEST_PROTOCOL       = 0x00000004
+	EFI_OPEN_PROTOCOL_BY_CHILD_CONTROLLER = 0x00000008
+	EFI_OPEN_PROTOCOL_BY_DRIVER           = 0x00000010
+	EFI_OPEN_PROTOCOL_EXCLUSIVE           = 0x00000020
+)
+
+// OpenProtocolInformationEntry represents an EFI Open Protocol Information
+// Entry instance.
+type OpenProtocolInformationEntry struct {
+	AgentHandle      uint64
+	ControllerHandle uint64
+	Attributes       uint32
+	OpenCount        uint32
+}
+
+// read copies size bytes found at the argument firmware address.
+func read(addr uint64, size int) (buf []byte, err error) {
+	if addr == 0 {
+		return nil, errors.New("invalid address")
+	}
+
+	if size == 0 {
+		return
+	}
+
+	r, err := dma.NewRegion(uint(addr), size, false)
+
+	if err != nil {
+		return
+	}
+
+	ptr, b := r.Reserve(size, 0)
+	defer r.Release(ptr)
+
+	buf = make([]byte, size)
+	copy(buf, b)
+
+	return
+}
+
+// write copies buf to the argument firmware address.
+func write(addr uint64, buf []byte) (err error) {
+	if addr == 0 {
+		return errors.New("invalid address")
+	}
+
+	if len(buf) == 0 {
+		return
+	}
+
+	r, err := dma.NewRegion(uint(addr), len(buf), false)
+
+	if err != nil {
+		return
+	}
+
+	ptr, b := r.Reserve(len(buf), 0)
+	defer r.Release(ptr)
+
+	copy(b, buf)
+
+	return
+}
+
+// AllocatePool calls EFI_BOOT_SERVICES.AllocatePool().
+func (s *BootServices) AllocatePool(memoryType int, size int) (addr uint64, err error) {
+	status := CallService(s.base+allocatePool,
+		[]uint64{
+			uint64(memoryType),
+			uint64(size),
+			ptrval(&addr),
+		},
+	)
+
+	return addr, parseStatus(status)
+}
+
+// AllocatePoolData allocates pool memory holding a copy of buf, for data
+// which must remain valid after the Go heap is gone (e.g. once the kernel
+// takes over).
+func (s *BootServices) AllocatePoolData(memoryType int, buf []byte) (addr uint64, err error) {
+	if addr, err = s.AllocatePool(memoryType, len(buf)); err != nil {
+		return
+	}
+
+	if err = write(addr, buf); err != nil {
+		s.FreePool(addr)
+		return 0, err
+	}
+
+	return
+}
+
+// FreePool calls EFI_BOOT_SERVICES.FreePool().
+func (s *BootServices) FreePool(addr uint64) error {
+	status := CallService(s.base+freePool,
+		[]uint64{
+			addr,
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// LocateHandleBuffer calls EFI_BOOT_SERVICES.LocateHandleBuffer(), the GUID
+// argument is ignored when searching for AllHandles.
+func (s *BootServices) LocateHandleBuffer(searchType int, guid GUID) (handles []uint64, err error) {
+	var count uint64
+	var addr uint64
+	var protocol uint64
+
+	if searchType != AllHandles {
+		protocol = guid.ptrval()
+	}
+
+	status := CallService(s.base+locateHandleBuffer,
+		[]uint64{
+			uint64(searchType),
+			protocol,
+			0,
+			ptrval(&count),
+			ptrval(&addr),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	defer s.FreePool(addr)
+
+	buf, err := read(addr, int(count)*8)
+
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(buf); i += 8 {
+		handles = append(handles, binary.LittleEndian.Uint64(buf[i:]))
+	}
+
+	return
+}
+
+// ProtocolsPerHandle calls EFI_BOOT_SERVICES.ProtocolsPerHandle().
+func (s *BootServices) ProtocolsPerHandle(handle uint64) (guids []GUID, err error) {
+	var count uint64
+	var addr uint64
+
+	status := CallService(s.base+protocolsPerHandle,
+		[]uint64{
+			handle,
+			ptrval(&addr),
+			ptrval(&count),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	defer s.FreePool(addr)
+
+	buf, err := read(addr, int(count)*8)
+
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(buf); i += 8 {
+		g, err := read(binary.LittleEndian.Uint64(buf[i:]), 16)
+
+		if err != nil {
+			return nil, err
+		}
+
+		guids = append(guids, NewGUID(g))
+	}
+
+	return
+}
+
+// OpenProtocolInformation calls EFI_BOOT_SERVICES.OpenProtocolInformation().
+func (s *BootServices) OpenProtocolInformation(handle uint64, guid GUID) (entries []*OpenProtocolInformationEntry, err error) {
+	var count uint64
+	var addr uint64
+
+	status := CallService(s.base+openProtocolInformation,
+		[]uint64{
+			handle,
+			guid.ptrval(),
+			ptrval(&addr),
+			ptrval(&count),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	defer s.FreePool(addr)
+
+	e := &OpenProtocolInformationEntry{}
+	t, _ := marshalBinary(e)
+	n := len(t)
+
+	buf, err := read(addr, int(count)*n)
+
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(buf); i += n {
+		if err = unmarshalBinary(buf[i:i+n], e); err != nil {
+			return
+		}
+
+		entries = append(entries, e)
+		e = &OpenProtocolInformationEntry{}
+	}
+
+	return
+}
+
+// DevicePath returns the binary EFI Device Path installed on the argument
+// handle, including its End Entire Device Path node.
+func (s *BootServices) DevicePath(handle uint64) (buf []byte, err error) {
+	addr, err := s.HandleProtocol(handle, EFI_DEVICE_PATH_PROTOCOL_GUID)
+
+	if err != nil {
+		return
+	}
+
+	return readDevicePath(addr)
+}
+
+// readDevicePath copies a binary EFI Device Path found at the argument
+// firmware address.
+func readDevicePath(addr uint64) (buf []byte, err error) {
+	for i := 0; i <= maxNodes; i++ {
+		if i == maxNodes {
+			return nil, errors.New("device path nodes limit exceeded")
+		}
+
+		node := &DevicePathNode{}
+
+		if err = decode(node, addr+uint64(len(buf))); err != nil {
+			return
+		}
+
+		if node.Length < 4 {
+			return nil, errors.New("invalid length")
+		}
+
+		b, err := read(addr+uint64(len(buf)), int(node.Length))
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b...)
+
+		if node.Type == 0x7f && // End of Hardware Device Path
+			node.SubType == 0xff { // End Entire Device Path
+			return buf, nil
+		}
+	}
+
+	return
+}
@@ -11,8 +11,9 @@ import (
 
 // EFI Boot Services offsets
 const (
-	loadImage  = 0xc8
-	startImage = 0xd0
+	loadImage   = 0xc8
+	startImage  = 0xd0
+	unloadImage = 0xe0
 )
 
 // LoadImage calls EFI_BOOT_SERVICES.LoadImage().
@@ -82,3 +83,14 @@ func (s *BootServices) StartImage(imageHandle uint64) (err error) {
 
 	return parseStatus(status)
 }
+
+// UnloadImage calls EFI_BOOT_SERVICES.UnloadImage().
+func (s *BootServices) UnloadImage(imageHandle uint64) (err error) {
+	status := CallService(s.base+unloadImage,
+		[]uint64{
+			imageHandle,
+		},
+	)
+
+	return parseStatus(status)
+}
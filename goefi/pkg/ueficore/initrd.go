@@ -0,0 +1,113 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+)
+
+const (
+	EFI_LOAD_FILE2_PROTOCOL_GUID = "4006c0c1-fcb3-403e-996d-4a6c8724e06d"
+	LINUX_EFI_INITRD_MEDIA_GUID  = "5568e427-68fc-4f3d-ac74-ca555231cc68"
+)
+
+// defined in initrd.s
+func initrdLoadFile()
+func initrdLoadFileAddr() uint64
+
+// loadFile2 represents an EFI Load File2 Protocol instance, the initrd
+// location is appended for initrdLoadFile.
+type loadFile2 struct {
+	LoadFile uint64
+	Addr     uint64
+	Size     uint64
+}
+
+// Initrd represents an initrd served from memory to the Linux EFI stub, which
+// locates it through the LINUX_EFI_INITRD_MEDIA_GUID vendor device path and
+// its Load File2 Protocol (Linux 5.8 or later), in place of initrd= files.
+type Initrd struct {
+	// Handle is the handle holding the initrd protocols.
+	Handle uint64
+
+	s          *BootServices
+	buf        []byte
+	devicePath []byte
+	proto      *loadFile2
+}
+
+// active references the installed initrd, it must not be collected while
+// firmware holds pointers to it.
+var active *Initrd
+
+// InstallInitrd makes the argument initrd available to the next started
+// Linux kernel, only one initrd can be installed at a time.
+func (s *BootServices) InstallInitrd(buf []byte) (initrd *Initrd, err error) {
+	if active != nil {
+		return nil, errors.New("initrd already installed")
+	}
+
+	if len(buf) == 0 {
+		return nil, errors.New("empty initrd")
+	}
+
+	vendor := &devpath.Node{
+		Type:    devpath.TypeMedia,
+		SubType: devpath.SubTypeVendor,
+		Data:    GUID(LINUX_EFI_INITRD_MEDIA_GUID).Bytes(),
+	}
+
+	initrd = &Initrd{
+		s:          s,
+		buf:        buf,
+		devicePath: devpath.Path{vendor}.Bytes(),
+		proto: &loadFile2{
+			LoadFile: initrdLoadFileAddr(),
+			Addr:     ptrval(&buf[0]),
+			Size:     uint64(len(buf)),
+		},
+	}
+
+	if initrd.Handle, err = s.InstallProtocolInterface(0, EFI_DEVICE_PATH_PROTOCOL_GUID, ptrval(&initrd.devicePath[0])); err != nil {
+		return nil, err
+	}
+
+	if _, err = s.InstallProtocolInterface(initrd.Handle, EFI_LOAD_FILE2_PROTOCOL_GUID, initrd.iface()); err != nil {
+		s.UninstallProtocolInterface(initrd.Handle, EFI_DEVICE_PATH_PROTOCOL_GUID, ptrval(&initrd.devicePath[0]))
+		return nil, err
+	}
+
+	active = initrd
+
+	return
+}
+
+func (initrd *Initrd) iface() uint64 {
+	return uint64(uintptr(unsafe.Pointer(initrd.proto)))
+}
+
+// Uninstall removes the initrd protocols, it must be called when the kernel
+// returns or was not started.
+func (initrd *Initrd) Uninstall() (err error) {
+	s := initrd.s
+
+	if err = s.UninstallProtocolInterface(initrd.Handle, EFI_LOAD_FILE2_PROTOCOL_GUID, initrd.iface()); err != nil {
+		return
+	}
+
+	if err = s.UninstallProtocolInterface(initrd.Handle, EFI_DEVICE_PATH_PROTOCOL_GUID, ptrval(&initrd.devicePath[0])); err != nil {
+		return
+	}
+
+	if active == initrd {
+		active = nil
+	}
+
+	return
+}
@@ -0,0 +1,66 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+#define EFI_INVALID_PARAMETER	$0x8000000000000002
+#define EFI_UNSUPPORTED		$0x8000000000000003
+#define EFI_BUFFER_TOO_SMALL	$0x8000000000000005
+
+// initrdLoadFile implements EFI_LOAD_FILE2_PROTOCOL.LoadFile(), it is invoked
+// by firmware (or the Linux EFI stub) with the Microsoft x64 calling
+// convention and therefore must not use the Go runtime or stack.
+//
+// The This argument points to a loadFile2 instance, the initrd address and
+// size follow the LoadFile pointer.
+//
+// func initrdLoadFile()
+TEXT ·initrdLoadFile(SB),NOSPLIT|NOFRAME,$0
+	MOVQ	EFI_INVALID_PARAMETER, AX
+
+	// BufferSize
+	CMPQ	R9, $0
+	JE	done
+
+	// BootPolicy must be FALSE
+	CMPB	R8, $0
+	JE	load
+	MOVQ	EFI_UNSUPPORTED, AX
+	RET
+load:
+	MOVQ	16(CX), R10	// size
+	MOVQ	40(SP), R11	// Buffer
+
+	CMPQ	R11, $0
+	JE	small
+	CMPQ	(R9), R10
+	JB	small
+
+	MOVQ	R10, (R9)
+
+	// RSI and RDI are callee-saved
+	PUSHQ	SI
+	PUSHQ	DI
+	MOVQ	8(CX), SI
+	MOVQ	R11, DI
+	MOVQ	R10, CX
+	CLD
+	REP;	MOVSB
+	POPQ	DI
+	POPQ	SI
+
+	XORQ	AX, AX
+	RET
+small:
+	MOVQ	R10, (R9)
+	MOVQ	EFI_BUFFER_TOO_SMALL, AX
+done:
+	RET
+
+// func initrdLoadFileAddr() uint64
+TEXT ·initrdLoadFileAddr(SB),NOSPLIT,$0-8
+	MOVQ	$·initrdLoadFile(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
@@ -0,0 +1,254 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+)
+
+const EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL_GUID = "dd9e7534-7762-4698-8c14-f58517a625aa"
+
+// EFI Simple Text Input Ex Protocol offsets
+const (
+	readKeyStrokeEx     = 0x08
+	waitForKeyEx        = 0x10
+	setState            = 0x18
+	registerKeyNotify   = 0x20
+	unregisterKeyNotify = 0x28
+)
+
+// EFI_KEY_STATE.KeyShiftState
+const (
+	EFI_SHIFT_STATE_VALID     = 0x80000000
+	EFI_RIGHT_SHIFT_PRESSED   = 0x00000001
+	EFI_LEFT_SHIFT_PRESSED    = 0x00000002
+	EFI_RIGHT_CONTROL_PRESSED = 0x00000004
+	EFI_LEFT_CONTROL_PRESSED  = 0x00000008
+	EFI_RIGHT_ALT_PRESSED     = 0x00000010
+	EFI_LEFT_ALT_PRESSED      = 0x00000020
+	EFI_RIGHT_LOGO_PRESSED    = 0x00000040
+	EFI_LEFT_LOGO_PRESSED     = 0x00000080
+	EFI_MENU_KEY_PRESSED      = 0x00000100
+	EFI_SYS_REQ_PRESSED       = 0x00000200
+)
+
+// EFI_KEY_STATE.KeyToggleState
+const (
+	EFI_TOGGLE_STATE_VALID = 0x80
+	EFI_KEY_STATE_EXPOSED  = 0x40
+	EFI_SCROLL_LOCK_ACTIVE = 0x01
+	EFI_NUM_LOCK_ACTIVE    = 0x02
+	EFI_CAPS_LOCK_ACTIVE   = 0x04
+)
+
+// EFI scan codes
+const (
+	SCAN_NULL      = 0x00
+	SCAN_UP        = 0x01
+	SCAN_DOWN      = 0x02
+	SCAN_RIGHT     = 0x03
+	SCAN_LEFT      = 0x04
+	SCAN_HOME      = 0x05
+	SCAN_END       = 0x06
+	SCAN_INSERT    = 0x07
+	SCAN_DELETE    = 0x08
+	SCAN_PAGE_UP   = 0x09
+	SCAN_PAGE_DOWN = 0x0a
+	SCAN_F1        = 0x0b
+	SCAN_F10       = 0x14
+	SCAN_F11       = 0x15
+	SCAN_F12       = 0x16
+	SCAN_ESC       = 0x17
+)
+
+// KeyData represents an EFI Key Data descriptor.
+type KeyData struct {
+	Key         InputKey
+	ShiftState  uint32
+	ToggleState uint8
+}
+
+// Char returns the Unicode character of the key, 0 for scan codes.
+func (k *KeyData) Char() rune {
+	return rune(binary.LittleEndian.Uint16(k.Key.UnicodeChar[:]))
+}
+
+// Shift returns whether any shift key is pressed.
+func (k *KeyData) Shift() bool {
+	return k.shiftState(EFI_RIGHT_SHIFT_PRESSED | EFI_LEFT_SHIFT_PRESSED)
+}
+
+// Ctrl returns whether any control key is pressed.
+func (k *KeyData) Ctrl() bool {
+	return k.shiftState(EFI_RIGHT_CONTROL_PRESSED | EFI_LEFT_CONTROL_PRESSED)
+}
+
+// Alt returns whether any alt key is pressed.
+func (k *KeyData) Alt() bool {
+	return k.shiftState(EFI_RIGHT_ALT_PRESSED | EFI_LEFT_ALT_PRESSED)
+}
+
+func (k *KeyData) shiftState(mask uint32) bool {
+	return k.ShiftState&EFI_SHIFT_STATE_VALID != 0 && k.ShiftState&mask != 0
+}
+
+// InputEx calls EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL.ReadKeyStrokeEx(), or
+// EFI_SIMPLE_TEXT_INPUT_PROTOCOL.ReadKeyStroke() without key state when the
+// console has no extended input.
+func (c *Console) InputEx(k *KeyData) (status uint64) {
+	if c.InEx == 0 {
+		k.ShiftState = 0
+		k.ToggleState = 0
+
+		return c.Input(&k.Key)
+	}
+
+	return CallService(c.InEx+readKeyStrokeEx,
+		[]uint64{
+			c.InEx,
+			ptrval(k),
+		},
+	)
+}
+
+// SetState calls EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL.SetState(), to set the
+// toggle keys (e.g. EFI_NUM_LOCK_ACTIVE), EFI_TOGGLE_STATE_VALID is added.
+func (c *Console) SetState(toggle uint8) error {
+	if c.InEx == 0 {
+		return errors.New("no extended console input")
+	}
+
+	toggle |= EFI_TOGGLE_STATE_VALID
+
+	status := CallService(c.InEx+setState,
+		[]uint64{
+			c.InEx,
+			ptrval(&toggle),
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// defined in keyboard.s
+func keyNotify()
+func keyNotifyAddr() uint64
+
+// keyRingSize is the number of notified keystrokes kept, it must be a power
+// of 2.
+const keyRingSize = 16
+
+// keySlot represents a notified keystroke, padded to 16 bytes for
+// keyNotify.
+type keySlot struct {
+	KeyData
+	_ uint32
+}
+
+// written by keyNotify, from firmware context
+var (
+	keyRing       [keyRingSize]keySlot
+	keyNotifyHead uint64
+)
+
+// Hotkeys represents a set of keystrokes registered through
+// EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL.RegisterKeyNotify().
+//
+// As firmware cannot call into Go code, notifications are recorded by an
+// assembly function and collected with Pressed().
+type Hotkeys struct {
+	console *Console
+	keys    []*KeyData
+	handles []uint64
+	next    uint64
+}
+
+// NewHotkeys returns an empty hotkey set on the console extended input.
+func (c *Console) NewHotkeys() (h *Hotkeys, err error) {
+	if c.InEx == 0 {
+		return nil, errors.New("no extended console input")
+	}
+
+	h = &Hotkeys{
+		console: c,
+		next:    atomic.LoadUint64(&keyNotifyHead),
+	}
+
+	return
+}
+
+// Register adds a keystroke to the set. Shift and toggle states are only
+// matched when marked valid.
+func (h *Hotkeys) Register(k KeyData) (err error) {
+	var handle uint64
+
+	// kept referenced until Close()
+	key := &k
+
+	status := CallService(h.console.InEx+registerKeyNotify,
+		[]uint64{
+			h.console.InEx,
+			ptrval(key),
+			keyNotifyAddr(),
+			ptrval(&handle),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	h.keys = append(h.keys, key)
+	h.handles = append(h.handles, handle)
+
+	return
+}
+
+// Pressed returns the registered keystrokes notified since the previous
+// call, older notifications are lost when more than 16 are pending.
+func (h *Hotkeys) Pressed() (keys []KeyData) {
+	head := atomic.LoadUint64(&keyNotifyHead)
+
+	if head-h.next > keyRingSize {
+		h.next = head - keyRingSize
+	}
+
+	for ; h.next < head; h.next++ {
+		k := keyRing[h.next&(keyRingSize-1)].KeyData
+
+		for _, key := range h.keys {
+			if key.Key == k.Key {
+				keys = append(keys, k)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// Close unregisters all keystrokes of the set.
+func (h *Hotkeys) Close() (err error) {
+	for _, handle := range h.handles {
+		status := CallService(h.console.InEx+unregisterKeyNotify,
+			[]uint64{
+				h.console.InEx,
+				handle,
+			},
+		)
+
+		if e := parseStatus(status); e != nil {
+			err = e
+		}
+	}
+
+	h.keys = nil
+	h.handles = nil
+
+	return
+}
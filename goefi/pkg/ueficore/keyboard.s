@@ -0,0 +1,41 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// keyNotify implements EFI_KEY_NOTIFY_FUNCTION, it is invoked by firmware
+// with the Microsoft x64 calling convention and therefore must not use the Go
+// runtime or stack.
+//
+// The KeyData argument is copied to the next keyRing slot, keyNotifyHead is
+// incremented after the copy.
+//
+// func keyNotify()
+TEXT ·keyNotify(SB),NOSPLIT|NOFRAME,$0
+	MOVQ	·keyNotifyHead(SB), AX
+	MOVQ	AX, DX
+	ANDQ	$15, DX		// keyRingSize-1
+	SHLQ	$4, DX		// sizeof(keySlot)
+
+	LEAQ	·keyRing(SB), R8
+	ADDQ	DX, R8
+
+	// EFI_KEY_DATA
+	MOVQ	0(CX), R9
+	MOVQ	R9, 0(R8)
+	MOVL	8(CX), R9
+	MOVL	R9, 8(R8)
+
+	INCQ	AX
+	MOVQ	AX, ·keyNotifyHead(SB)
+
+	XORQ	AX, AX
+	RET
+
+// func keyNotifyAddr() uint64
+TEXT ·keyNotifyAddr(SB),NOSPLIT,$0-8
+	MOVQ	$·keyNotify(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
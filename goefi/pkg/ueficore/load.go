@@ -0,0 +1,107 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// loadChunkSize is the size of each file read, a multiple of PageSize.
+const loadChunkSize = 1 << 20
+
+// LoadedFile represents a file read into EFI pages.
+type LoadedFile struct {
+	// Name is the file path.
+	Name string
+	// Data holds the file contents, it references the pages and is only
+	// valid until Free is called.
+	Data []byte
+	// SHA256 is the digest of Data.
+	SHA256 []byte
+	// Elapsed is the time spent reading and hashing the file.
+	Elapsed time.Duration
+
+	pages *Pages
+}
+
+// ReadFile reads a file into exactly sized EFI pages, rather than the Go
+// heap, hashing its contents while reading. Additional digests can be passed
+// to be fed with the same data.
+//
+// The returned buffer can be passed to LoadImageMem or InstallInitrd without
+// copying, [LoadedFile.Free] must be called once it is no longer needed.
+func (s *BootServices) ReadFile(root *FS, name string, digests ...hash.Hash) (f *LoadedFile, err error) {
+	start := time.Now()
+
+	file, err := root.OpenFile(name, EFI_FILE_MODE_READ, 0)
+
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	size := int(info.Size())
+	sum := sha256.New()
+	digests = append(digests, sum)
+
+	f = &LoadedFile{
+		Name: name,
+	}
+
+	if size > 0 {
+		if f.pages, err = s.NewPages(EfiLoaderData, size); err != nil {
+			return nil, fmt.Errorf("could not allocate %d bytes, %v", size, err)
+		}
+
+		f.Data = f.pages.Bytes()[:size]
+	}
+
+	for off := 0; off < size; {
+		n, err := file.Read(f.Data[off:min(off+loadChunkSize, size)])
+
+		if err == io.EOF || err == nil && n == 0 {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			f.Free()
+			return nil, fmt.Errorf("could not read %s, %v", name, err)
+		}
+
+		for _, d := range digests {
+			d.Write(f.Data[off : off+n])
+		}
+
+		off += n
+	}
+
+	f.SHA256 = sum.Sum(nil)
+	f.Elapsed = time.Since(start)
+
+	return
+}
+
+// Free releases the pages holding the file contents, further calls have no
+// effect.
+func (f *LoadedFile) Free() error {
+	f.Data = nil
+	return f.pages.Free()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// EFI_LOADED_IMAGE_PROTOCOL offsets
+const (
+	loadOptionsSize = 48
+	loadOptions     = 56
+)
+
+// maxLoadOptionsSize limits reading of LoadOptions.
+const maxLoadOptionsSize = 1 << 16
+
+// LoadOptions returns the raw LoadOptions of the argument image, as set by
+// the firmware boot entry or the image parent.
+func (s *BootServices) LoadOptions(imageHandle uint64) (buf []byte, err error) {
+	image, _, err := s.LoadImageHandle(imageHandle)
+
+	if err != nil {
+		return
+	}
+
+	if image.LoadOptionsSize > maxLoadOptionsSize {
+		return nil, fmt.Errorf("LoadOptions size exceeds %d bytes", maxLoadOptionsSize)
+	}
+
+	if image.LoadOptions == 0 || image.LoadOptionsSize == 0 {
+		return
+	}
+
+	return read(image.LoadOptions, int(image.LoadOptionsSize))
+}
+
+// SetLoadOptions sets the LoadOptions of a loaded, not yet started, image to
+// the argument string as NUL terminated UTF-16 text (e.g. the Linux cmdline).
+//
+// The text is copied to pool memory, which is never freed as the image may
+// reference it at any time.
+func (s *BootServices) SetLoadOptions(imageHandle uint64, options string) (err error) {
+	_, addr, err := s.LoadImageHandle(imageHandle)
+
+	if err != nil {
+		return
+	}
+
+	buf := efivar.EncodeString(options)
+
+	if len(buf) > maxLoadOptionsSize {
+		return fmt.Errorf("LoadOptions size exceeds %d bytes", maxLoadOptionsSize)
+	}
+
+	ptr, err := s.AllocatePoolData(EfiLoaderData, buf)
+
+	if err != nil {
+		return
+	}
+
+	if err = write(addr+loadOptions, binary.LittleEndian.AppendUint64(nil, ptr)); err != nil {
+		s.FreePool(ptr)
+		return
+	}
+
+	return write(addr+loadOptionsSize, binary.LittleEndian.AppendUint32(nil, uint32(len(buf))))
+}
+
+// ImageDevicePath returns the device path of the device the argument image
+// was loaded from.
+func (s *BootServices) ImageDevicePath(imageHandle uint64) (p devpath.Path, err error) {
+	image, _, err := s.LoadImageHandle(imageHandle)
+
+	if err != nil {
+		return
+	}
+
+	buf, err := s.DevicePath(image.DeviceHandle)
+
+	if err != nil {
+		return
+	}
+
+	p, _, err = devpath.Parse(buf)
+
+	return
+}
+
+// ImageFilePath returns the file path of the argument image, relative to its
+// device.
+func (s *BootServices) ImageFilePath(imageHandle uint64) (p devpath.Path, err error) {
+	image, _, err := s.LoadImageHandle(imageHandle)
+
+	if err != nil {
+		return
+	}
+
+	buf, err := readDevicePath(image.FilePath)
+
+	if err != nil {
+		return
+	}
+
+	p, _, err = devpath.Parse(buf)
+
+	return
+}
+
+// LoadOptions returns the raw LoadOptions of the current EFI image.
+func (s *Services) LoadOptions() ([]byte, error) {
+	return s.Boot.LoadOptions(s.imageHandle)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/costinm/uki-stub/pkg/devpath"
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// maxStringSize limits reading of firmware strings.
+const maxStringSize = 256
+
+// readString copies a NUL terminated UTF-16 string found at the argument
+// firmware address.
+func readString(addr uint64) (s string, err error) {
+	var buf []byte
+
+	for i := 0; i < maxStringSize; i++ {
+		c, err := read(addr+uint64(i*2), 2)
+
+		if err != nil {
+			return "", err
+		}
+
+		if c[0] == 0 && c[1] == 0 {
+			break
+		}
+
+		buf = append(buf, c...)
+	}
+
+	return efivar.DecodeString(buf), nil
+}
+
+// FirmwareVendor returns the EFI System Table firmware vendor string.
+func (s *Services) FirmwareVendor() (string, error) {
+	return readString(s.SystemTable.FirmwareVendor)
+}
+
+// LoaderInfo returns the Boot Loader Interface variables describing the
+// running image: the ESP partition GUID, taken from the Hard Drive node of
+// the image device path, the image path and the firmware identification.
+func (s *Services) LoaderInfo() (info *efivar.LoaderInfo, err error) {
+	info = &efivar.LoaderInfo{}
+
+	image, _, err := s.Boot.LoadImageHandle(s.imageHandle)
+
+	if err != nil {
+		return
+	}
+
+	if buf, err := s.Boot.DevicePath(image.DeviceHandle); err == nil {
+		if p, _, err := devpath.Parse(buf); err == nil {
+			if hd := p.HardDrive(); hd != nil {
+				info.DevicePartUUID = strings.ToUpper(hd.PartitionGUID())
+			}
+		}
+	}
+
+	if buf, err := readDevicePath(image.FilePath); err == nil {
+		if p, _, err := devpath.Parse(buf); err == nil {
+			info.ImageIdentifier = p.File()
+		}
+	}
+
+	vendor, _ := s.FirmwareVendor()
+	rev := s.SystemTable.FirmwareRevision
+
+	info.FirmwareInfo = fmt.Sprintf("%s %d.%02d", vendor, rev>>16, rev&0xffff)
+	info.FirmwareType = "UEFI " + s.SystemTable.Revision()
+
+	return
+}
@@ -0,0 +1,91 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"io"
+	"time"
+)
+
+// ConsoleMux implements the [io.ReadWriter] interface over the EFI text
+// console and serial terminals, output is mirrored to all of them and input
+// is merged.
+type ConsoleMux struct {
+	// Console is the EFI text console, for input and, unless Display is
+	// set, output. Escape sequences are interpreted (see Console.Write).
+	Console *Console
+
+	// Display, when set, replaces the Console output (e.g.
+	// FramebufferConsole).
+	Display io.Writer
+
+	// Terminals are VT100 serial terminals (e.g. SerialIO), output is
+	// passed through with LF supplemented with CR.
+	Terminals []io.ReadWriter
+}
+
+// Write data from buffer to all consoles, the first error is returned.
+func (m *ConsoleMux) Write(p []byte) (n int, err error) {
+	switch {
+	case m.Display != nil:
+		_, err = m.Display.Write(p)
+	case m.Console != nil:
+		_, err = m.Console.Write(p)
+	}
+
+	if len(m.Terminals) == 0 {
+		return len(p), err
+	}
+
+	s := make([]byte, 0, len(p))
+
+	for i, b := range p {
+		if b == lf && (i == 0 || p[i-1] != cr) {
+			s = append(s, cr)
+		}
+
+		s = append(s, b)
+	}
+
+	for _, t := range m.Terminals {
+		if _, e := t.Write(s); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return len(p), err
+}
+
+// Read reads data to buffer from the first console with input, blocking
+// until one has.
+//
+// Without terminals the console WaitForKey event is waited on, terminals
+// (e.g. SerialIO) have no such event and are polled.
+func (m *ConsoleMux) Read(p []byte) (n int, err error) {
+	if len(m.Terminals) == 0 && m.Console != nil {
+		return m.Console.Read(p)
+	}
+
+	for {
+		for _, t := range m.Terminals {
+			if n, _ = t.Read(p); n > 0 {
+				return
+			}
+		}
+
+		if m.Console != nil {
+			if n, err = m.Console.Poll(p); n > 0 || err != nil {
+				return
+			}
+		}
+
+		if len(p) == 0 {
+			return
+		}
+
+		time.Sleep(1 * time.Millisecond)
+	}
+}
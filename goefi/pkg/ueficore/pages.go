@@ -5,6 +5,12 @@
 
 package ueficore
 
+import (
+	"errors"
+
+	"github.com/usbarmory/tamago/dma"
+)
+
 // EFI Boot Service offsets
 const (
 	allocatePages = 0x28
@@ -65,3 +71,78 @@ func (s *BootServices) FreePages(physicalAddress uint64, size int) error {
 
 	return parseStatus(status)
 }
+
+// Pages represents memory allocated with EFI_BOOT_SERVICES.AllocatePages(),
+// outside the Go heap.
+type Pages struct {
+	s      *BootServices
+	addr   uint64
+	size   int
+	region *dma.Region
+	buf    []byte
+}
+
+// NewPages allocates pages for at least size bytes, at any address, the
+// memory is accessible through [Pages.Bytes] until [Pages.Free] is called.
+func (s *BootServices) NewPages(memoryType int, size int) (p *Pages, err error) {
+	var addr uint64
+
+	if size <= 0 {
+		return nil, errors.New("invalid size")
+	}
+
+	size = (size + PageSize - 1) &^ (PageSize - 1)
+
+	status := CallService(s.base+allocatePages,
+		[]uint64{
+			uint64(AllocateAnyPages),
+			uint64(memoryType),
+			uint64(size) / PageSize,
+			ptrval(&addr),
+		},
+	)
+
+	if err = parseStatus(status); err != nil {
+		return
+	}
+
+	r, err := dma.NewRegion(uint(addr), size, false)
+
+	if err != nil {
+		s.FreePages(addr, size)
+		return
+	}
+
+	p = &Pages{
+		s:      s,
+		addr:   addr,
+		size:   size,
+		region: r,
+	}
+
+	_, p.buf = r.Reserve(size, 0)
+
+	return
+}
+
+// Address returns the physical address of the pages.
+func (p *Pages) Address() uint64 {
+	return p.addr
+}
+
+// Bytes returns the pages memory, its length is a multiple of PageSize.
+func (p *Pages) Bytes() []byte {
+	return p.buf
+}
+
+// Free releases the pages, which must no longer be referenced.
+func (p *Pages) Free() error {
+	if p == nil || p.buf == nil {
+		return nil
+	}
+
+	p.region.Release(uint(p.addr))
+	p.buf = nil
+
+	return p.s.FreePages(p.addr, p.size)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+const EFI_PARTITION_INFO_PROTOCOL_GUID = "8cf2f62c-bc9b-4821-808d-ec9ec421a1a0"
+
+// EFI_PARTITION_INFO_PROTOCOL partition types
+const (
+	PARTITION_TYPE_OTHER = 0x00
+	PARTITION_TYPE_MBR   = 0x01
+	PARTITION_TYPE_GPT   = 0x02
+)
+
+// partitionInfoSize is the size of EFI_PARTITION_INFO_PROTOCOL, with a
+// 128 bytes GPT partition entry.
+const partitionInfoSize = 16 + 128
+
+// Partition represents a GPT partition, from the EFI Partition Information
+// Protocol installed by firmware on partition handles.
+type Partition struct {
+	Handle uint64
+
+	// TypeGUID and PartUUID are the GPT partition type and unique
+	// partition GUIDs, in lower case registry format.
+	TypeGUID string
+	PartUUID string
+
+	StartingLBA uint64
+	EndingLBA   uint64
+	Attributes  uint64
+	// Name is the GPT partition name (label).
+	Name string
+}
+
+// Partitions returns all GPT partitions, MBR partitions are skipped.
+func (s *Services) Partitions() (partitions []*Partition, err error) {
+	handles, err := s.Boot.LocateHandleBuffer(ByProtocol, EFI_PARTITION_INFO_PROTOCOL_GUID)
+
+	if err != nil {
+		return nil, errors.New("partition information not available")
+	}
+
+	for _, h := range handles {
+		addr, err := s.Boot.HandleProtocol(h, EFI_PARTITION_INFO_PROTOCOL_GUID)
+
+		if err != nil {
+			continue
+		}
+
+		buf, err := read(addr, partitionInfoSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if binary.LittleEndian.Uint32(buf[4:]) != PARTITION_TYPE_GPT {
+			continue
+		}
+
+		entry := buf[16:]
+
+		partitions = append(partitions, &Partition{
+			Handle:      h,
+			TypeGUID:    string(efivar.NewGUID(entry[0:16])),
+			PartUUID:    string(efivar.NewGUID(entry[16:32])),
+			StartingLBA: binary.LittleEndian.Uint64(entry[32:]),
+			EndingLBA:   binary.LittleEndian.Uint64(entry[40:]),
+			Attributes:  binary.LittleEndian.Uint64(entry[48:]),
+			Name:        efivar.DecodeString(entry[56:128]),
+		})
+	}
+
+	return
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/costinm/uki-stub/pkg/efivar"
 	"github.com/usbarmory/tamago/dma"
 )
 
@@ -115,7 +116,7 @@ func (d *FilePath) Bytes() []byte {
 
 // FilePath returns the full EFI Device Path associated with the named file.
 func (root *FS) FilePath(name string) (devicePath []*DevicePath, filePath *FilePath, desc []byte, err error) {
-	pathName := toUTF16(name)
+	pathName := efivar.EncodeString(name)
 
 	filePath = &FilePath{
 		PathName: pathName,
@@ -7,10 +7,44 @@ package ueficore
 
 // EFI Boot Services offsets
 const (
-	handleProtocol = 0x098
-	locateProtocol = 0x140
+	installProtocolInterface   = 0x080
+	uninstallProtocolInterface = 0x090
+	handleProtocol             = 0x098
+	locateProtocol             = 0x140
 )
 
+// EFI_INTERFACE_TYPE
+const EFI_NATIVE_INTERFACE = 0
+
+// InstallProtocolInterface calls EFI_BOOT_SERVICES.InstallProtocolInterface(),
+// a new handle is created and returned when the argument handle is 0.
+func (s *BootServices) InstallProtocolInterface(handle uint64, guid GUID, iface uint64) (uint64, error) {
+	status := CallService(s.base+installProtocolInterface,
+		[]uint64{
+			ptrval(&handle),
+			guid.ptrval(),
+			EFI_NATIVE_INTERFACE,
+			iface,
+		},
+	)
+
+	return handle, parseStatus(status)
+}
+
+// UninstallProtocolInterface calls
+// EFI_BOOT_SERVICES.UninstallProtocolInterface().
+func (s *BootServices) UninstallProtocolInterface(handle uint64, guid GUID, iface uint64) (err error) {
+	status := CallService(s.base+uninstallProtocolInterface,
+		[]uint64{
+			handle,
+			guid.ptrval(),
+			iface,
+		},
+	)
+
+	return parseStatus(status)
+}
+
 // HandleProtocol calls EFI_BOOT_SERVICES.HandleProtocol().
 func (s *BootServices) HandleProtocol(handle uint64, guid GUID) (addr uint64, err error) {
 	status := CallService(s.base+handleProtocol,
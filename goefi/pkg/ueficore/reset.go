@@ -5,12 +5,6 @@
 
 package ueficore
 
-import (
-	"unsafe"
-
-	"github.com/costinm/uki-stub/pkg/uefi"
-)
-
 // s.base is the pointer to the table
 // 24 bytes header (0x18)
 
@@ -45,20 +39,3 @@ func (s *RuntimeServices) ResetSystem(resetType int) (err error) {
 
 	return parseStatus(status)
 }
-
-func (s *RuntimeServices) GetVariable(name []uint16, guid []uint8) (data []byte, attr uint32, err error) {
-	var (
-		dataSize uefi.UINTN
-	)
-	data = make([]byte, 16)
-
-	status := CallService(s.base+getVariable,
-		[]uint64{
-			(uint64)(uintptr(unsafe.Pointer(&name[0]))),
-			(uint64)(uintptr(unsafe.Pointer(&guid[0]))),
-			(uint64)(uintptr(unsafe.Pointer(&data[0]))),
-			(uint64)(uintptr(unsafe.Pointer(&dataSize)))},
-	)
-
-	return nil, 0, parseStatus(status)
-}
@@ -0,0 +1,153 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+const EFI_SERIAL_IO_PROTOCOL_GUID = "bb25cf6f-f1d4-11d2-9a0c-0090273fc1fd"
+
+// EFI Serial I/O Protocol offsets
+const (
+	serialSetAttributes = 0x10
+	serialWrite         = 0x28
+	serialRead          = 0x30
+	serialMode          = 0x38
+)
+
+// SerialMode represents an EFI Serial I/O Mode descriptor.
+type SerialMode struct {
+	ControlMask      uint32
+	Timeout          uint32
+	BaudRate         uint64
+	ReceiveFifoDepth uint32
+	DataBits         uint32
+	Parity           uint32
+	StopBits         uint32
+}
+
+// SerialIO represents an EFI Serial I/O Protocol instance, it implements the
+// [io.ReadWriter] interface.
+type SerialIO struct {
+	// Handle is the serial device handle.
+	Handle uint64
+
+	base uint64
+}
+
+// SerialPorts returns all EFI Serial I/O Protocol instances.
+func (s *BootServices) SerialPorts() (ports []*SerialIO, err error) {
+	handles, err := s.LocateHandleBuffer(ByProtocol, EFI_SERIAL_IO_PROTOCOL_GUID)
+
+	if err != nil {
+		return
+	}
+
+	for _, h := range handles {
+		addr, err := s.HandleProtocol(h, EFI_SERIAL_IO_PROTOCOL_GUID)
+
+		if err != nil {
+			continue
+		}
+
+		ports = append(ports, &SerialIO{Handle: h, base: addr})
+	}
+
+	return
+}
+
+// Mode returns the EFI_SERIAL_IO_PROTOCOL.Mode descriptor.
+func (p *SerialIO) Mode() (m *SerialMode, err error) {
+	buf, err := read(p.base+serialMode, 8)
+
+	if err != nil {
+		return
+	}
+
+	if buf, err = read(binary.LittleEndian.Uint64(buf), binary.Size(SerialMode{})); err != nil {
+		return
+	}
+
+	m = &SerialMode{}
+	err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, m)
+
+	return
+}
+
+// SetAttributes calls EFI_SERIAL_IO_PROTOCOL.SetAttributes(), to set the baud
+// rate (0 keeps the current one) and the receive timeout per character. Other
+// attributes are kept.
+func (p *SerialIO) SetAttributes(baudRate uint64, timeout time.Duration) (err error) {
+	m, err := p.Mode()
+
+	if err != nil {
+		return
+	}
+
+	if baudRate == 0 {
+		baudRate = m.BaudRate
+	}
+
+	status := CallService(p.base+serialSetAttributes,
+		[]uint64{
+			p.base,
+			baudRate,
+			uint64(m.ReceiveFifoDepth),
+			uint64(max(timeout.Microseconds(), 1)),
+			uint64(m.Parity),
+			uint64(m.DataBits),
+			uint64(m.StopBits),
+		},
+	)
+
+	return parseStatus(status)
+}
+
+// Write calls EFI_SERIAL_IO_PROTOCOL.Write().
+func (p *SerialIO) Write(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	size := uint64(len(buf))
+
+	status := CallService(p.base+serialWrite,
+		[]uint64{
+			p.base,
+			ptrval(&size),
+			ptrval(&buf[0]),
+		},
+	)
+
+	return int(size), parseStatus(status)
+}
+
+// Read calls EFI_SERIAL_IO_PROTOCOL.Read(), it returns the data received
+// within the receive timeout (see SetAttributes).
+func (p *SerialIO) Read(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	size := uint64(len(buf))
+
+	status := CallService(p.base+serialRead,
+		[]uint64{
+			p.base,
+			ptrval(&size),
+			ptrval(&buf[0]),
+		},
+	)
+
+	if status&0xff == EFI_TIMEOUT {
+		return int(size), nil
+	}
+
+	return int(size), parseStatus(status)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"errors"
+
+	"github.com/costinm/uki-stub/pkg/smbios"
+)
+
+// maxSMBIOSSize limits reading of the SMBIOS structure table.
+const maxSMBIOSSize = 1 << 20
+
+// SMBIOS returns the SMBIOS entry point and structure table, located through
+// the EFI Configuration Table, the SMBIOS 3.x entry point is preferred.
+func (s *Services) SMBIOS() (ep *smbios.EntryPoint, table []*smbios.Structure, err error) {
+	var addr uint64
+
+	tables, err := s.SystemTable.ConfigurationTables()
+
+	if err != nil {
+		return
+	}
+
+	for _, t := range tables {
+		switch t.RegistryFormat() {
+		case smbios.Table3GUID:
+			addr = t.VendorTable
+		case smbios.TableGUID:
+			if addr == 0 {
+				addr = t.VendorTable
+			}
+		}
+	}
+
+	if addr == 0 {
+		return nil, nil, errors.New("SMBIOS table not found")
+	}
+
+	buf, err := read(addr, smbios.EntryPointSize)
+
+	if err != nil {
+		return
+	}
+
+	if ep, err = smbios.ParseEntryPoint(buf); err != nil {
+		return
+	}
+
+	size := int(ep.TableLength)
+
+	if size == 0 || size > maxSMBIOSSize {
+		return nil, nil, errors.New("invalid SMBIOS table length")
+	}
+
+	if buf, err = read(ep.TableAddress, size); err != nil {
+		return
+	}
+
+	table, err = smbios.Parse(buf)
+
+	return
+}
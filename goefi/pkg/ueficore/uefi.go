@@ -174,6 +174,9 @@ func (s *Services) Init(imageHandle uint64, systemTable uint64) (err error) {
 		base: s.SystemTable.RuntimeServices,
 	}
 
+	// key states and hotkeys are optional
+	s.Console.InEx, _ = s.Boot.HandleProtocol(s.SystemTable.ConsoleInHandle, EFI_SIMPLE_TEXT_INPUT_EX_PROTOCOL_GUID)
+
 	return
 }
 
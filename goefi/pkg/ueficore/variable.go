@@ -0,0 +1,156 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package ueficore
+
+import (
+	"io"
+
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// initial buffer sizes, grown on EFI_BUFFER_TOO_SMALL
+const (
+	variableSize     = 1024
+	variableNameSize = 512
+)
+
+// GetVariable calls EFI_RUNTIME_SERVICES.GetVariable(), efivar.ErrNotFound
+// is returned for missing variables.
+func (s *RuntimeServices) GetVariable(name string, guid GUID) (data []byte, attr uint32, err error) {
+	n := efivar.EncodeString(name)
+	g := guid.Bytes()
+	buf := make([]byte, variableSize)
+	size := uint64(len(buf))
+
+	for {
+		status := CallService(s.base+getVariable,
+			[]uint64{
+				ptrval(&n[0]),
+				ptrval(&g[0]),
+				ptrval(&attr),
+				ptrval(&size),
+				ptrval(&buf[0]),
+			},
+		)
+
+		switch {
+		case status&0xff == EFI_BUFFER_TOO_SMALL && size > uint64(len(buf)):
+			buf = make([]byte, size)
+			continue
+		case status&0xff == EFI_NOT_FOUND:
+			return nil, 0, efivar.ErrNotFound
+		}
+
+		if err = parseStatus(status); err != nil {
+			return
+		}
+
+		return buf[:size], attr, nil
+	}
+}
+
+// SetVariable calls EFI_RUNTIME_SERVICES.SetVariable(), empty data deletes
+// the variable.
+func (s *RuntimeServices) SetVariable(name string, guid GUID, attr uint32, data []byte) (err error) {
+	var ptr uint64
+
+	n := efivar.EncodeString(name)
+	g := guid.Bytes()
+
+	if len(data) > 0 {
+		ptr = ptrval(&data[0])
+	}
+
+	status := CallService(s.base+setVariable,
+		[]uint64{
+			ptrval(&n[0]),
+			ptrval(&g[0]),
+			uint64(attr),
+			uint64(len(data)),
+			ptr,
+		},
+	)
+
+	if status&0xff == EFI_NOT_FOUND {
+		return efivar.ErrNotFound
+	}
+
+	return parseStatus(status)
+}
+
+// GetNextVariableName calls EFI_RUNTIME_SERVICES.GetNextVariableName(),
+// returning io.EOF once all variables have been enumerated. An empty name
+// starts the enumeration.
+func (s *RuntimeServices) GetNextVariableName(name string, guid GUID) (next string, nextGUID GUID, err error) {
+	n := efivar.EncodeString(name)
+	g := guid.Bytes()
+	buf := make([]byte, max(len(n), variableNameSize))
+	size := uint64(len(buf))
+
+	copy(buf, n)
+
+	for {
+		status := CallService(s.base+getNextVariable,
+			[]uint64{
+				ptrval(&size),
+				ptrval(&buf[0]),
+				ptrval(&g[0]),
+			},
+		)
+
+		switch {
+		case status&0xff == EFI_BUFFER_TOO_SMALL && size > uint64(len(buf)):
+			b := make([]byte, size)
+			copy(b, buf)
+			buf = b
+			continue
+		case status&0xff == EFI_NOT_FOUND:
+			return "", "", io.EOF
+		}
+
+		if err = parseStatus(status); err != nil {
+			return
+		}
+
+		return efivar.DecodeString(buf[:size]), NewGUID(g), nil
+	}
+}
+
+// Variables returns an efivar.Store backed by EFI Runtime Services.
+func (s *RuntimeServices) Variables() efivar.Store {
+	return &variableStore{s}
+}
+
+type variableStore struct {
+	rt *RuntimeServices
+}
+
+func (v *variableStore) Get(name string, guid efivar.GUID) ([]byte, uint32, error) {
+	return v.rt.GetVariable(name, GUID(guid))
+}
+
+func (v *variableStore) Set(name string, guid efivar.GUID, attr uint32, data []byte) error {
+	return v.rt.SetVariable(name, GUID(guid), attr, data)
+}
+
+func (v *variableStore) List() (vars []efivar.Variable, err error) {
+	var name string
+	var guid GUID
+
+	for {
+		name, guid, err = v.rt.GetNextVariableName(name, guid)
+
+		if err == io.EOF {
+			return vars, nil
+		}
+
+		if err != nil {
+			return
+		}
+
+		vars = append(vars, efivar.Variable{Name: name, GUID: efivar.GUID(guid)})
+	}
+}
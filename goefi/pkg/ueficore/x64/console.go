@@ -19,8 +19,38 @@ var Console = &uefi.Console{
 	Out:       conOut,
 }
 
+// Mux represents the standard output and shell consoles, after UEFI.Init()
+// it holds the UEFI services console, displayed on the framebuffer when the
+// firmware text output is not usable. Serial terminals (UART0, SerialIO) can
+// be added, or the UEFI console removed, for headless systems.
+var Mux = &uefi.ConsoleMux{}
+
+// initConsole sets the UEFI services console as standard output.
+func initConsole() {
+	Mux.Console = UEFI.Console
+
+	if _, _, err := UEFI.Console.Size(); err == nil {
+		return
+	}
+
+	gop, err := UEFI.Boot.GetGraphicsOutput()
+
+	if err != nil {
+		return
+	}
+
+	if fb, err := gop.NewConsole(); err == nil {
+		Mux.Display = fb
+	}
+}
+
 //go:linkname printk runtime.printk
 func printk(c byte) {
+	if Mux.Console != nil || Mux.Display != nil || len(Mux.Terminals) > 0 {
+		Mux.Write([]byte{c})
+		return
+	}
+
 	if Console.Out == 0 {
 		return
 	}
@@ -0,0 +1,42 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package x64
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	uefi "github.com/costinm/uki-stub/pkg/ueficore"
+)
+
+// Idle halts the CPU when no goroutine is runnable, until the next runtime
+// timer or a keystroke. Additional wake events (e.g. network) can be added.
+var Idle *uefi.Idle
+
+// initIdle replaces the runtime idle hook set by AMD64.Init(), which only
+// halts when no timer is pending, with one waiting on firmware events.
+func initIdle() {
+	var wake []uint64
+
+	if key, err := UEFI.Console.WaitForKey(); err == nil {
+		wake = append(wake, key)
+	}
+
+	idle, err := UEFI.Boot.NewIdle(wake...)
+
+	if err != nil {
+		fmt.Printf("WARNING: could not create idle timer, %v\n", err)
+		return
+	}
+
+	Idle = idle
+	UEFI.Console.Idle = idle
+
+	runtime.Idle = func(pollUntil int64) {
+		idle.Wait(time.Duration(pollUntil - nanotime1()))
+	}
+}
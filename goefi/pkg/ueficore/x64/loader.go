@@ -0,0 +1,25 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package x64
+
+import (
+	"github.com/costinm/uki-stub/pkg/efivar"
+)
+
+// PublishLoaderInfo writes the Boot Loader Interface variables for the
+// running stub, it is meant to be called right before starting the kernel so
+// that LoaderTimeExecUSec reflects its start.
+func PublishLoaderInfo(stub string, features uint64) error {
+	// partial information is still published
+	info, _ := UEFI.LoaderInfo()
+
+	info.TimeInit = InitTime()
+	info.TimeExec = Uptime()
+	info.StubInfo = stub
+	info.StubFeatures = features
+
+	return efivar.PublishLoaderInfo(UEFI.Runtime.Variables(), info)
+}
@@ -14,46 +14,84 @@ import (
 )
 
 //go:linkname _unused runtime.ramStart
-var _unused uint64 = 0x00100000 // overridden in x64.s
+var _unused uint64 = 0x00100000 // overridden in mem.s
 
+// RamSize is the runtime memory limit, it is reduced to the size of the
+// largest conventional memory region below RamCeiling before the runtime
+// starts (see mem.s).
+//
+// The runtime memory, holding heap and stack, is placed in that region
+// regardless of the image location.
+//
+// It can be overridden at build time with:
+//
+//	-asmflags 'github.com/costinm/uki-stub/pkg/ueficore/x64=-D RAM_SIZE=0x40000000'
+//
 //go:linkname RamSize runtime.ramSize
 var RamSize uint64 = 0x2c000000 // 704MB
 
-func allocateHeap() {
+// RamCeiling is the address below which the runtime memory is placed, it can
+// be overridden at build time with:
+//
+//	-asmflags 'github.com/costinm/uki-stub/pkg/ueficore/x64=-D RAM_CEILING=0x100000000'
+var RamCeiling uint64 = 0x100000000 // 4GB
+
+// MinRamSize is the minimum runtime memory, when less is available the image
+// returns EFI_OUT_OF_RESOURCES to firmware without starting.
+var MinRamSize uint64 = 0x4000000 // 64MB
+
+// set in mem.s
+var ramLimit uint64
+
+// Heap describes the runtime memory allocated at startup.
+type Heap struct {
+	// Start and End delimit the runtime memory.
+	Start uint64
+	End   uint64
+	// Limit is the RamSize before allocation.
+	Limit uint64
+	// Ceiling is RamCeiling.
+	Ceiling uint64
+	// Free is the size of the largest conventional memory region left
+	// after allocation, as available to the kernel.
+	Free uint64
+}
+
+// HeapInfo returns the runtime memory allocated at startup, by scanning the
+// firmware memory map.
+func HeapInfo() (h *Heap, err error) {
+	ramStart, ramEnd := runtime.MemRegion()
+
+	h = &Heap{
+		Start:   ramStart,
+		End:     ramEnd,
+		Limit:   ramLimit,
+		Ceiling: RamCeiling,
+	}
+
 	memoryMap, err := UEFI.Boot.GetMemoryMap()
 
 	if err != nil {
-		fmt.Printf("WARNING: could not get memory map, %err\n", err)
 		return
 	}
 
-	heapStart := uint64(0)
-	ramStart, ramEnd := runtime.MemRegion()
-
-	// locate runtime heap offset within UEFI memory allocation
 	for _, desc := range memoryMap.Descriptors {
-		if heapStart > 0 {
-			// increase RamSize to cover entire page
-			ramEnd = heapStart + uint64(desc.Size())
-			RamSize = ramEnd - ramStart
-			break
-		}
-
-		if desc.Type == uefi.EfiLoaderCode && desc.PhysicalStart == ramStart {
-			heapStart = desc.PhysicalEnd()
+		if desc.Type == uefi.EfiConventionalMemory && uint64(desc.Size()) > h.Free {
+			h.Free = uint64(desc.Size())
 		}
 	}
 
-	if heapStart == 0 {
-		fmt.Println("WARNING: could not find heap offset")
-	}
+	return
+}
+
+// reportHeap prints the runtime memory allocated at startup.
+func reportHeap() {
+	h, err := HeapInfo()
 
-	if err := UEFI.Boot.AllocatePages(
-		uefi.AllocateAddress,
-		uefi.EfiLoaderData,
-		int(ramEnd-heapStart),
-		heapStart,
-	); err != nil {
-		fmt.Printf("WARNING: could not allocate heap at %x\n", heapStart)
+	if err != nil {
+		fmt.Printf("WARNING: could not get memory map, %v\n", err)
 	}
+
+	fmt.Printf("runtime memory %#x-%#x, %d MB (limit %d MB below %#x), largest free region %d MB\n",
+		h.Start, h.End, (h.End-h.Start)>>20, h.Limit>>20, h.Ceiling, h.Free>>20)
 }
@@ -0,0 +1,226 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// Unified Extensible Firmware Interface (UEFI) Specification
+// Version 2.10 - 4.3 EFI System Table, 7.2 Memory Allocation Services
+#define bootServices		96
+#define allocatePages		0x28
+#define getMemoryMap		0x38
+#define outputString		8
+
+#define AllocateAddress		$2
+#define EfiLoaderData		$2
+#define EfiConventionalMemory	$7
+#define EFI_OUT_OF_RESOURCES	$0x8000000000000009
+
+// EFI_MEMORY_DESCRIPTOR offsets
+#define descType		0
+#define descPhysicalStart	8
+#define descNumberOfPages	24
+
+// the heap is never placed in the first megabyte, which also keeps it away
+// from address zero
+#define lowMemory		$0x100000
+
+// memory map buffer size, enough for several hundred descriptors
+#define memoryMapSize		32768
+
+GLOBL	memoryMap<>(SB),NOPTR,$memoryMapSize
+GLOBL	mapSize<>(SB),NOPTR,$8
+GLOBL	mapKey<>(SB),NOPTR,$8
+GLOBL	descSize<>(SB),NOPTR,$8
+GLOBL	descVersion<>(SB),NOPTR,$8
+
+DATA	heapError<>+0(SB)/2, $'n'
+DATA	heapError<>+2(SB)/2, $'o'
+DATA	heapError<>+4(SB)/2, $'t'
+DATA	heapError<>+6(SB)/2, $' '
+DATA	heapError<>+8(SB)/2, $'e'
+DATA	heapError<>+10(SB)/2, $'n'
+DATA	heapError<>+12(SB)/2, $'o'
+DATA	heapError<>+14(SB)/2, $'u'
+DATA	heapError<>+16(SB)/2, $'g'
+DATA	heapError<>+18(SB)/2, $'h'
+DATA	heapError<>+20(SB)/2, $' '
+DATA	heapError<>+22(SB)/2, $'m'
+DATA	heapError<>+24(SB)/2, $'e'
+DATA	heapError<>+26(SB)/2, $'m'
+DATA	heapError<>+28(SB)/2, $'o'
+DATA	heapError<>+30(SB)/2, $'r'
+DATA	heapError<>+32(SB)/2, $'y'
+DATA	heapError<>+34(SB)/2, $' '
+DATA	heapError<>+36(SB)/2, $'f'
+DATA	heapError<>+38(SB)/2, $'o'
+DATA	heapError<>+40(SB)/2, $'r'
+DATA	heapError<>+42(SB)/2, $' '
+DATA	heapError<>+44(SB)/2, $'r'
+DATA	heapError<>+46(SB)/2, $'u'
+DATA	heapError<>+48(SB)/2, $'n'
+DATA	heapError<>+50(SB)/2, $'t'
+DATA	heapError<>+52(SB)/2, $'i'
+DATA	heapError<>+54(SB)/2, $'m'
+DATA	heapError<>+56(SB)/2, $'e'
+DATA	heapError<>+58(SB)/2, $' '
+DATA	heapError<>+60(SB)/2, $'h'
+DATA	heapError<>+62(SB)/2, $'e'
+DATA	heapError<>+64(SB)/2, $'a'
+DATA	heapError<>+66(SB)/2, $'p'
+DATA	heapError<>+68(SB)/2, $'\r'
+DATA	heapError<>+70(SB)/2, $'\n'
+DATA	heapError<>+72(SB)/2, $0
+GLOBL	heapError<>(SB),RODATA,$74
+
+// reserveHeap allocates the runtime memory, before the Go runtime is started,
+// and sets runtime·ramStart, runtime·ramSize and runtime·Bloc accordingly.
+//
+// The firmware memory map is scanned for the largest conventional memory
+// region below RamCeiling, the runtime memory is placed at its start and
+// sized up to RamSize. The runtime heap and stack are therefore independent
+// from the image location. When less than MinRamSize is available, or the
+// memory map cannot be read, an error is printed on the console and
+// EFI_OUT_OF_RESOURCES is returned in AX, otherwise AX is zero.
+//
+// RamSize and RamCeiling can be overridden at build time, see mem.go.
+//
+// It is invoked on the firmware stack and follows the Microsoft x64 calling
+// convention for its callee-saved registers.
+TEXT reserveHeap(SB),NOSPLIT|NOFRAME,$0
+	PUSHQ	BX
+	PUSHQ	R12
+	PUSHQ	R13
+	PUSHQ	R14
+	PUSHQ	R15
+	SUBQ	$40, SP			// shadow stack and fifth argument
+
+#ifdef RAM_SIZE
+	MOVQ	$RAM_SIZE, AX
+	MOVQ	AX, runtime·ramSize(SB)
+#endif
+#ifdef RAM_CEILING
+	MOVQ	$RAM_CEILING, AX
+	MOVQ	AX, ·RamCeiling(SB)
+#endif
+
+	MOVQ	runtime·ramSize(SB), AX
+	MOVQ	AX, ·ramLimit(SB)
+
+	MOVQ	·systemTable(SB), AX
+	MOVQ	bootServices(AX), BX
+
+	// GetMemoryMap(&mapSize, memoryMap, &mapKey, &descSize, &descVersion)
+	MOVQ	$memoryMapSize, AX
+	MOVQ	AX, mapSize<>(SB)
+	MOVQ	$mapSize<>(SB), CX
+	MOVQ	$memoryMap<>(SB), DX
+	MOVQ	$mapKey<>(SB), R8
+	MOVQ	$descSize<>(SB), R9
+	MOVQ	$descVersion<>(SB), AX
+	MOVQ	AX, 32(SP)
+	MOVQ	getMemoryMap(BX), AX
+	CALL	AX
+	CMPQ	AX, $0
+	JNE	short
+
+	// R12 holds the start and R13 the pages of the largest region
+	XORQ	R12, R12
+	XORQ	R13, R13
+
+	MOVQ	$memoryMap<>(SB), R8
+	MOVQ	R8, R9
+	ADDQ	mapSize<>(SB), R9
+	MOVQ	descSize<>(SB), R10
+	MOVQ	·RamCeiling(SB), R11
+
+	CMPQ	R10, $0
+	JE	short
+scan:
+	CMPQ	R8, R9
+	JAE	scanned
+
+	MOVL	descType(R8), AX
+	CMPL	AX, EfiConventionalMemory
+	JNE	next
+
+	// clip the region to [lowMemory, RamCeiling)
+	MOVQ	descPhysicalStart(R8), CX
+	MOVQ	descNumberOfPages(R8), DX
+	SHLQ	$12, DX
+	ADDQ	CX, DX
+
+	CMPQ	CX, lowMemory
+	JAE	2(PC)
+	MOVQ	lowMemory, CX
+	CMPQ	DX, R11
+	JBE	2(PC)
+	MOVQ	R11, DX
+	CMPQ	CX, DX
+	JAE	next
+
+	SUBQ	CX, DX
+	SHRQ	$12, DX
+	CMPQ	DX, R13
+	JBE	next
+
+	MOVQ	CX, R12
+	MOVQ	DX, R13
+next:
+	ADDQ	R10, R8
+	JMP	scan
+
+scanned:
+	// size, in pages, up to RamSize
+	MOVQ	runtime·ramSize(SB), R14
+	SHRQ	$12, R14
+	CMPQ	R14, R13
+	JBE	2(PC)
+	MOVQ	R13, R14
+
+	// minimum, in pages
+	MOVQ	·MinRamSize(SB), AX
+	SHRQ	$12, AX
+	CMPQ	R14, AX
+	JB	short
+	CMPQ	R14, $0
+	JE	short
+
+	// AllocatePages(AllocateAddress, EfiLoaderData, R14, &R15)
+	MOVQ	R12, R15
+	MOVQ	AllocateAddress, CX
+	MOVQ	EfiLoaderData, DX
+	MOVQ	R14, R8
+	MOVQ	R15, 32(SP)
+	LEAQ	32(SP), R9
+	MOVQ	allocatePages(BX), AX
+	CALL	AX
+	CMPQ	AX, $0
+	JNE	short
+
+	// the runtime grows the heap from runtime·Bloc, rather than the end
+	// of the image, up to the stack at the end of the runtime memory
+	MOVQ	R15, runtime·ramStart(SB)
+	MOVQ	R15, runtime·Bloc(SB)
+	MOVQ	R14, AX
+	SHLQ	$12, AX
+	MOVQ	AX, runtime·ramSize(SB)
+	XORQ	AX, AX
+	JMP	ret
+
+short:
+	MOVQ	·conOut(SB), CX
+	MOVQ	$heapError<>(SB), DX
+	MOVQ	outputString(CX), AX
+	CALL	AX
+	MOVQ	EFI_OUT_OF_RESOURCES, AX
+
+ret:
+	ADDQ	$40, SP
+	POPQ	R15
+	POPQ	R14
+	POPQ	R13
+	POPQ	R12
+	POPQ	BX
+	RET
@@ -0,0 +1,42 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package x64
+
+import (
+	"fmt"
+)
+
+// 16550 registers, not exposed by the tamago driver
+const (
+	uartDLL      = 0x00
+	uartDLM      = 0x01
+	uartLCR      = 0x03
+	uartLCR_DLAB = 7
+
+	// uartClock is the divisor base, the 1.8432 MHz clock divided by 16
+	uartClock = 115200
+)
+
+// defined in uart.s
+func in8(port uint16) (val uint8)
+func out8(port uint16, val uint8)
+
+// SetBaudRate sets the UART0 baud rate, the line format is kept.
+func SetBaudRate(baudRate int) error {
+	if baudRate <= 0 || uartClock%baudRate != 0 {
+		return fmt.Errorf("unsupported baud rate %d", baudRate)
+	}
+
+	div := uartClock / baudRate
+	lcr := in8(UART0.Base + uartLCR)
+
+	out8(UART0.Base+uartLCR, lcr|1<<uartLCR_DLAB)
+	out8(UART0.Base+uartDLL, uint8(div))
+	out8(UART0.Base+uartDLM, uint8(div>>8))
+	out8(UART0.Base+uartLCR, lcr&^(1<<uartLCR_DLAB))
+
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright (c) WithSecure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func in8(port uint16) (val uint8)
+TEXT ·in8(SB),$0-9
+	MOVW	port+0(FP), DX
+	// in al, dx
+	BYTE	$0xec
+	MOVB	AL, val+8(FP)
+	RET
+
+// func out8(port uint16, val uint8)
+TEXT ·out8(SB),$0-3
+	MOVW	port+0(FP), DX
+	MOVB	val+2(FP), AL
+	// out dx, al
+	BYTE	$0xee
+	RET
@@ -14,6 +14,7 @@ package x64
 
 import (
 	"fmt"
+	"time"
 	_ "unsafe"
 
 	"github.com/usbarmory/tamago/amd64"
@@ -40,6 +41,9 @@ var (
 	conOut      uint64
 )
 
+// tscInit is the TSC value at runtime initialization.
+var tscInit uint64
+
 // Peripheral instances
 var (
 	// AMD64 core
@@ -71,6 +75,11 @@ func nanotime1() int64 {
 //
 //go:linkname Init runtime.hwinit1
 func Init() {
+	// Counter is a plain RDTSC, valid before the timers are set up, which
+	// only calibrate the frequency used later to convert it. Reading it
+	// first keeps the calibration delay out of InitTime.
+	tscInit = AMD64.Counter()
+
 	// initialize CPU
 	AMD64.Init()
 
@@ -78,6 +87,28 @@ func Init() {
 	UART0.Init()
 }
 
+// sinceReset converts a TSC value to the time elapsed since CPU reset.
+func sinceReset(tsc uint64) time.Duration {
+	freq := uint64(AMD64.Freq())
+
+	if freq == 0 {
+		return 0
+	}
+
+	return time.Duration(tsc/freq*uint64(time.Second) + tsc%freq*uint64(time.Second)/freq)
+}
+
+// InitTime returns the time elapsed between CPU reset and the runtime
+// initialization, as measured by the TSC.
+func InitTime() time.Duration {
+	return sinceReset(tscInit)
+}
+
+// Uptime returns the time elapsed since CPU reset, as measured by the TSC.
+func Uptime() time.Duration {
+	return sinceReset(AMD64.Counter())
+}
+
 func init() {
 	if t, err := RTC.Now(); err == nil {
 		AMD64.SetTime(t.UnixNano())
@@ -89,8 +120,13 @@ func init() {
 
 	if err := UEFI.Init(imageHandle, systemTable); err != nil {
 		fmt.Printf("could not initialize EFI services, %v\n", err)
+	} else {
+		initConsole()
 	}
 
-	// allocate runtime heap in UEFI memory
-	allocateHeap()
+	// runtime heap is allocated in UEFI memory by cpuinit
+	reportHeap()
+
+	// halt the CPU through firmware events when idle
+	initIdle()
 }
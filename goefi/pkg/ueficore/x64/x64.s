@@ -25,11 +25,15 @@ TEXT cpuinit(SB),NOSPLIT|NOFRAME,$0
 	// Enable SSE
 	CALL	sse_enable(SB)
 
-	// ramStart is relocated based on build time variable IMAGE_BASE.
-	MOVQ	$runtime·text(SB), AX
-	SUBQ	$(64*1024), AX
-	MOVQ	AX, runtime·ramStart(SB)
-
+	// Allocate the runtime memory, which sets runtime·ramStart and
+	// runtime·ramSize, on failure return to firmware as the runtime cannot
+	// start.
+	CALL	reserveHeap(SB)
+	CMPQ	AX, $0
+	JE	start
+	RET
+
+start:
 	MOVQ	runtime·ramStart(SB), SP
 	MOVQ	runtime·ramSize(SB), AX
 	MOVQ	runtime·ramStackOffset(SB), BX
@@ -0,0 +1,147 @@
+// Package uki extracts the sections of Unified Kernel Images, the PE images
+// built by efi-mkuki or ukify bundling a stub with a kernel, initrd and
+// cmdline, see
+// https://uapi-group.org/specifications/specs/unified_kernel_image.
+//
+// Only the payload sections are used, the stub bundled in the image is never
+// executed.
+package uki
+
+import (
+	"bufio"
+	"bytes"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UKI section names.
+const (
+	Linux   = ".linux"
+	Initrd  = ".initrd"
+	Cmdline = ".cmdline"
+	OSRel   = ".osrel"
+	Uname   = ".uname"
+	PCRSig  = ".pcrsig"
+	PCRPKey = ".pcrpkey"
+	SBAT    = ".sbat"
+)
+
+// Image represents a parsed UKI.
+type Image struct {
+	// Sections holds the section payloads, by name.
+	Sections map[string][]byte
+}
+
+// Parse extracts the sections of a UKI, which must include a kernel.
+func Parse(buf []byte) (img *Image, err error) {
+	f, err := pe.NewFile(bytes.NewReader(buf))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid PE image, %v", err)
+	}
+
+	defer f.Close()
+
+	img = &Image{
+		Sections: make(map[string][]byte),
+	}
+
+	for _, s := range f.Sections {
+		if _, ok := img.Sections[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate section %s", s.Name)
+		}
+
+		data, err := s.Data()
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid section %s, %v", s.Name, err)
+		}
+
+		// raw data is padded to the file alignment
+		if s.VirtualSize > 0 && int(s.VirtualSize) < len(data) {
+			data = data[:s.VirtualSize]
+		}
+
+		img.Sections[s.Name] = data
+	}
+
+	if len(img.Sections[Linux]) == 0 {
+		return nil, errors.New("missing .linux section")
+	}
+
+	return
+}
+
+// text returns a text section, without trailing NUL bytes and whitespace.
+func (img *Image) text(name string) string {
+	return strings.TrimSpace(strings.TrimRight(string(img.Sections[name]), "\x00"))
+}
+
+// Kernel returns the .linux section.
+func (img *Image) Kernel() []byte {
+	return img.Sections[Linux]
+}
+
+// Initrd returns the .initrd section, or nil.
+func (img *Image) Initrd() []byte {
+	return img.Sections[Initrd]
+}
+
+// Cmdline returns the .cmdline section.
+func (img *Image) Cmdline() string {
+	return img.text(Cmdline)
+}
+
+// Uname returns the .uname section, the kernel release.
+func (img *Image) Uname() string {
+	return img.text(Uname)
+}
+
+// OSRelease returns the .osrel section fields, in os-release(5) format.
+func (img *Image) OSRelease() map[string]string {
+	rel := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(img.Sections[OSRel]))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, val, found := strings.Cut(line, "=")
+
+		if !found {
+			continue
+		}
+
+		if v, err := strconv.Unquote(val); err == nil {
+			val = v
+		} else {
+			val = strings.Trim(val, `'"`)
+		}
+
+		rel[key] = val
+	}
+
+	return rel
+}
+
+// Name returns a description of the image, from its os-release and kernel
+// release.
+func (img *Image) Name() (name string) {
+	rel := img.OSRelease()
+
+	if name = rel["PRETTY_NAME"]; len(name) == 0 {
+		name = rel["NAME"]
+	}
+
+	if uname := img.Uname(); len(uname) > 0 {
+		name = strings.TrimSpace(name + " " + uname)
+	}
+
+	return
+}